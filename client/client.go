@@ -1,6 +1,7 @@
 package client
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/hex"
@@ -9,6 +10,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -82,23 +85,114 @@ func (client *Client) GetSigStr(txSigHash string) (sig string, err error) {
 	return
 }
 
-func (client *Client) GetRedeemingUtxosForOperators() (utxoList []*sbchrpctypes.UtxoInfo, err error) {
-	err = client.getWithTimeout("/redeeming-utxos-for-operators", &utxoList)
-	return
+func (client *Client) GetRedeemingUtxosForOperators() ([]*sbchrpctypes.UtxoInfo, error) {
+	list, err := client.ListRedeemingUtxosForOperators(nil)
+	return list.Utxos, err
 }
 
-func (client *Client) GetRedeemingUtxosForMonitors() (utxoList []*sbchrpctypes.UtxoInfo, err error) {
-	err = client.getWithTimeout("/redeeming-utxos-for-monitors", &utxoList)
-	return
+func (client *Client) GetRedeemingUtxosForMonitors() ([]*sbchrpctypes.UtxoInfo, error) {
+	list, err := client.ListRedeemingUtxosForMonitors(nil)
+	return list.Utxos, err
+}
+
+func (client *Client) GetToBeConvertedUtxosForOperators() ([]*sbchrpctypes.UtxoInfo, error) {
+	list, err := client.ListToBeConvertedUtxosForOperators(nil)
+	return list.Utxos, err
+}
+
+func (client *Client) GetToBeConvertedUtxosForMonitors() ([]*sbchrpctypes.UtxoInfo, error) {
+	list, err := client.ListToBeConvertedUtxosForMonitors(nil)
+	return list.Utxos, err
+}
+
+// UtxoListOptions filters and pages the UTXO lists, the zero value gets the whole list
+type UtxoListOptions struct {
+	CovenantAddr *gethcmn.Address
+	RedeemTarget *gethcmn.Address
+	Txid         *gethcmn.Hash
+	MinAmount    *uint64 // in satoshi
+	MaxAmount    *uint64 // in satoshi
+	IsRedeemed   *bool
+	Cursor       string // the NextCursor of the previous page
+	Limit        int    // page size, no more than 1000
+}
+
+// encode returns the query string with meta=true, so that the list is returned with its height
+func (opts *UtxoListOptions) encode() string {
+	query := url.Values{}
+	query.Set("meta", "true")
+	if opts == nil {
+		return "?" + query.Encode()
+	}
+	if opts.CovenantAddr != nil {
+		query.Set("covenantAddr", opts.CovenantAddr.Hex())
+	}
+	if opts.RedeemTarget != nil {
+		query.Set("redeemTarget", opts.RedeemTarget.Hex())
+	}
+	if opts.Txid != nil {
+		query.Set("txid", opts.Txid.Hex())
+	}
+	if opts.MinAmount != nil {
+		query.Set("minAmount", strconv.FormatUint(*opts.MinAmount, 10))
+	}
+	if opts.MaxAmount != nil {
+		query.Set("maxAmount", strconv.FormatUint(*opts.MaxAmount, 10))
+	}
+	if opts.IsRedeemed != nil {
+		query.Set("isRedeemed", strconv.FormatBool(*opts.IsRedeemed))
+	}
+	if opts.Cursor != "" {
+		query.Set("cursor", opts.Cursor)
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	return "?" + query.Encode()
 }
 
-func (client *Client) GetToBeConvertedUtxosForOperators() (utxoList []*sbchrpctypes.UtxoInfo, err error) {
-	err = client.getWithTimeout("/to-be-converted-utxos-for-operators", &utxoList)
+// GetUtxoList gets one of the polled UTXO lists with its height, path is like "/redeeming-utxos-for-operators"
+func (client *Client) GetUtxoList(path string, opts *UtxoListOptions) (list operator.UtxoList, err error) {
+	err = client.getWithTimeout(path+opts.encode(), &list)
 	return
 }
 
-func (client *Client) GetToBeConvertedUtxosForMonitors() (utxoList []*sbchrpctypes.UtxoInfo, err error) {
-	err = client.getWithTimeout("/to-be-converted-utxos-for-monitors", &utxoList)
+func (client *Client) ListRedeemingUtxosForOperators(opts *UtxoListOptions) (operator.UtxoList, error) {
+	return client.GetUtxoList("/redeeming-utxos-for-operators", opts)
+}
+
+func (client *Client) ListRedeemingUtxosForMonitors(opts *UtxoListOptions) (operator.UtxoList, error) {
+	return client.GetUtxoList("/redeeming-utxos-for-monitors", opts)
+}
+
+func (client *Client) ListToBeConvertedUtxosForOperators(opts *UtxoListOptions) (operator.UtxoList, error) {
+	return client.GetUtxoList("/to-be-converted-utxos-for-operators", opts)
+}
+
+func (client *Client) ListToBeConvertedUtxosForMonitors(opts *UtxoListOptions) (operator.UtxoList, error) {
+	return client.GetUtxoList("/to-be-converted-utxos-for-monitors", opts)
+}
+
+func (client *Client) ListRedeemableUtxos(opts *UtxoListOptions) (operator.UtxoList, error) {
+	return client.GetUtxoList("/redeemable-utxos", opts)
+}
+
+func (client *Client) ListLostAndFoundUtxos(opts *UtxoListOptions) (operator.UtxoList, error) {
+	return client.GetUtxoList("/lost-and-found-utxos", opts)
+}
+
+func (client *Client) GetRedeemableUtxos() ([]*sbchrpctypes.UtxoInfo, error) {
+	list, err := client.ListRedeemableUtxos(nil)
+	return list.Utxos, err
+}
+
+func (client *Client) GetLostAndFoundUtxos() ([]*sbchrpctypes.UtxoInfo, error) {
+	list, err := client.ListLostAndFoundUtxos(nil)
+	return list.Utxos, err
+}
+
+func (client *Client) GetCcInfo() (snapshot operator.CcInfoSnapshot, err error) {
+	err = client.getWithTimeout("/cc-info", &snapshot)
 	return
 }
 
@@ -124,6 +218,17 @@ func (client *Client) getWithTimeout(pathAndQuery string, result any) error {
 	return client.httpGet(ctx, pathAndQuery, result)
 }
 
+func (client *Client) postWithTimeout(path string, body any, result any) error {
+	ctx := context.Background()
+	if client.reqTimeout > 0 {
+		var cancelFn context.CancelFunc
+		ctx, cancelFn = context.WithTimeout(ctx, client.reqTimeout)
+		defer cancelFn()
+	}
+
+	return client.httpPost(ctx, path, body, result)
+}
+
 func (client *Client) httpGet(ctx context.Context, pathAndQuery string, result any) error {
 
 	req, err := http.NewRequestWithContext(ctx, "GET", client.rpcUrl+pathAndQuery, nil)
@@ -131,6 +236,25 @@ func (client *Client) httpGet(ctx context.Context, pathAndQuery string, result a
 		return err
 	}
 
+	return client.doRequest(req, result)
+}
+
+func (client *Client) httpPost(ctx context.Context, path string, body any, result any) error {
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", client.rpcUrl+path, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return client.doRequest(req, result)
+}
+
+func (client *Client) doRequest(req *http.Request, result any) error {
 	resp, err := client.httpClient.Do(req)
 	if err != nil {
 		return err
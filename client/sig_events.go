@@ -0,0 +1,94 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/smartbch/cc-operator/operator"
+)
+
+const (
+	sigEventsMinRetryDelay = 1 * time.Second
+	sigEventsMaxRetryDelay = 30 * time.Second
+)
+
+// SubscribeSigEvents calls handler with the events after since, in order, until ctx is done.
+// since is the ID of the last handled event, or empty to start from the new events.
+// It reconnects after the stream ends and resumes from the last event id got.
+// If events may have been missed, since the operator has restarted or the events are not kept anymore,
+// handler gets an operator.SigEventReset or operator.SigEventGap event before the kept ones.
+// A suspended operator is only resumed by a restart, so a reset event also ends operator.SigEventSuspended.
+func (client *Client) SubscribeSigEvents(ctx context.Context, since string, handler func(event operator.SigEvent)) error {
+	retryDelay := sigEventsMinRetryDelay
+	for {
+		n, err := client.readSigEvents(ctx, &since, handler)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil || n > 0 {
+			retryDelay = sigEventsMinRetryDelay
+		} else if retryDelay *= 2; retryDelay > sigEventsMaxRetryDelay {
+			retryDelay = sigEventsMaxRetryDelay
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// readSigEvents reads one stream, and returns the number of events got
+func (client *Client) readSigEvents(ctx context.Context, since *string,
+	handler func(event operator.SigEvent)) (int, error) {
+
+	pathAndQuery := "/sig-events"
+	if *since != "" {
+		pathAndQuery += "?since=" + url.QueryEscape(*since)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", client.rpcUrl+pathAndQuery, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		var respObj OpResp
+		_ = json.NewDecoder(resp.Body).Decode(&respObj)
+		return 0, fmt.Errorf("not an event stream: %s", respObj.Error)
+	}
+
+	n := 0
+	var data strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			*since = line[len("id: "):]
+		case strings.HasPrefix(line, "data: "):
+			data.WriteString(line[len("data: "):])
+		case line == "" && data.Len() > 0:
+			var event operator.SigEvent
+			if err := json.Unmarshal([]byte(data.String()), &event); err != nil {
+				return n, err
+			}
+			data.Reset()
+			n++
+			handler(event)
+		}
+	}
+	return n, scanner.Err()
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"encoding/hex"
+	"errors"
+
+	"github.com/smartbch/cc-operator/operator"
+)
+
+// the SigStatusError returned by GetReadySig matches these with errors.Is
+var (
+	ErrSigUnknown          = errors.New("sigHash unknown")
+	ErrSigPendingPublicity = errors.New("sigHash in publicity period")
+	ErrSigVetoed           = errors.New("sigHash vetoed")
+	ErrOperatorSuspended   = errors.New("operator suspended")
+	ErrSigPolicyRejected   = errors.New("sigHash rejected by operator policy")
+	ErrSigRevoked          = errors.New("sigHash revoked")
+	ErrSigStatusUnknown    = errors.New("unknown sig status")
+)
+
+var sigStatusErrors = map[string]error{
+	operator.SigStatusUnknown:          ErrSigUnknown,
+	operator.SigStatusPendingPublicity: ErrSigPendingPublicity,
+	operator.SigStatusVetoed:           ErrSigVetoed,
+	operator.SigStatusSuspended:        ErrOperatorSuspended,
+	operator.SigStatusPolicyRejected:   ErrSigPolicyRejected,
+	operator.SigStatusRevoked:          ErrSigRevoked,
+}
+
+// SigStatusError explains why a signature is not ready
+type SigStatusError struct {
+	Status operator.SigStatus
+}
+
+func (e *SigStatusError) Error() string {
+	msg := e.Unwrap().Error() + ": " + e.Status.SigHash
+	if e.Status.Reason != "" {
+		msg += ", " + e.Status.Reason
+	}
+	return msg
+}
+
+func (e *SigStatusError) Unwrap() error {
+	if err, ok := sigStatusErrors[e.Status.Status]; ok {
+		return err
+	}
+	return ErrSigStatusUnknown
+}
+
+// SigFromStatus returns the signature, or a *SigStatusError if status is not ready
+func SigFromStatus(status operator.SigStatus) ([]byte, error) {
+	if status.Status != operator.SigStatusReady {
+		return nil, &SigStatusError{Status: status}
+	}
+	return status.Sig, nil
+}
+
+func (client *Client) GetSigStatus(txSigHash []byte) (status operator.SigStatus, err error) {
+	err = client.getWithTimeout("/sig-status?hash="+hex.EncodeToString(txSigHash), &status)
+	return
+}
+
+// GetReadySig is like GetSig but returns a *SigStatusError if the signature is not ready
+func (client *Client) GetReadySig(txSigHash []byte) ([]byte, error) {
+	status, err := client.GetSigStatus(txSigHash)
+	if err != nil {
+		return nil, err
+	}
+	return SigFromStatus(status)
+}
+
+// GetSigs gets the statuses of a batch of sigHashes in the same order, the signatures are in the ready ones
+func (client *Client) GetSigs(txSigHashes [][]byte) (statuses []operator.SigStatus, err error) {
+	sigHashes := make([]string, len(txSigHashes))
+	for i, txSigHash := range txSigHashes {
+		sigHashes[i] = hex.EncodeToString(txSigHash)
+	}
+	err = client.postWithTimeout("/sigs", sigHashes, &statuses)
+	return
+}
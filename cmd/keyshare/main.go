@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/smartbch/cc-operator/operator"
+	"github.com/smartbch/cc-operator/utils"
+)
+
+// decrypts the key share of a recovery holder from the operator's key backup file,
+// and submits it to the recovery session of the operator, encrypted to the session key of its enclave
+func main() {
+	backupFile := flag.String("backup-file", "key-backup.json", "key backup file written by cc-operator")
+	recoveryKey := flag.String("recovery-key", "", "hex encoded private key of the recovery holder")
+	opAddr := flag.String("operator-addr", "localhost:8802", "address of the recovery session of the operator")
+	signerID := flag.String("signer-id", "", "signer ID of the operator enclave")
+	uniqueID := flag.String("unique-id", "", "unique ID of the operator enclave")
+	insecure := flag.Bool("insecure", false, "accept a session without SGX report, for integration test only")
+	flag.Parse()
+
+	data, err := os.ReadFile(*backupFile)
+	if err != nil {
+		println("failed to read backup file: ", err.Error())
+		return
+	}
+	var backup operator.KeyBackup
+	if err = json.Unmarshal(data, &backup); err != nil {
+		println("failed to parse backup file: ", err.Error())
+		return
+	}
+
+	key, err := crypto.HexToECDSA(*recoveryKey)
+	if err != nil {
+		println("invalid recovery key: ", err.Error())
+		return
+	}
+
+	var share []byte
+	for _, encryptedShare := range backup.Shares {
+		if share, err = operator.DecryptKeyShare(encryptedShare, key); err == nil {
+			break
+		}
+	}
+	if share == nil {
+		println("no share found for this recovery key")
+		return
+	}
+
+	session, err := getSession(*opAddr)
+	if err != nil {
+		println("failed to get recovery session: ", err.Error())
+		return
+	}
+	if !bytes.Equal(session.BackupPubkey, backup.Pubkey) {
+		fmt.Printf("backup pubkey not match! expected: %s, got: %s\n", backup.Pubkey, session.BackupPubkey)
+		return
+	}
+	if err = checkSessionReport(session, gethcmn.FromHex(*signerID), gethcmn.FromHex(*uniqueID), *insecure); err != nil {
+		println("failed to check session report: ", err.Error())
+		return
+	}
+
+	encrypted, err := operator.EncryptShareToSession(session.SessionPubkey, crypto.CompressPubkey(&key.PublicKey), share)
+	if err != nil {
+		println("failed to encrypt share: ", err.Error())
+		return
+	}
+	session, err = submitShare(*opAddr, encrypted)
+	if err != nil {
+		println("failed to submit share: ", err.Error())
+		return
+	}
+	fmt.Println("operator pubkey: ", backup.Pubkey.String())
+	fmt.Printf("shares received: %d/%d, recovered: %t\n", session.Received, session.Threshold, session.Recovered)
+}
+
+func getSession(opAddr string) (*operator.RecoverySessionInfo, error) {
+	url := "https://" + opAddr + "/recovery-session"
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+	data, err := utils.HttpsGet(tlsConfig, url)
+	if err != nil {
+		return nil, err
+	}
+	return parseSessionResp(data)
+}
+
+func submitShare(opAddr string, share *operator.EncryptedKeyShare) (*operator.RecoverySessionInfo, error) {
+	body, _ := json.Marshal(share)
+	client := http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		Timeout:   3 * time.Second,
+	}
+	resp, err := client.Post("https://"+opAddr+"/recovery-share", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var data bytes.Buffer
+	if _, err = data.ReadFrom(resp.Body); err != nil {
+		return nil, err
+	}
+	return parseSessionResp(data.Bytes())
+}
+
+func parseSessionResp(data []byte) (*operator.RecoverySessionInfo, error) {
+	var resp struct {
+		Success bool                         `json:"success"`
+		Error   string                       `json:"error"`
+		Result  operator.RecoverySessionInfo `json:"result"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, errors.New(resp.Error)
+	}
+	return &resp.Result, nil
+}
+
+// checkSessionReport checks that the session key is generated by the expected enclave
+func checkSessionReport(session *operator.RecoverySessionInfo, signerID, uniqueID []byte, insecure bool) error {
+	if len(session.Report) == 0 {
+		if insecure {
+			return nil
+		}
+		return errors.New("no SGX report")
+	}
+	report, err := utils.VerifyRemoteReport(session.Report)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(report.SignerID, signerID) {
+		return fmt.Errorf("signer-id not match! expected: %x, got: %x", signerID, report.SignerID)
+	}
+	if !bytes.Equal(report.UniqueID, uniqueID) {
+		return fmt.Errorf("unique-id not match! expected: %x, got: %x", uniqueID, report.UniqueID)
+	}
+	hash := sha256.Sum256(session.SessionPubkey)
+	if !bytes.Equal(report.Data[:len(hash)], hash[:]) {
+		return fmt.Errorf("session pubkey hash not match! expected: %x, got: %x", hash, report.Data[:len(hash)])
+	}
+	return nil
+}
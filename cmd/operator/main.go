@@ -1,22 +1,45 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
+
 	"github.com/smartbch/cc-operator/operator"
+	"github.com/smartbch/cc-operator/sbch"
 )
 
 var (
-	helpFlag       = false
-	serverName     = "cc-operator"
-	listenAddr     = "0.0.0.0:8801"
-	privateRpcURLs = ""
-	signerKeyWIF   = ""    // test only
-	withChaos      = false // test only
+	helpFlag        = false
+	serverName      = "cc-operator"
+	listenAddr      = "0.0.0.0:8801"
+	privateRpcURLs  = ""
+	recoveryPubkeys = ""
+	backupThreshold = 0
+	recoverPubkey   = ""
+	recoveryAddr    = ""
+	identitiesFile  = ""
+	chainID         = uint64(0)
+	genesisHash     = ""
+	maxNodeLag      = 10 * time.Minute
+	minActiveNodes  = 0
+	revokeGrace     = 5 * time.Minute
+	nodeSignerID    = ""
+	nodeUniqueID    = ""
+	signerKeyWIF    = ""    // test only
+	withChaos       = false // test only
 
 	// TODO: change this to constant in production mode
 	nodesGovAddr = "0x0000000000000000000000000000000000001234"
@@ -38,6 +61,18 @@ func main() {
 	flag.StringVar(&nodesGovAddr, "nodesGovAddr", nodesGovAddr, "address of NodesGov contract")
 	flag.StringVar(&newFixedBootstrapRpcUrl, "newFixedBootstrapUrl", newFixedBootstrapRpcUrl, "new fixed bootstrap urls with signature separated with comma")
 	flag.StringVar(&privateRpcURLs, "privateRpcUrls", privateRpcURLs, "comma separated private rpc urls")
+	flag.StringVar(&recoveryPubkeys, "recoveryPubkeys", recoveryPubkeys, "comma separated pubkeys of key recovery holders, enables key backup at key generation")
+	flag.IntVar(&backupThreshold, "backupThreshold", backupThreshold, "number of shares required to recover the key")
+	flag.StringVar(&recoverPubkey, "recoverPubkey", recoverPubkey, "pubkey of the lost key, recovers it from backup with the shares submitted by recovery holders")
+	flag.StringVar(&recoveryAddr, "recoveryListenAddr", recoveryAddr, "listen addr of the key recovery session, ip:port, default: 0.0.0.0:8802")
+	flag.Uint64Var(&chainID, "chainId", chainID, "expected chain id of sbchd nodes, 0 means not checked")
+	flag.StringVar(&genesisHash, "genesisHash", genesisHash, "expected genesis block hash of sbchd nodes, empty means not checked")
+	flag.DurationVar(&maxNodeLag, "maxNodeLag", maxNodeLag, "sbchd nodes whose latest block is older than this are excluded, 0 means not checked")
+	flag.IntVar(&minActiveNodes, "minActiveNodes", minActiveNodes, "sbchd calls fail if fewer public nodes are not excluded, 0 means a strict majority")
+	flag.DurationVar(&revokeGrace, "sigRevokeGracePeriod", revokeGrace, "signatures are not served if their sigHashes are not listed for this period")
+	flag.StringVar(&nodeSignerID, "nodeSignerId", nodeSignerID, "signer ID of the sbchd enclave, public nodes must be attested if set (needs sbchd serving sbch_getRpcPubkeyReport)")
+	flag.StringVar(&nodeUniqueID, "nodeUniqueId", nodeUniqueID, "unique ID of the sbchd enclave, public nodes must be attested if set (needs sbchd serving sbch_getRpcPubkeyReport)")
+	flag.StringVar(&identitiesFile, "identitiesFile", identitiesFile, "JSON file of operator identities to host in this process")
 	flag.StringVar(&signerKeyWIF, "signerKeyWIF", signerKeyWIF, "signer key WIF, for integration test only")
 	flag.BoolVar(&withChaos, "withChaos", withChaos, "return chaos, for integration test only")
 
@@ -48,14 +83,228 @@ func main() {
 	}
 
 	bootstrapRpcURLs := getBootstrapRpcUrls(newFixedBootstrapRpcUrl, bootstrapSetPubkey)
+	chainPolicy, err := getChainPolicy(chainID, genesisHash)
+	if err != nil {
+		panic(err)
+	}
+	enclavePolicy, err := getEnclavePolicy(nodeSignerID, nodeUniqueID)
+	if err != nil {
+		panic(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if identitiesFile != "" {
+		err = runIdentities(ctx, identitiesFile, bootstrapRpcURLs)
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	op, err := operator.NewOperator(ctx, operator.Config{
+		ServerName:       serverName,
+		ListenAddr:       listenAddr,
+		NodesGovAddr:     nodesGovAddr,
+		SignerKeyWIF:     signerKeyWIF,
+		BootstrapRpcURLs: bootstrapRpcURLs,
+		PrivateRpcURLs:   splitList(privateRpcURLs),
+		ChainPolicy:      chainPolicy,
+		EnclavePolicy:    enclavePolicy,
+		KeyBackup: operator.KeyBackupParams{
+			RecoveryPubkeys:    splitList(recoveryPubkeys),
+			Threshold:          backupThreshold,
+			RecoverPubkey:      recoverPubkey,
+			RecoveryListenAddr: recoveryAddr,
+		},
+		SigRevokeGracePeriod: revokeGrace,
+		WithChaos:            withChaos,
+	})
+	if err != nil {
+		panic(err)
+	}
+	err = op.Run(ctx)
+	if _err := op.Close(); err == nil {
+		err = _err
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+// identity is an entry of identitiesFile, e.g.
+// [{"pathPrefix":"mainnet","nodesGovAddr":"0x...","keyFile":"/data/mainnet-key.txt","nodesFile":"/data/mainnet-nodes.txt"},
+// {"pathPrefix":"testnet","nodesGovAddr":"0x...","keyFile":"/data/testnet-key.txt","nodesFile":"/data/testnet-nodes.txt",
+// "bootstrapRpcUrls":["http://..."],"chainId":10001}]
+type identity struct {
+	PathPrefix       string   `json:"pathPrefix"`
+	ListenAddr       string   `json:"listenAddr"` // optional, default: -listenAddr
+	NodesGovAddr     string   `json:"nodesGovAddr"`
+	KeyFile          string   `json:"keyFile"`
+	NodesFile        string   `json:"nodesFile"`
+	AuditFile        string   `json:"auditFile"`        // optional, default: nodesFile + ".audit.log"
+	BootstrapRpcURLs []string `json:"bootstrapRpcUrls"` // optional, default: fixed bootstrap urls
+	PrivateRpcURLs   []string `json:"privateRpcUrls"`
+	RecoverPubkey    string   `json:"recoverPubkey"`      // optional, the pubkey of the lost key to recover
+	RecoveryAddr     string   `json:"recoveryListenAddr"` // optional, default: -recoveryListenAddr
+	ChainID          uint64   `json:"chainId"`            // optional, default: -chainId
+	GenesisHash      string   `json:"genesisHash"`        // optional, default: -genesisHash
+	NodeSignerID     string   `json:"nodeSignerId"`       // optional, default: -nodeSignerId
+	NodeUniqueID     string   `json:"nodeUniqueId"`       // optional, default: -nodeUniqueId
+}
+
+// runIdentities runs one operator.Host per listen address, until ctx is done or one of them fails
+func runIdentities(ctx context.Context, identitiesFile string, defaultBootstrapRpcURLs []string) error {
+	data, err := os.ReadFile(identitiesFile)
+	if err != nil {
+		return err
+	}
+	var identities []identity
+	if err = json.Unmarshal(data, &identities); err != nil {
+		return err
+	}
+
+	listeners := map[string]map[string]*operator.Operator{}
+	var ops []*operator.Operator
+	defer func() {
+		for _, op := range ops {
+			_ = op.Close()
+		}
+	}()
+	files := map[string]bool{}
+	for _, id := range identities {
+		if id.KeyFile == "" || files[id.KeyFile] {
+			return errors.New("missing or duplicated keyFile: " + id.KeyFile)
+		}
+		files[id.KeyFile] = true
+		if id.NodesFile == "" || files[id.NodesFile] {
+			return errors.New("missing or duplicated nodesFile: " + id.NodesFile)
+		}
+		files[id.NodesFile] = true
+		if id.AuditFile == "" {
+			id.AuditFile = id.NodesFile + ".audit.log"
+		}
+		if files[id.AuditFile] {
+			return errors.New("duplicated auditFile: " + id.AuditFile)
+		}
+		files[id.AuditFile] = true
+		if id.ListenAddr == "" {
+			id.ListenAddr = listenAddr
+		}
+		if len(id.BootstrapRpcURLs) == 0 {
+			id.BootstrapRpcURLs = defaultBootstrapRpcURLs
+		}
+		if id.ChainID == 0 {
+			id.ChainID = chainID
+		}
+		if id.GenesisHash == "" {
+			id.GenesisHash = genesisHash
+		}
+		if id.NodeSignerID == "" {
+			id.NodeSignerID = nodeSignerID
+		}
+		if id.NodeUniqueID == "" {
+			id.NodeUniqueID = nodeUniqueID
+		}
+		if id.RecoveryAddr == "" {
+			id.RecoveryAddr = recoveryAddr
+		}
+		chainPolicy, err := getChainPolicy(id.ChainID, id.GenesisHash)
+		if err != nil {
+			return err
+		}
+		enclavePolicy, err := getEnclavePolicy(id.NodeSignerID, id.NodeUniqueID)
+		if err != nil {
+			return err
+		}
+
+		op, err := operator.NewOperator(ctx, operator.Config{
+			NodesGovAddr:     id.NodesGovAddr,
+			KeyFile:          id.KeyFile,
+			NodesFile:        id.NodesFile,
+			AuditFile:        id.AuditFile,
+			SignerKeyWIF:     signerKeyWIF,
+			BootstrapRpcURLs: id.BootstrapRpcURLs,
+			PrivateRpcURLs:   id.PrivateRpcURLs,
+			ChainPolicy:      chainPolicy,
+			EnclavePolicy:    enclavePolicy,
+			KeyBackup: operator.KeyBackupParams{
+				RecoveryPubkeys:    splitList(recoveryPubkeys),
+				Threshold:          backupThreshold,
+				RecoverPubkey:      id.RecoverPubkey,
+				RecoveryListenAddr: id.RecoveryAddr,
+			},
+			SigRevokeGracePeriod: revokeGrace,
+			WithChaos:            withChaos,
+		})
+		if err != nil {
+			return err
+		}
+		ops = append(ops, op)
 
-	var privateRpcURLList []string
-	if privateRpcURLs != "" {
-		privateRpcURLList = strings.Split(privateRpcURLs, ",")
+		if listeners[id.ListenAddr] == nil {
+			listeners[id.ListenAddr] = map[string]*operator.Operator{}
+		}
+		if listeners[id.ListenAddr][id.PathPrefix] != nil {
+			return errors.New("duplicated pathPrefix: " + id.PathPrefix)
+		}
+		listeners[id.ListenAddr][id.PathPrefix] = op
 	}
 
-	operator.Start(serverName, listenAddr, nodesGovAddr, signerKeyWIF,
-		bootstrapRpcURLs, privateRpcURLList, withChaos)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, len(listeners))
+	for addr, ops := range listeners {
+		host, err := operator.NewHost(serverName, addr, ops)
+		if err != nil {
+			return err
+		}
+		go func() {
+			errs <- host.Run(ctx)
+			cancel()
+		}()
+	}
+
+	for i := 0; i < len(listeners); i++ {
+		if _err := <-errs; _err != nil && err == nil {
+			err = _err
+		}
+	}
+	return err
+}
+
+func getChainPolicy(chainID uint64, genesisHash string) (sbch.ChainPolicy, error) {
+	policy := sbch.ChainPolicy{ChainID: chainID, MaxLag: maxNodeLag, MinActiveNodes: minActiveNodes}
+	if genesisHash != "" {
+		hash, err := hexutil.Decode(genesisHash)
+		if err != nil || len(hash) != 32 {
+			return policy, errors.New("invalid genesisHash: " + genesisHash)
+		}
+		policy.GenesisHash = gethcmn.BytesToHash(hash)
+	}
+	return policy, nil
+}
+
+func getEnclavePolicy(signerID, uniqueID string) (policy sbch.EnclavePolicy, err error) {
+	if signerID != "" {
+		if policy.SignerID, err = hexutil.Decode(signerID); err != nil || len(policy.SignerID) != 32 {
+			return policy, errors.New("invalid nodeSignerId: " + signerID)
+		}
+	}
+	if uniqueID != "" {
+		if policy.UniqueID, err = hexutil.Decode(uniqueID); err != nil || len(policy.UniqueID) != 32 {
+			return policy, errors.New("invalid nodeUniqueId: " + uniqueID)
+		}
+	}
+	return policy, nil
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
 }
 
 func getNewBootstrapRpcPubkey(pbkHex string) []byte {
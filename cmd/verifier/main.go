@@ -5,15 +5,20 @@ import (
 	"crypto/sha256"
 	"crypto/tls"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 
 	"github.com/edgelesssys/ego/attestation"
 	gethcmn "github.com/ethereum/go-ethereum/common"
 
+	"github.com/smartbch/cc-operator/operator"
 	"github.com/smartbch/cc-operator/utils"
 )
 
+const auditPageLimit = 1000
+
 //var (
 //	signer    string
 //	uniqueID  []byte
@@ -24,6 +29,7 @@ func main() {
 	signerID := flag.String("signer-id", "", "signer ID")
 	uniqueID := flag.String("unique-id", "", "unique ID")
 	opAddr := flag.String("operator-addr", "localhost:8801", "operator address")
+	audit := flag.Bool("audit", false, "also verify the audit log against its head signed by the pubkey")
 	flag.Parse()
 
 	signerIDBytes := gethcmn.FromHex(*signerID)
@@ -55,6 +61,16 @@ func main() {
 
 	fmt.Println("verification passed!")
 	fmt.Println("pubkey: ", "0x"+hex.EncodeToString(pubkeyBytes))
+
+	if *audit {
+		head, err := verifyAuditLog(*opAddr, pubkeyBytes)
+		if err != nil {
+			println("failed to verify audit log: ", err.Error())
+			return
+		}
+		fmt.Println("audit log verification passed!")
+		fmt.Println("audit entries: ", head.Seq, ", head hash: ", head.Hash.Hex())
+	}
 }
 
 func getPubkey(opAddr string) ([]byte, error) {
@@ -68,6 +84,57 @@ func getPubkeyReport(opAddr string) ([]byte, error) {
 	return utils.HttpsGet(tlsConfig, url)
 }
 
+func getAuditPage(opAddr string, fromSeq uint64) (*operator.AuditPage, error) {
+	url := fmt.Sprintf("https://%s/audit?fromSeq=%d&limit=%d", opAddr, fromSeq, auditPageLimit)
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+	data, err := utils.HttpsGet(tlsConfig, url)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Success bool               `json:"success"`
+		Error   string             `json:"error"`
+		Result  operator.AuditPage `json:"result"`
+	}
+	if err = json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, errors.New(resp.Error)
+	}
+	return &resp.Result, nil
+}
+
+// verifyAuditLog checks the whole chain of the audit log from the first entry,
+// and that it ends at the head signed by the pubkey
+func verifyAuditLog(opAddr string, pubkey []byte) (*operator.AuditHead, error) {
+	var lastSeq uint64
+	var lastHash gethcmn.Hash
+	for {
+		page, err := getAuditPage(opAddr, lastSeq+1)
+		if err != nil {
+			return nil, err
+		}
+		lastSeq, lastHash, err = operator.VerifyAuditEntries(lastSeq, lastHash, page.Entries)
+		if err != nil {
+			return nil, err
+		}
+		if len(page.Entries) == auditPageLimit {
+			continue
+		}
+
+		// the entries of the last page end at its head
+		if page.Head.Seq != lastSeq || page.Head.Hash != lastHash {
+			return nil, fmt.Errorf("head not match! expected: %d %s, got: %d %s",
+				lastSeq, lastHash.Hex(), page.Head.Seq, page.Head.Hash.Hex())
+		}
+		if err = operator.VerifyAuditHead(&page.Head, pubkey); err != nil {
+			return nil, err
+		}
+		return &page.Head, nil
+	}
+}
+
 func checkReport(report attestation.Report, signer, uniqueID, pubkey []byte) error {
 	if !bytes.Equal(report.SignerID, signer) {
 		return fmt.Errorf("signer-id not match! expected: %x, got: %x", signer, report.SignerID)
@@ -0,0 +1,400 @@
+package operator
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/gcash/bchd/bchec"
+	log "github.com/sirupsen/logrus"
+	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
+
+	"github.com/smartbch/cc-operator/utils"
+)
+
+const (
+	AuditSigned   = "signed"   // Result is "ok"
+	AuditRejected = "rejected" // Result is the reason, logged again only if the reason changes
+	AuditReady    = "ready"
+	AuditServed   = "served" // the first time the signature is served, with the requester's IP
+	AuditVetoed   = "vetoed"
+	AuditRevoked  = "revoked"
+	AuditRestored = "restored" // listed again after being revoked
+
+	auditHeadPrefix = "cc-operator audit head:"
+)
+
+// AuditRecord is one signing decision
+type AuditRecord struct {
+	Time     int64                  `json:"time"`
+	Event    string                 `json:"event"`
+	SigHash  string                 `json:"sigHash"`
+	Flow     string                 `json:"flow,omitempty"`
+	Utxo     *sbchrpctypes.UtxoInfo `json:"utxo,omitempty"`
+	Result   string                 `json:"result,omitempty"`
+	RemoteIP string                 `json:"remoteIp,omitempty"`
+}
+
+// AuditEntry chains an AuditRecord to the previous entry,
+// Record is kept as it was encoded so that the hash does not depend on re-encoding
+type AuditEntry struct {
+	Seq      uint64          `json:"seq"` // starts from 1
+	Record   json.RawMessage `json:"record"`
+	PrevHash gethcmn.Hash    `json:"prevHash"`
+	Hash     gethcmn.Hash    `json:"hash"`
+}
+
+// AuditHead is the last entry of the audit log, signed by the operator key
+type AuditHead struct {
+	Seq  uint64        `json:"seq"`
+	Hash gethcmn.Hash  `json:"hash"`
+	Time int64         `json:"time"` // when it was signed
+	Sig  hexutil.Bytes `json:"sig"`  // DER encoded ECDSA signature of SigHash()
+}
+
+type AuditPage struct {
+	Head    AuditHead    `json:"head"`
+	Entries []AuditEntry `json:"entries"`
+}
+
+// hash = sha256(seq || prevHash || record)
+func (entry *AuditEntry) computeHash() gethcmn.Hash {
+	h := sha256.New()
+	_ = binary.Write(h, binary.BigEndian, entry.Seq)
+	h.Write(entry.PrevHash[:])
+	h.Write(entry.Record)
+	return gethcmn.BytesToHash(h.Sum(nil))
+}
+
+func (head *AuditHead) SigHash() []byte {
+	h := sha256.New()
+	h.Write([]byte(auditHeadPrefix))
+	_ = binary.Write(h, binary.BigEndian, head.Seq)
+	h.Write(head.Hash[:])
+	_ = binary.Write(h, binary.BigEndian, head.Time)
+	return h.Sum(nil)
+}
+
+// VerifyAuditHead checks the signature of head against the compressed pubkey of the operator
+func VerifyAuditHead(head *AuditHead, pubkey []byte) error {
+	pbk, err := bchec.ParsePubKey(pubkey, bchec.S256())
+	if err != nil {
+		return fmt.Errorf("invalid pubkey: %w", err)
+	}
+	sig, err := bchec.ParseDERSignature(head.Sig, bchec.S256())
+	if err != nil {
+		return fmt.Errorf("invalid head signature: %w", err)
+	}
+	if !sig.Verify(head.SigHash(), pbk) {
+		return errors.New("head signature not match")
+	}
+	return nil
+}
+
+// VerifyAuditEntries checks the entries follow the entry of prevSeq and prevHash (0 and zero hash at the beginning),
+// and returns the seq and hash of the last one
+func VerifyAuditEntries(prevSeq uint64, prevHash gethcmn.Hash, entries []AuditEntry) (uint64, gethcmn.Hash, error) {
+	for _, entry := range entries {
+		if entry.Seq != prevSeq+1 {
+			return prevSeq, prevHash, fmt.Errorf("seq not continuous: %d after %d", entry.Seq, prevSeq)
+		}
+		if entry.PrevHash != prevHash {
+			return prevSeq, prevHash, fmt.Errorf("prevHash not match at seq %d", entry.Seq)
+		}
+		if entry.computeHash() != entry.Hash {
+			return prevSeq, prevHash, fmt.Errorf("hash not match at seq %d", entry.Seq)
+		}
+		prevSeq, prevHash = entry.Seq, entry.Hash
+	}
+	return prevSeq, prevHash, nil
+}
+
+type auditIndex struct {
+	offset int64 // of the line in the file
+	time   int64 // of the record
+}
+
+// auditLog is an append-only file of hash-chained entries, one per line, sealed in SGX mode.
+// A nil auditLog logs nothing.
+type auditLog struct {
+	lock     sync.Mutex
+	file     *os.File
+	size     int64
+	index    []auditIndex // index[i] is of the entry with seq i+1
+	lastHash gethcmn.Hash
+	privKey  *bchec.PrivateKey // signs the head, may be nil in tests
+}
+
+func openAuditLog(path string, privKey *bchec.PrivateKey) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	al := &auditLog{file: file, privKey: privKey}
+	if err = al.load(); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("invalid audit log %s: %w", path, err)
+	}
+	log.Info("audit log:", path, ", entries:", len(al.index))
+	return al, nil
+}
+
+// load checks the whole chain and builds the index, an incomplete last line left by a crash is truncated
+func (al *auditLog) load() error {
+	reader := bufio.NewReader(al.file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				log.Warn("truncate incomplete audit entry at offset:", offset)
+				if err = al.file.Truncate(offset); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		entry, record, err := decodeAuditLine(line)
+		if err != nil {
+			return fmt.Errorf("seq %d: %w", len(al.index)+1, err)
+		}
+		if _, _, err = VerifyAuditEntries(uint64(len(al.index)), al.lastHash, []AuditEntry{*entry}); err != nil {
+			return err
+		}
+		al.index = append(al.index, auditIndex{offset: offset, time: record.Time})
+		al.lastHash = entry.Hash
+		offset += int64(len(line))
+	}
+	al.size = offset
+	return nil
+}
+
+func encodeAuditLine(entry *AuditEntry) ([]byte, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	if sgxMode {
+		sealed, err := sealData(data)
+		if err != nil {
+			return nil, err
+		}
+		data = []byte(base64.StdEncoding.EncodeToString(sealed))
+	}
+	return append(data, '\n'), nil
+}
+
+func decodeAuditLine(line []byte) (*AuditEntry, *AuditRecord, error) {
+	data := bytes.TrimSuffix(line, []byte{'\n'})
+	if sgxMode {
+		sealed, err := base64.StdEncoding.DecodeString(string(data))
+		if err != nil {
+			return nil, nil, err
+		}
+		if data, err = unsealData(sealed); err != nil {
+			return nil, nil, err
+		}
+	}
+	var entry AuditEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, nil, err
+	}
+	var record AuditRecord
+	if err := json.Unmarshal(entry.Record, &record); err != nil {
+		return nil, nil, err
+	}
+	return &entry, &record, nil
+}
+
+func (al *auditLog) append(record AuditRecord) {
+	if al == nil {
+		return
+	}
+	if err := al.tryAppend(record); err != nil {
+		log.Error("failed to append audit entry:", err.Error())
+	}
+}
+
+func (al *auditLog) tryAppend(record AuditRecord) error {
+	al.lock.Lock()
+	defer al.lock.Unlock()
+
+	record.Time = time.Now().Unix()
+	recordData, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	entry := &AuditEntry{Seq: uint64(len(al.index)) + 1, Record: recordData, PrevHash: al.lastHash}
+	entry.Hash = entry.computeHash()
+	line, err := encodeAuditLine(entry)
+	if err != nil {
+		return err
+	}
+	if _, err = al.file.WriteAt(line, al.size); err != nil {
+		return err
+	}
+	if err = al.file.Sync(); err != nil {
+		return err
+	}
+
+	al.index = append(al.index, auditIndex{offset: al.size, time: record.Time})
+	al.size += int64(len(line))
+	al.lastHash = entry.Hash
+	return nil
+}
+
+func (al *auditLog) head() AuditHead {
+	al.lock.Lock()
+	head := AuditHead{Seq: uint64(len(al.index)), Hash: al.lastHash, Time: time.Now().Unix()}
+	al.lock.Unlock()
+
+	if al.privKey != nil {
+		if sig, err := al.privKey.SignECDSA(head.SigHash()); err == nil {
+			head.Sig = sig.Serialize()
+		}
+	}
+	return head
+}
+
+// query returns the entries with fromSeq <= seq <= toSeq and fromTime <= time <= toTime,
+// toSeq and toTime are ignored if 0
+func (al *auditLog) query(fromSeq, toSeq uint64, fromTime, toTime int64, limit int) ([]AuditEntry, error) {
+	al.lock.Lock()
+	defer al.lock.Unlock()
+
+	n := uint64(len(al.index))
+	if toSeq == 0 || toSeq > n {
+		toSeq = n
+	}
+	if fromSeq == 0 {
+		fromSeq = 1
+	}
+	// the records are appended in time order
+	if i := uint64(sort.Search(len(al.index), func(i int) bool { return al.index[i].time >= fromTime })); i+1 > fromSeq {
+		fromSeq = i + 1
+	}
+	if toTime > 0 {
+		if i := uint64(sort.Search(len(al.index), func(i int) bool { return al.index[i].time > toTime })); i < toSeq {
+			toSeq = i
+		}
+	}
+
+	entries := make([]AuditEntry, 0)
+	for seq := fromSeq; seq <= toSeq && len(entries) < limit; seq++ {
+		end := al.size
+		if seq < n {
+			end = al.index[seq].offset
+		}
+		line := make([]byte, end-al.index[seq-1].offset)
+		if _, err := al.file.ReadAt(line, al.index[seq-1].offset); err != nil {
+			return nil, err
+		}
+		entry, _, err := decodeAuditLine(line)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, nil
+}
+
+func (al *auditLog) close() error {
+	if al == nil {
+		return nil
+	}
+	return al.file.Close()
+}
+
+func (signer *txSigner) auditUtxo(event, flow string, utxo *sbchrpctypes.UtxoInfo, result string) {
+	signer.audit.append(AuditRecord{
+		Event:   event,
+		SigHash: hex.EncodeToString(utxo.TxSigHash),
+		Flow:    flow,
+		Utxo:    utxo,
+		Result:  result,
+	})
+}
+
+func (signer *txSigner) auditSigHash(event, sigHashHex, flow string) {
+	signer.audit.append(AuditRecord{Event: event, SigHash: sigHashHex, Flow: flow})
+}
+
+// markServed audits the first time the signature of sigHashHex is served
+func (signer *txSigner) markServed(sigHashHex string, r *http.Request) {
+	if signer.audit == nil {
+		return
+	}
+	if record := signer.loadSigHashRecord(sigHashHex); record == nil || record.servedTime != 0 {
+		return
+	}
+	first := false
+	signer.updateSigHashRecord(sigHashHex, "", func(record *sigHashRecord) {
+		first = record.servedTime == 0
+		if first {
+			record.servedTime = time.Now().Unix()
+		}
+	})
+	if first {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		signer.audit.append(AuditRecord{Event: AuditServed, SigHash: sigHashHex, RemoteIP: ip})
+	}
+}
+
+// handleAudit returns a page of the audit log and its signed head,
+// optional query parameters: fromSeq, toSeq, fromTime, toTime (unix time), limit
+func (op *Operator) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if op.signer.audit == nil {
+		NewErrResp("audit log disabled").WriteTo(w)
+		return
+	}
+
+	params := map[string]int64{"fromSeq": 0, "toSeq": 0, "fromTime": 0, "toTime": 0, "limit": maxAuditPageLimit}
+	for _, name := range []string{"fromSeq", "toSeq", "fromTime", "toTime", "limit"} {
+		s := utils.GetQueryParam(r, name)
+		if s == "" {
+			continue
+		}
+		val, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || val < 0 || (name == "limit" && (val == 0 || val > maxAuditPageLimit)) {
+			NewErrResp("invalid query parameter: " + name).WriteTo(w)
+			return
+		}
+		params[name] = val
+	}
+
+	// the head is got first, so that it covers all the entries returned
+	head := op.signer.audit.head()
+	entries, err := op.signer.audit.query(uint64(params["fromSeq"]), uint64(params["toSeq"]),
+		params["fromTime"], params["toTime"], int(params["limit"]))
+	if err != nil {
+		NewErrResp(err.Error()).WriteTo(w)
+		return
+	}
+	if n := len(entries); n > 0 && entries[n-1].Seq > head.Seq {
+		entries = entries[:sort.Search(n, func(i int) bool { return entries[i].Seq > head.Seq })]
+	}
+	NewOkResp(AuditPage{Head: head, Entries: entries}).WriteTo(w)
+}
@@ -0,0 +1,118 @@
+package operator
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	"github.com/gcash/bchd/bchec"
+	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/cc-operator/utils"
+)
+
+func TestAuditLog(t *testing.T) {
+	key, err := bchec.NewPrivateKey(bchec.S256())
+	require.NoError(t, err)
+	auditFile := filepath.Join(t.TempDir(), "audit.log")
+	signer := newSigner(key, &sbchRpcClient{})
+	signer.audit, err = openAuditLog(auditFile, key)
+	require.NoError(t, err)
+	covenantAddr := gethcmn.Address{0xc1}
+	signer.membership.Store(&Membership{Status: MembershipElected, currCovenant: covenantAddr})
+
+	// UTXO 0x01 is signed and served, 0x02 is vetoed, 0x03 is rejected and vetoed
+	utxo1, utxo2 := newTestUtxo(0x01, covenantAddr), newTestUtxo(0x02, covenantAddr)
+	utxo3 := newTestUtxo(0x03, gethcmn.Address{0x02})
+	snapshot1 := &UtxosSnapshot{
+		RedeemingUtxos4Mo: []*sbchrpctypes.UtxoInfo{utxo1, utxo2, utxo3},
+		RedeemingUtxos4Op: []*sbchrpctypes.UtxoInfo{utxo1, utxo2, utxo3},
+	}
+	signer.handleUtxos(nil, snapshot1)
+	signer.handleUtxos(snapshot1, snapshot1)
+	require.NoError(t, signer.timeCache.Set("01", utils.GetTimestampFromTSC()-10))
+	snapshot2 := &UtxosSnapshot{
+		RedeemingUtxos4Mo: []*sbchrpctypes.UtxoInfo{utxo1},
+		RedeemingUtxos4Op: []*sbchrpctypes.UtxoInfo{utxo1},
+	}
+	signer.handleUtxos(snapshot1, snapshot2)
+
+	op := &Operator{signer: signer}
+	mux := op.createHttpHandlers()
+	require.Contains(t, callMuxHandler(mux, "/sig?hash=0x01"), `"success":true`)
+	require.Contains(t, callMuxHandler(mux, "/sig-status?hash=01"), `"status":"ready"`)
+
+	var page AuditPage
+	resp := callMuxHandler(mux, "/audit")
+	require.NoError(t, json.Unmarshal([]byte(resp), &Resp{Success: true, Result: &page}), resp)
+	var events []string
+	for _, entry := range page.Entries {
+		var record AuditRecord
+		require.NoError(t, json.Unmarshal(entry.Record, &record))
+		events = append(events, record.Event+":"+record.SigHash)
+		if record.Event == AuditServed {
+			require.Equal(t, "192.0.2.1", record.RemoteIP)
+		}
+		if record.Event == AuditSigned {
+			require.Equal(t, covenantAddr, record.Utxo.CovenantAddr)
+		}
+	}
+	require.Equal(t, []string{"signed:01", "signed:02", "rejected:03", "vetoed:02", "vetoed:03", "ready:01", "served:01"}, events)
+
+	lastSeq, lastHash, err := VerifyAuditEntries(0, gethcmn.Hash{}, page.Entries)
+	require.NoError(t, err)
+	require.Equal(t, page.Head.Seq, lastSeq)
+	require.Equal(t, page.Head.Hash, lastHash)
+	require.NoError(t, VerifyAuditHead(&page.Head, signer.pubkey))
+	otherKey, _ := bchec.NewPrivateKey(bchec.S256())
+	require.EqualError(t, VerifyAuditHead(&page.Head, otherKey.PubKey().SerializeCompressed()), "head signature not match")
+
+	// range queries
+	resp = callMuxHandler(mux, "/audit?fromSeq=2&toSeq=4&limit=2")
+	require.NoError(t, json.Unmarshal([]byte(resp), &Resp{Success: true, Result: &page}), resp)
+	require.Len(t, page.Entries, 2)
+	require.Equal(t, uint64(2), page.Entries[0].Seq)
+	_, _, err = VerifyAuditEntries(1, page.Entries[0].PrevHash, page.Entries)
+	require.NoError(t, err)
+	resp = callMuxHandler(mux, "/audit?fromTime=1")
+	require.Contains(t, resp, `"seq":7`)
+	require.Contains(t, callMuxHandler(mux, "/audit?toTime=1"), `"entries":[]`)
+	require.Equal(t, `{"success":false,"error":"invalid query parameter: limit"}`, callMuxHandler(mux, "/audit?limit=1001"))
+	require.Equal(t, `{"success":false,"error":"invalid query parameter: fromSeq"}`, callMuxHandler(mux, "/audit?fromSeq=x"))
+
+	// reopened, an incomplete last line is truncated
+	require.NoError(t, signer.audit.close())
+	file, err := os.OpenFile(auditFile, os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"seq":8,`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	al, err := openAuditLog(auditFile, key)
+	require.NoError(t, err)
+	head := al.head()
+	require.Equal(t, lastSeq, head.Seq)
+	require.Equal(t, lastHash, head.Hash)
+	al.append(AuditRecord{Event: AuditRevoked, SigHash: "01"})
+	entries, err := al.query(0, 0, 0, 0, maxAuditPageLimit)
+	require.NoError(t, err)
+	_, _, err = VerifyAuditEntries(0, gethcmn.Hash{}, entries)
+	require.NoError(t, err)
+	require.Len(t, entries, 8)
+	require.NoError(t, al.close())
+
+	// tampered
+	data, err := os.ReadFile(auditFile)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(auditFile, []byte(strings.Replace(string(data), `rejected`, `accepted`, 1)), 0600))
+	_, err = openAuditLog(auditFile, key)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "hash not match at seq 3")
+
+	// disabled
+	op.signer.audit = nil
+	require.Equal(t, `{"success":false,"error":"audit log disabled"}`, callMuxHandler(mux, "/audit"))
+}
@@ -0,0 +1,68 @@
+package operator
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/smartbch/cc-operator/sbch"
+	"github.com/smartbch/cc-operator/utils"
+)
+
+// disagreementLog keeps the last maxDisagreementReports reports of sbchd nodes disagreements
+type disagreementLog struct {
+	lock    sync.Mutex
+	reports []*sbch.Disagreement // oldest first
+}
+
+func (dl *disagreementLog) add(report *sbch.Disagreement) {
+	log.Warn("sbchd nodes disagree:", toJSON(report))
+
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+	dl.reports = append(dl.reports, report)
+	if n := len(dl.reports); n > maxDisagreementReports {
+		dl.reports = append([]*sbch.Disagreement{}, dl.reports[n-maxDisagreementReports:]...)
+	}
+}
+
+// query returns the matched reports, newest first
+func (dl *disagreementLog) query(method string, since int64, limit int) []*sbch.Disagreement {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	result := make([]*sbch.Disagreement, 0)
+	for i := len(dl.reports) - 1; i >= 0 && (limit <= 0 || len(result) < limit); i-- {
+		report := dl.reports[i]
+		if (method == "" || report.Method == method) && report.Time >= since {
+			result = append(result, report)
+		}
+	}
+	return result
+}
+
+// handleDisagreements serves the recent disagreement reports,
+// optional query parameters: method, since (unix time), limit
+func (op *Operator) handleDisagreements(w http.ResponseWriter, r *http.Request) {
+	var since int64
+	if s := utils.GetQueryParam(r, "since"); s != "" {
+		var err error
+		if since, err = strconv.ParseInt(s, 10, 64); err != nil {
+			NewErrResp("invalid query parameter: since").WriteTo(w)
+			return
+		}
+	}
+	var limit int
+	if s := utils.GetQueryParam(r, "limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil || limit < 0 {
+			NewErrResp("invalid query parameter: limit").WriteTo(w)
+			return
+		}
+	}
+
+	method := utils.GetQueryParam(r, "method")
+	NewOkResp(op.signer.sbchClient.disagreements.query(method, since, limit)).WriteTo(w)
+}
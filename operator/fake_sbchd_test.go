@@ -0,0 +1,354 @@
+package operator
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
+
+	"github.com/smartbch/cc-operator/sbch"
+)
+
+const (
+	fakeNodesGovAddr = "0x0000000000000000000000000000000000001234"
+	fakeChainID      = 10000
+	getNodeCountSel  = "39bf397e"
+	getNodeByIdxSel  = "1c53c280"
+)
+
+// fakeChain is the chain state shared by all fakeSbchd nodes
+type fakeChain struct {
+	lock            sync.RWMutex
+	chainID         uint64
+	genesisHash     gethcmn.Hash
+	latestBlockNum  uint64
+	latestBlockTime int64
+	nodes           []sbch.NodeInfo
+	monitors        []*sbchrpctypes.MonitorInfo
+	operators       []*sbchrpctypes.OperatorInfo
+	covenantAddr    string
+	oldOperators    []*sbchrpctypes.OperatorInfo
+	oldMonitors     []*sbchrpctypes.MonitorInfo
+	lastCovenant    string
+	utxos           map[string][]*sbchrpctypes.UtxoInfo // rpc method => utxos
+	logs            []*gethtypes.Log                    // NodesGov logs
+}
+
+func newFakeChain() *fakeChain {
+	return &fakeChain{
+		chainID:         fakeChainID,
+		genesisHash:     fakeGenesisHash,
+		latestBlockNum:  100,
+		latestBlockTime: time.Now().Unix(),
+		utxos:           map[string][]*sbchrpctypes.UtxoInfo{},
+	}
+}
+
+var fakeGenesisHash = gethcmn.Hash{0x01}
+
+func (chain *fakeChain) setLatestBlock(num uint64, blockTime time.Time) {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	chain.latestBlockNum = num
+	chain.latestBlockTime = blockTime.Unix()
+}
+
+// addNodesGovEvent emits a NodesGov event, e.g. NodeAdded(uint256), in a new block
+func (chain *fakeChain) addNodesGovEvent(event string, id uint64) {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	chain.latestBlockNum++
+	chain.logs = append(chain.logs, &gethtypes.Log{
+		Address: gethcmn.HexToAddress(fakeNodesGovAddr),
+		Topics: []gethcmn.Hash{
+			crypto.Keccak256Hash([]byte(event + "(uint256)")),
+			gethcmn.BigToHash(new(big.Int).SetUint64(id)),
+		},
+		Data:        []byte{},
+		BlockNumber: chain.latestBlockNum,
+		TxHash:      gethcmn.Hash{byte(len(chain.logs) + 1)},
+		BlockHash:   gethcmn.Hash{0x02},
+	})
+}
+
+func (chain *fakeChain) setNodes(nodes ...*fakeSbchd) {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	chain.nodes = make([]sbch.NodeInfo, len(nodes))
+	for i, node := range nodes {
+		chain.nodes[i] = node.nodeInfo(uint64(i + 1))
+	}
+}
+
+func (chain *fakeChain) setMonitors(addrs ...gethcmn.Address) {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	chain.monitors = make([]*sbchrpctypes.MonitorInfo, len(addrs))
+	for i, addr := range addrs {
+		chain.monitors[i] = &sbchrpctypes.MonitorInfo{Address: addr}
+	}
+}
+
+// setCovenant sets the operators and monitors by pubkeys, and the covenant address built from them
+func (chain *fakeChain) setCovenant(operatorPks, monitorPks [][]byte) {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	chain.operators = make([]*sbchrpctypes.OperatorInfo, len(operatorPks))
+	for i, pk := range operatorPks {
+		chain.operators[i] = &sbchrpctypes.OperatorInfo{Pubkey: pk}
+	}
+	chain.monitors = make([]*sbchrpctypes.MonitorInfo, len(monitorPks))
+	for i, pk := range monitorPks {
+		chain.monitors[i] = &sbchrpctypes.MonitorInfo{Address: gethcmn.Address{byte(i + 1)}, Pubkey: pk}
+	}
+	addr, _ := buildCovenantAddress(chain.operators, chain.monitors)
+	chain.covenantAddr = addr.String()
+}
+
+// migrateCovenant elects new operators and monitors, the current ones become the old ones
+func (chain *fakeChain) migrateCovenant(operatorPks, monitorPks [][]byte) {
+	chain.lock.Lock()
+	oldOperators, oldMonitors, lastCovenant := chain.operators, chain.monitors, chain.covenantAddr
+	chain.lock.Unlock()
+
+	chain.setCovenant(operatorPks, monitorPks)
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	chain.oldOperators, chain.oldMonitors, chain.lastCovenant = oldOperators, oldMonitors, lastCovenant
+}
+
+func (chain *fakeChain) setUtxos(method string, utxos ...*sbchrpctypes.UtxoInfo) {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	chain.utxos[method] = utxos
+}
+
+// fakeSbchd is a minimal sbchd JSON-RPC server which signs its responses like a real one
+type fakeSbchd struct {
+	chain  *fakeChain
+	key    *ecdsa.PrivateKey
+	server *httptest.Server
+}
+
+func newFakeSbchd(chain *fakeChain) *fakeSbchd {
+	key, _ := crypto.GenerateKey()
+	node := &fakeSbchd{chain: chain, key: key}
+	node.server = httptest.NewServer(http.HandlerFunc(node.handle))
+	return node
+}
+
+func (node *fakeSbchd) url() string {
+	return node.server.URL
+}
+
+func (node *fakeSbchd) close() {
+	node.server.Close()
+}
+
+func (node *fakeSbchd) nodeInfo(id uint64) sbch.NodeInfo {
+	return sbch.NodeInfo{
+		ID:      id,
+		PbkHash: sha256.Sum256(crypto.FromECDSAPub(&node.key.PublicKey)),
+		RpcUrl:  node.url(),
+		Intro:   "fake",
+	}
+}
+
+type fakeRpcReq struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type fakeRpcResp struct {
+	JsonRpc string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *fakeRpcErr     `json:"error,omitempty"`
+}
+
+type fakeRpcErr struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (node *fakeSbchd) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/json")
+
+	if bytes.HasPrefix(body, []byte("[")) {
+		var reqs []fakeRpcReq
+		if err := json.Unmarshal(body, &reqs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resps := make([]fakeRpcResp, len(reqs))
+		for i, req := range reqs {
+			resps[i] = node.response(req)
+		}
+		_ = json.NewEncoder(w).Encode(resps)
+		return
+	}
+
+	var req fakeRpcReq
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(node.response(req))
+}
+
+func (node *fakeSbchd) response(req fakeRpcReq) fakeRpcResp {
+	resp := fakeRpcResp{JsonRpc: "2.0", ID: req.ID}
+	result, err := node.call(req)
+	if err != nil {
+		resp.Error = &fakeRpcErr{Code: -32000, Message: err.Error()}
+	} else {
+		resp.Result = result
+	}
+	return resp
+}
+
+func (node *fakeSbchd) call(req fakeRpcReq) (any, error) {
+	node.chain.lock.RLock()
+	defer node.chain.lock.RUnlock()
+
+	switch req.Method {
+	case "sbch_getRpcPubkey":
+		return hex.EncodeToString(crypto.FromECDSAPub(&node.key.PublicKey)), nil
+	case "sbch_getCcInfo":
+		ccInfo := sbchrpctypes.CcInfo{
+			Operators:           node.chain.operators,
+			Monitors:            node.chain.monitors,
+			CurrCovenantAddress: node.chain.covenantAddr,
+			OldOperators:        node.chain.oldOperators,
+			OldMonitors:         node.chain.oldMonitors,
+			LastCovenantAddress: node.chain.lastCovenant,
+		}
+		bz, _ := json.Marshal(ccInfo)
+		ccInfo.Signature = node.sign(bz)
+		return ccInfo, nil
+	case "eth_call":
+		return node.ethCall(req)
+	case "eth_blockNumber":
+		return hexutil.Uint64(node.chain.latestBlockNum), nil
+	case "eth_chainId":
+		return hexutil.Uint64(node.chain.chainID), nil
+	case "eth_getBlockByNumber":
+		return node.getBlockByNumber(req)
+	case "eth_getLogs":
+		return node.getLogs(req)
+	default:
+		utxos, ok := node.chain.utxos[req.Method]
+		if !ok && !isUtxoMethod(req.Method) {
+			return nil, errors.New("unknown method: " + req.Method)
+		}
+		if utxos == nil {
+			utxos = []*sbchrpctypes.UtxoInfo{}
+		}
+		bz, _ := json.Marshal(utxos)
+		return sbchrpctypes.UtxoInfos{Infos: utxos, Signature: node.sign(bz)}, nil
+	}
+}
+
+func isUtxoMethod(method string) bool {
+	switch method {
+	case "sbch_getRedeemingUtxosForOperators", "sbch_getRedeemingUtxosForMonitors",
+		"sbch_getToBeConvertedUtxosForOperators", "sbch_getToBeConvertedUtxosForMonitors",
+		"sbch_getRedeemableUtxos", "sbch_getLostAndFoundUtxos":
+		return true
+	}
+	return false
+}
+
+func (node *fakeSbchd) ethCall(req fakeRpcReq) (any, error) {
+	var callArgs struct {
+		Data hexutil.Bytes `json:"data"`
+	}
+	if len(req.Params) == 0 {
+		return nil, errors.New("missing params")
+	}
+	if err := json.Unmarshal(req.Params[0], &callArgs); err != nil {
+		return nil, err
+	}
+	if len(callArgs.Data) < 4 {
+		return nil, errors.New("invalid call data")
+	}
+
+	switch hex.EncodeToString(callArgs.Data[:4]) {
+	case getNodeCountSel:
+		return hexutil.Bytes(uint256.NewInt(uint64(len(node.chain.nodes))).PaddedBytes(32)), nil
+	case getNodeByIdxSel:
+		idx := uint256.NewInt(0).SetBytes(callArgs.Data[4:]).Uint64()
+		if idx >= uint64(len(node.chain.nodes)) {
+			return nil, errors.New("invalid node index")
+		}
+		return hexutil.Bytes(encodeNodeInfo(node.chain.nodes[idx])), nil
+	default:
+		return nil, errors.New("unknown selector")
+	}
+}
+
+func (node *fakeSbchd) getBlockByNumber(req fakeRpcReq) (any, error) {
+	var blockNum string
+	if len(req.Params) == 0 || json.Unmarshal(req.Params[0], &blockNum) != nil {
+		return nil, errors.New("invalid params")
+	}
+	block := map[string]any{
+		"number":    hexutil.Uint64(node.chain.latestBlockNum),
+		"hash":      gethcmn.Hash{0x02},
+		"timestamp": hexutil.Uint64(node.chain.latestBlockTime),
+	}
+	if blockNum == "0x0" {
+		block["number"] = hexutil.Uint64(0)
+		block["hash"] = node.chain.genesisHash
+	}
+	return block, nil
+}
+
+func (node *fakeSbchd) getLogs(req fakeRpcReq) (any, error) {
+	var filter struct {
+		FromBlock hexutil.Uint64 `json:"fromBlock"`
+		ToBlock   hexutil.Uint64 `json:"toBlock"`
+	}
+	if len(req.Params) == 0 || json.Unmarshal(req.Params[0], &filter) != nil {
+		return nil, errors.New("invalid params")
+	}
+	logs := make([]*gethtypes.Log, 0)
+	for _, l := range node.chain.logs {
+		if l.BlockNumber >= uint64(filter.FromBlock) && l.BlockNumber <= uint64(filter.ToBlock) {
+			logs = append(logs, l)
+		}
+	}
+	return logs, nil
+}
+
+func encodeNodeInfo(node sbch.NodeInfo) []byte {
+	data := make([]byte, 32*4)
+	copy(data[:32], uint256.NewInt(node.ID).PaddedBytes(32))
+	copy(data[32:64], node.PbkHash[:])
+	copy(data[64:96], node.RpcUrl)
+	copy(data[96:], node.Intro)
+	return data
+}
+
+func (node *fakeSbchd) sign(msg []byte) hexutil.Bytes {
+	hash := sha256.Sum256(msg)
+	sig, _ := crypto.Sign(hash[:], node.key)
+	return sig[:64]
+}
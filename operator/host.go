@@ -0,0 +1,81 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// Host serves several operators under distinct path prefixes of one HTTPS listener.
+type Host struct {
+	server    *http.Server
+	ops       map[string]*Operator
+	lifecycle lifecycle
+}
+
+// NewHost creates a host which maps path prefix to operator,
+// the operators should not have their own listeners.
+func NewHost(serverName, listenAddr string, ops map[string]*Operator) (*Host, error) {
+	if len(ops) == 0 {
+		return nil, errors.New("no operators")
+	}
+	for prefix, op := range ops {
+		if op.server != nil {
+			return nil, errors.New("operator has its own listener: " + prefix)
+		}
+	}
+	return &Host{
+		server: newHttpsServer(serverName, listenAddr, ops),
+		ops:    ops,
+	}, nil
+}
+
+// Run runs all operators and the listener, and blocks until ctx is done,
+// Shutdown is called, the listener fails or one of the operators fails.
+func (host *Host) Run(ctx context.Context) error {
+	ctx, done, err := host.lifecycle.start(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(host.ops)+1)
+	wg := sync.WaitGroup{}
+	wg.Add(len(host.ops))
+	for _, op := range host.ops {
+		go func(op *Operator) {
+			defer wg.Done()
+			errs <- op.Run(ctx)
+			cancel()
+		}(op)
+	}
+
+	errs <- serveHttps(ctx, host.server)
+	cancel()
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown stops Run and waits for it to return or ctx to be done, then closes the operators.
+func (host *Host) Shutdown(ctx context.Context) error {
+	if err := host.lifecycle.shutdown(ctx); err != nil {
+		return err
+	}
+	var err error
+	for _, op := range host.ops {
+		if _err := op.Close(); _err != nil && err == nil {
+			err = _err
+		}
+	}
+	return err
+}
@@ -1,6 +1,7 @@
 package operator
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"encoding/hex"
 	"errors"
@@ -14,17 +15,21 @@ import (
 	"github.com/smartbch/cc-operator/utils"
 )
 
-func loadOrGenKey(signerKeyWIF string) (privKey *bchec.PrivateKey, pbkBytes []byte, err error) {
-	if signerKeyWIF != "" {
+func loadOrGenKey(ctx context.Context, keyFile, signerKeyWIF string,
+	backupParams KeyBackupParams) (privKey *bchec.PrivateKey, pbkBytes []byte, err error) {
+
+	if backupParams.recoveryMode() {
+		privKey, err = recoverAndSealPrivKey(ctx, keyFile, backupParams)
+	} else if signerKeyWIF != "" {
 		if integrationTestMode {
 			privKey, err = loadKeyFromWIF(signerKeyWIF)
 		} else {
 			err = errors.New("can not load private key from WIF, not in integration-test mode")
 		}
 	} else if sgxMode {
-		privKey, err = loadOrGenKeyInEnclave()
+		privKey, err = loadOrGenKeyInEnclave(keyFile, backupParams)
 	} else {
-		privKey, err = loadOrGenKeyNonEnclave()
+		privKey, err = loadOrGenKeyNonEnclave(keyFile, backupParams)
 	}
 
 	if err != nil {
@@ -47,7 +52,7 @@ func loadKeyFromWIF(wifStr string) (*bchec.PrivateKey, error) {
 }
 
 // only used for testing
-func loadOrGenKeyNonEnclave() (*bchec.PrivateKey, error) {
+func loadOrGenKeyNonEnclave(keyFile string, backupParams KeyBackupParams) (*bchec.PrivateKey, error) {
 	log.Info("load private key from file:", keyFile)
 	fileData, err := os.ReadFile(keyFile)
 	if err == nil {
@@ -56,6 +61,9 @@ func loadOrGenKeyNonEnclave() (*bchec.PrivateKey, error) {
 	}
 	if os.IsNotExist(err) {
 		privKey, err := genNewPrivKey()
+		if err == nil && backupParams.backupEnabled() {
+			err = backupPrivKeyToFile(keyFile, privKey, backupParams)
+		}
 		if err == nil {
 			err = os.WriteFile(keyFile, privKey.Serialize(), 0600)
 		}
@@ -64,14 +72,14 @@ func loadOrGenKeyNonEnclave() (*bchec.PrivateKey, error) {
 	return nil, err
 }
 
-func loadOrGenKeyInEnclave() (privKey *bchec.PrivateKey, err error) {
+func loadOrGenKeyInEnclave(keyFile string, backupParams KeyBackupParams) (privKey *bchec.PrivateKey, err error) {
 	log.Info("load sealed private key from file:", keyFile)
 	fileData, _err := os.ReadFile(keyFile)
 	if _err != nil {
 		log.Error("read file failed", _err.Error())
 		if os.IsNotExist(_err) {
 			// maybe it's first time to run this enclave app
-			privKey, err = genAndSealPrivKey()
+			privKey, err = genAndSealPrivKey(keyFile, backupParams)
 			if err != nil {
 				return
 			}
@@ -80,19 +88,27 @@ func loadOrGenKeyInEnclave() (privKey *bchec.PrivateKey, err error) {
 			return
 		}
 	} else {
-		privKey = unsealPrivKeyFromFile(fileData)
+		privKey, err = unsealPrivKeyFromFile(fileData)
 	}
 
 	return
 }
 
-func genAndSealPrivKey() (*bchec.PrivateKey, error) {
+func genAndSealPrivKey(keyFile string, backupParams KeyBackupParams) (*bchec.PrivateKey, error) {
 	privKey, err := genNewPrivKey()
 	if err != nil {
 		return nil, err
 	}
 
-	err = sealPrivKeyToFile(privKey)
+	// backup before sealing, so a failed backup does not leave a key without backup
+	if backupParams.backupEnabled() {
+		err = backupPrivKeyToFile(keyFile, privKey, backupParams)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = sealPrivKeyToFile(keyFile, privKey)
 	if err != nil {
 		return nil, err
 	}
@@ -111,7 +127,7 @@ func genNewPrivKey() (*bchec.PrivateKey, error) {
 	return privKey, nil
 }
 
-func sealPrivKeyToFile(privKey *bchec.PrivateKey) error {
+func sealPrivKeyToFile(keyFile string, privKey *bchec.PrivateKey) error {
 	log.Info("seal private key to file:", keyFile)
 	out, err := ecrypto.SealWithUniqueKey(privKey.Serialize(), nil)
 	if err != nil {
@@ -125,16 +141,16 @@ func sealPrivKeyToFile(privKey *bchec.PrivateKey) error {
 	return nil
 }
 
-func unsealPrivKeyFromFile(fileData []byte) *bchec.PrivateKey {
+func unsealPrivKeyFromFile(fileData []byte) (*bchec.PrivateKey, error) {
 	log.Info("unseal private key")
 	rawData, err := ecrypto.Unseal(fileData, nil)
 	if err != nil {
 		log.Error("unseal file data failed", err.Error())
-		return nil
+		return nil, err
 	}
 	privKey, _ := bchec.PrivKeyFromBytes(bchec.S256(), rawData)
 	log.Info("loaded key from file")
-	return privKey
+	return privKey, nil
 }
 
 //
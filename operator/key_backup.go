@@ -0,0 +1,206 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+	"github.com/gcash/bchd/bchec"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/smartbch/cc-operator/utils"
+)
+
+// KeyBackupParams configures the optional key backup.
+// RecoveryPubkeys and Threshold are used when a new key is generated.
+// RecoverPubkey restores the lost key of this pubkey: a recovery session is served at RecoveryListenAddr
+// until the recovery holders have submitted enough shares encrypted to its enclave key, see RecoverySessionInfo.
+type KeyBackupParams struct {
+	RecoveryPubkeys    []string
+	Threshold          int
+	RecoverPubkey      string
+	RecoveryListenAddr string // optional, default: 0.0.0.0:8802
+}
+
+type KeyBackup struct {
+	Pubkey    hexutil.Bytes       `json:"pubkey"`
+	Threshold int                 `json:"threshold"`
+	Shares    []EncryptedKeyShare `json:"shares"`
+}
+
+type EncryptedKeyShare struct {
+	RecoveryPubkey hexutil.Bytes `json:"recoveryPubkey"`
+	EncryptedShare hexutil.Bytes `json:"encryptedShare"`
+}
+
+func (params KeyBackupParams) backupEnabled() bool {
+	return len(params.RecoveryPubkeys) > 0
+}
+
+func (params KeyBackupParams) recoveryMode() bool {
+	return params.RecoverPubkey != ""
+}
+
+func newKeyBackup(privKey *bchec.PrivateKey, params KeyBackupParams) (*KeyBackup, error) {
+	recoveryPubkeys := make([]*ecdsa.PublicKey, len(params.RecoveryPubkeys))
+	for i, pbkHex := range params.RecoveryPubkeys {
+		pbk, err := parseRecoveryPubkey(pbkHex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recovery pubkey %s: %w", pbkHex, err)
+		}
+		recoveryPubkeys[i] = pbk
+	}
+
+	shares, err := utils.SplitSecret(&utils.RandReader{}, privKey.Serialize(),
+		len(recoveryPubkeys), params.Threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	backup := &KeyBackup{
+		Pubkey:    privKey.PubKey().SerializeCompressed(),
+		Threshold: params.Threshold,
+		Shares:    make([]EncryptedKeyShare, len(shares)),
+	}
+	for i, share := range shares {
+		encrypted, err := ecies.Encrypt(&utils.RandReader{},
+			ecies.ImportECDSAPublic(recoveryPubkeys[i]), share, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		backup.Shares[i] = EncryptedKeyShare{
+			RecoveryPubkey: crypto.CompressPubkey(recoveryPubkeys[i]),
+			EncryptedShare: encrypted,
+		}
+	}
+	return backup, nil
+}
+
+func parseRecoveryPubkey(pbkHex string) (*ecdsa.PublicKey, error) {
+	pbkBytes, err := hexutil.Decode(pbkHex)
+	if err != nil {
+		return nil, err
+	}
+	if len(pbkBytes) == 33 {
+		return crypto.DecompressPubkey(pbkBytes)
+	}
+	return crypto.UnmarshalPubkey(pbkBytes)
+}
+
+// DecryptKeyShare is used by recovery holders (outside of the enclave) to decrypt their shares.
+func DecryptKeyShare(share EncryptedKeyShare, recoveryKey *ecdsa.PrivateKey) ([]byte, error) {
+	if !bytes.Equal(share.RecoveryPubkey, crypto.CompressPubkey(&recoveryKey.PublicKey)) {
+		return nil, errors.New("recovery key not match")
+	}
+	return ecies.ImportECDSA(recoveryKey).Decrypt(share.EncryptedShare, nil, nil)
+}
+
+// recoverPrivKey combines the decrypted shares, the key must match both the backup and the expected pubkey
+func recoverPrivKey(backup *KeyBackup, shares [][]byte, expectedPubkey []byte) (*bchec.PrivateKey, error) {
+	if len(shares) < backup.Threshold {
+		return nil, fmt.Errorf("not enough shares: %d < %d", len(shares), backup.Threshold)
+	}
+	keyBytes, err := utils.CombineShares(shares)
+	if err != nil {
+		return nil, err
+	}
+	privKey, _ := bchec.PrivKeyFromBytes(bchec.S256(), keyBytes)
+	pbkBytes := privKey.PubKey().SerializeCompressed()
+	if !bytes.Equal(pbkBytes, backup.Pubkey) {
+		return nil, errors.New("recovered key does not match the backup pubkey")
+	}
+	if !bytes.Equal(pbkBytes, expectedPubkey) {
+		return nil, errors.New("recovered key does not match the expected pubkey")
+	}
+	return privKey, nil
+}
+
+// the backup of /data/key.txt is /data/key-backup.json
+func getKeyBackupFile(keyFile string) string {
+	return strings.TrimSuffix(keyFile, filepath.Ext(keyFile)) + "-backup.json"
+}
+
+func backupPrivKeyToFile(keyFile string, privKey *bchec.PrivateKey, params KeyBackupParams) error {
+	backupFile := getKeyBackupFile(keyFile)
+	log.Info("backup private key to file:", backupFile)
+	backup, err := newKeyBackup(privKey, params)
+	if err != nil {
+		return err
+	}
+	return writeKeyBackupFile(backupFile, backup)
+}
+
+func writeKeyBackupFile(backupFile string, backup *KeyBackup) error {
+	data, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(backupFile, data, 0600)
+}
+
+func readKeyBackupFile(backupFile string) (*KeyBackup, error) {
+	data, err := os.ReadFile(backupFile)
+	if err != nil {
+		return nil, err
+	}
+	var backup KeyBackup
+	err = json.Unmarshal(data, &backup)
+	return &backup, err
+}
+
+// recover the private key from the shares submitted to a recovery session, then seal it to keyFile
+func recoverAndSealPrivKey(ctx context.Context, keyFile string, params KeyBackupParams) (*bchec.PrivateKey, error) {
+	log.Info("recover private key from shares")
+	if !sgxMode && !integrationTestMode {
+		return nil, errors.New("can not recover private key, not in SGX mode")
+	}
+	if _, err := os.Stat(keyFile); err == nil {
+		return nil, errors.New("key file already exists: " + keyFile)
+	}
+	expectedPubkey, err := hexutil.Decode(params.RecoverPubkey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pubkey to recover: %w", err)
+	}
+
+	// the backup file is given by the host, so it is only trusted to match the expected pubkey
+	backup, err := readKeyBackupFile(getKeyBackupFile(keyFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key backup: %w", err)
+	}
+	if !bytes.Equal(backup.Pubkey, expectedPubkey) {
+		return nil, errors.New("backup pubkey does not match the expected pubkey")
+	}
+
+	session, err := newRecoverySession(backup, expectedPubkey)
+	if err != nil {
+		return nil, err
+	}
+	listenAddr := params.RecoveryListenAddr
+	if listenAddr == "" {
+		listenAddr = defaultRecoveryListenAddr
+	}
+	privKey, err := session.serve(ctx, listenAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if sgxMode {
+		err = sealPrivKeyToFile(keyFile, privKey)
+	} else {
+		err = os.WriteFile(keyFile, privKey.Serialize(), 0600)
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Info("recovered private key")
+	return privKey, nil
+}
@@ -0,0 +1,207 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/edgelesssys/ego/enclave"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+	"github.com/gcash/bchd/bchec"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/smartbch/cc-operator/utils"
+)
+
+// RecoverySessionInfo is served at /recovery-session by an operator in the recovery mode.
+// A recovery holder checks Report against the expected enclave and BackupPubkey against its backup file,
+// then submits its share encrypted to SessionPubkey with EncryptShareToSession.
+type RecoverySessionInfo struct {
+	SessionPubkey hexutil.Bytes `json:"sessionPubkey"` // generated in the enclave, never leaves it
+	Report        hexutil.Bytes `json:"report"`        // SGX report of sha256(SessionPubkey), empty in non-SGX mode
+	BackupPubkey  hexutil.Bytes `json:"backupPubkey"`  // the pubkey of the key to recover
+	Threshold     int           `json:"threshold"`
+	Received      int           `json:"received"`
+	Recovered     bool          `json:"recovered"`
+}
+
+// EncryptShareToSession encrypts a share decrypted by DecryptKeyShare to the session key,
+// so that the host of the operator can not read it
+func EncryptShareToSession(sessionPubkey []byte, recoveryPubkey []byte, share []byte) (*EncryptedKeyShare, error) {
+	pbk, err := crypto.UnmarshalPubkey(sessionPubkey)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := ecies.Encrypt(&utils.RandReader{}, ecies.ImportECDSAPublic(pbk), share, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedKeyShare{RecoveryPubkey: recoveryPubkey, EncryptedShare: encrypted}, nil
+}
+
+// recoverySession collects the shares encrypted to its ephemeral key until the key is recovered
+type recoverySession struct {
+	backup         *KeyBackup
+	expectedPubkey []byte
+	sessionKey     *ecies.PrivateKey
+	sessionPubkey  []byte
+	report         []byte
+
+	lock      sync.Mutex
+	shares    map[string][]byte // recovery pubkey => decrypted share
+	recovered chan *bchec.PrivateKey
+	privKey   *bchec.PrivateKey
+}
+
+func newRecoverySession(backup *KeyBackup, expectedPubkey []byte) (*recoverySession, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	session := &recoverySession{
+		backup:         backup,
+		expectedPubkey: expectedPubkey,
+		sessionKey:     ecies.ImportECDSA(key),
+		sessionPubkey:  crypto.FromECDSAPub(&key.PublicKey),
+		shares:         map[string][]byte{},
+		recovered:      make(chan *bchec.PrivateKey, 1),
+	}
+	if sgxMode {
+		hash := sha256.Sum256(session.sessionPubkey)
+		if session.report, err = enclave.GetRemoteReport(hash[:]); err != nil {
+			return nil, err
+		}
+	}
+	return session, nil
+}
+
+// serve serves the session over HTTPS until the key is recovered or ctx is done
+func (session *recoverySession) serve(ctx context.Context, listenAddr string) (*bchec.PrivateKey, error) {
+	_, _, tlsCfg := utils.CreateCertificate("cc-operator-recovery")
+	server := &http.Server{
+		Addr:         listenAddr,
+		Handler:      session.createHttpHandlers(),
+		ReadTimeout:  3 * time.Second,
+		WriteTimeout: 5 * time.Second,
+		TLSConfig:    tlsCfg,
+	}
+	log.Info("waiting for key shares at:", listenAddr, ", session pubkey:", hexutil.Encode(session.sessionPubkey))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- serveHttps(ctx, server)
+	}()
+
+	select {
+	case privKey := <-session.recovered:
+		cancel()
+		<-errCh
+		return privKey, nil
+	case err := <-errCh:
+		if err == nil {
+			err = ctx.Err()
+		}
+		return nil, err
+	}
+}
+
+func (session *recoverySession) createHttpHandlers() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/recovery-session", session.handleSession)
+	mux.HandleFunc("/recovery-share", session.handleShare) // POST
+	return mux
+}
+
+func (session *recoverySession) info() RecoverySessionInfo {
+	session.lock.Lock()
+	defer session.lock.Unlock()
+	return RecoverySessionInfo{
+		SessionPubkey: session.sessionPubkey,
+		Report:        session.report,
+		BackupPubkey:  session.backup.Pubkey,
+		Threshold:     session.backup.Threshold,
+		Received:      len(session.shares),
+		Recovered:     session.privKey != nil,
+	}
+}
+
+func (session *recoverySession) handleSession(w http.ResponseWriter, r *http.Request) {
+	NewOkResp(session.info()).WriteTo(w)
+}
+
+// handleShare accepts an EncryptedKeyShare encrypted to the session key
+func (session *recoverySession) handleShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		NewErrResp("POST required").WriteTo(w)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4096))
+	if err != nil {
+		NewErrResp(err.Error()).WriteTo(w)
+		return
+	}
+	var share EncryptedKeyShare
+	if err = json.Unmarshal(body, &share); err != nil {
+		NewErrResp("invalid share: " + err.Error()).WriteTo(w)
+		return
+	}
+	if err = session.addShare(share); err != nil {
+		NewErrResp(err.Error()).WriteTo(w)
+		return
+	}
+	NewOkResp(session.info()).WriteTo(w)
+}
+
+// addShare decrypts the share, and recovers the key once there are enough shares.
+// If the shares do not recover the expected key, all of them are dropped and must be submitted again.
+func (session *recoverySession) addShare(share EncryptedKeyShare) error {
+	session.lock.Lock()
+	defer session.lock.Unlock()
+
+	if session.privKey != nil {
+		return errors.New("already recovered")
+	}
+	if !session.isRecoveryHolder(share.RecoveryPubkey) {
+		return errors.New("not a recovery holder of the backup")
+	}
+	decrypted, err := session.sessionKey.Decrypt(share.EncryptedShare, nil, nil)
+	if err != nil {
+		return errors.New("can not decrypt share with the session key")
+	}
+	session.shares[string(share.RecoveryPubkey)] = decrypted
+	if len(session.shares) < session.backup.Threshold {
+		return nil
+	}
+
+	shares := make([][]byte, 0, len(session.shares))
+	for _, share := range session.shares {
+		shares = append(shares, share)
+	}
+	privKey, err := recoverPrivKey(session.backup, shares, session.expectedPubkey)
+	if err != nil {
+		session.shares = map[string][]byte{}
+		return err
+	}
+	session.privKey = privKey
+	session.recovered <- privKey
+	return nil
+}
+
+func (session *recoverySession) isRecoveryHolder(recoveryPubkey []byte) bool {
+	for _, share := range session.backup.Shares {
+		if bytes.Equal(share.RecoveryPubkey, recoveryPubkey) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,7 +1,114 @@
 package operator
 
-import "testing"
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
 
 func TestNewPrivKey(t *testing.T) {
 	_, _ = genNewPrivKey()
 }
+
+func TestKeyBackupAndRecover(t *testing.T) {
+	privKey, err := genNewPrivKey()
+	require.NoError(t, err)
+
+	var recoveryKeys []*ecdsa.PrivateKey
+	var recoveryPubkeys []string
+	for i := 0; i < 3; i++ {
+		key, _ := crypto.GenerateKey()
+		recoveryKeys = append(recoveryKeys, key)
+		recoveryPubkeys = append(recoveryPubkeys, hexutil.Encode(crypto.FromECDSAPub(&key.PublicKey)))
+	}
+
+	backup, err := newKeyBackup(privKey, KeyBackupParams{RecoveryPubkeys: recoveryPubkeys, Threshold: 2})
+	require.NoError(t, err)
+	require.Len(t, backup.Shares, 3)
+
+	_, err = DecryptKeyShare(backup.Shares[0], recoveryKeys[1])
+	require.Error(t, err)
+
+	share0, err := DecryptKeyShare(backup.Shares[0], recoveryKeys[0])
+	require.NoError(t, err)
+	share2, err := DecryptKeyShare(backup.Shares[2], recoveryKeys[2])
+	require.NoError(t, err)
+
+	pbkBytes := privKey.PubKey().SerializeCompressed()
+	_, err = recoverPrivKey(backup, [][]byte{share0}, pbkBytes)
+	require.EqualError(t, err, "not enough shares: 1 < 2")
+
+	recovered, err := recoverPrivKey(backup, [][]byte{share2, share0}, pbkBytes)
+	require.NoError(t, err)
+	require.Equal(t, privKey.Serialize(), recovered.Serialize())
+
+	// the backup file is from the host, the key must also match the pubkey given by the caller
+	otherKey, _ := genNewPrivKey()
+	_, err = recoverPrivKey(backup, [][]byte{share2, share0}, otherKey.PubKey().SerializeCompressed())
+	require.EqualError(t, err, "recovered key does not match the expected pubkey")
+
+	_, err = newKeyBackup(privKey, KeyBackupParams{RecoveryPubkeys: recoveryPubkeys, Threshold: 4})
+	require.Error(t, err)
+}
+
+func TestRecoverySession(t *testing.T) {
+	privKey, err := genNewPrivKey()
+	require.NoError(t, err)
+	var recoveryKeys []*ecdsa.PrivateKey
+	var recoveryPubkeys []string
+	for i := 0; i < 3; i++ {
+		key, _ := crypto.GenerateKey()
+		recoveryKeys = append(recoveryKeys, key)
+		recoveryPubkeys = append(recoveryPubkeys, hexutil.Encode(crypto.FromECDSAPub(&key.PublicKey)))
+	}
+	backup, err := newKeyBackup(privKey, KeyBackupParams{RecoveryPubkeys: recoveryPubkeys, Threshold: 2})
+	require.NoError(t, err)
+
+	session, err := newRecoverySession(backup, privKey.PubKey().SerializeCompressed())
+	require.NoError(t, err)
+	mux := session.createHttpHandlers()
+	var info RecoverySessionInfo
+	resp := callMuxHandler(mux, "/recovery-session")
+	require.NoError(t, json.Unmarshal([]byte(resp), &Resp{Success: true, Result: &info}), resp)
+	require.Equal(t, hexutil.Bytes(backup.Pubkey), info.BackupPubkey)
+	require.Equal(t, 2, info.Threshold)
+
+	submit := func(i int, sessionPubkey []byte) string {
+		share, err := DecryptKeyShare(backup.Shares[i], recoveryKeys[i])
+		require.NoError(t, err)
+		encrypted, err := EncryptShareToSession(sessionPubkey, backup.Shares[i].RecoveryPubkey, share)
+		require.NoError(t, err)
+		body, _ := json.Marshal(encrypted)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/recovery-share", bytes.NewReader(body)))
+		return w.Body.String()
+	}
+
+	// a share encrypted to another key is rejected
+	otherKey, _ := crypto.GenerateKey()
+	require.Equal(t, `{"success":false,"error":"can not decrypt share with the session key"}`,
+		submit(0, crypto.FromECDSAPub(&otherKey.PublicKey)))
+
+	require.Contains(t, submit(0, info.SessionPubkey), `"received":1,"recovered":false`)
+	require.Contains(t, submit(0, info.SessionPubkey), `"received":1,"recovered":false`) // submitted again
+	require.Contains(t, submit(2, info.SessionPubkey), `"received":2,"recovered":true`)
+	recovered := <-session.recovered
+	require.Equal(t, privKey.Serialize(), recovered.Serialize())
+	require.Equal(t, `{"success":false,"error":"already recovered"}`, submit(1, info.SessionPubkey))
+
+	// the shares do not recover the expected key
+	session, err = newRecoverySession(backup, otherKey.PublicKey.X.Bytes())
+	require.NoError(t, err)
+	mux = session.createHttpHandlers()
+	require.Contains(t, submit(0, session.sessionPubkey), `"received":1,`)
+	require.Equal(t, `{"success":false,"error":"recovered key does not match the expected pubkey"}`,
+		submit(1, session.sessionPubkey))
+	require.Contains(t, callMuxHandler(mux, "/recovery-session"), `"received":0,"recovered":false`)
+}
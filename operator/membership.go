@@ -0,0 +1,176 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/smartbch/smartbch/crosschain/covenant"
+	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
+)
+
+const (
+	MembershipUnknown          = "unknown" // CcInfo not read yet
+	MembershipElected          = "elected"
+	MembershipNotElected       = "not-elected"
+	MembershipCovenantMismatch = "covenant-mismatch"
+)
+
+// the flows in which this operator signs
+const (
+	flowRedeem  = "redeem"
+	flowConvert = "convert" // from the last covenant to the current one
+)
+
+// Membership is whether this operator is in the on-chain operator set,
+// and whether the covenant address on chain is built from the on-chain operators and monitors.
+// During a covenant migration, i.e. lastCovenantAddress is not zero and differs from the current one,
+// the same is reported for the last covenant, whose UTXOs are to be converted.
+// The operator only signs for the UTXOs on a covenant it is elected in.
+type Membership struct {
+	Status               string `json:"status"`
+	Reason               string `json:"reason,omitempty"`
+	CurrCovenantAddress  string `json:"currCovenantAddress,omitempty"`  // on chain
+	BuiltCovenantAddress string `json:"builtCovenantAddress,omitempty"` // rebuilt from the pubkeys
+	LastStatus           string `json:"lastStatus,omitempty"`
+	LastReason           string `json:"lastReason,omitempty"`
+	LastCovenantAddress  string `json:"lastCovenantAddress,omitempty"`
+	CheckedTime          int64  `json:"checkedTime,omitempty"`
+
+	currCovenant gethcmn.Address
+	lastCovenant gethcmn.Address
+}
+
+var unknownMembership = &Membership{Status: MembershipUnknown}
+
+func newMembership(ccInfo *sbchrpctypes.CcInfo, pubkey []byte) *Membership {
+	m := &Membership{
+		CurrCovenantAddress: ccInfo.CurrCovenantAddress,
+		CheckedTime:         time.Now().Unix(),
+	}
+
+	builtAddr, err := buildCovenantAddress(ccInfo.Operators, ccInfo.Monitors)
+	if err != nil {
+		m.Status = MembershipCovenantMismatch
+		m.Reason = "failed to build covenant address: " + err.Error()
+		return m
+	}
+	m.BuiltCovenantAddress = builtAddr.String()
+	if !gethcmn.IsHexAddress(ccInfo.CurrCovenantAddress) ||
+		gethcmn.HexToAddress(ccInfo.CurrCovenantAddress) != builtAddr {
+		m.Status = MembershipCovenantMismatch
+		m.Reason = "covenant address not match"
+		return m
+	}
+	m.currCovenant = builtAddr
+	m.Status = electedStatus(ccInfo.Operators, pubkey)
+
+	if gethcmn.IsHexAddress(ccInfo.LastCovenantAddress) {
+		lastAddr := gethcmn.HexToAddress(ccInfo.LastCovenantAddress)
+		if lastAddr != (gethcmn.Address{}) && lastAddr != m.currCovenant {
+			m.LastCovenantAddress = ccInfo.LastCovenantAddress
+			m.lastCovenant = lastAddr
+			m.LastStatus, m.LastReason = lastCovenantStatus(ccInfo, lastAddr, pubkey)
+		}
+	}
+	return m
+}
+
+// lastCovenantStatus finds the operators of the last covenant. Operators and monitors are elected
+// in different epochs, so the last covenant may be built from the old operators and the current monitors,
+// or the other way round.
+func lastCovenantStatus(ccInfo *sbchrpctypes.CcInfo, lastAddr gethcmn.Address, pubkey []byte) (string, string) {
+	for _, operators := range [][]*sbchrpctypes.OperatorInfo{ccInfo.OldOperators, ccInfo.Operators} {
+		for _, monitors := range [][]*sbchrpctypes.MonitorInfo{ccInfo.OldMonitors, ccInfo.Monitors} {
+			if addr, err := buildCovenantAddress(operators, monitors); err == nil && addr == lastAddr {
+				return electedStatus(operators, pubkey), ""
+			}
+		}
+	}
+	return MembershipCovenantMismatch, "last covenant address not built from the old or current pubkeys"
+}
+
+func electedStatus(operators []*sbchrpctypes.OperatorInfo, pubkey []byte) string {
+	for _, operator := range operators {
+		if bytes.Equal(operator.Pubkey, pubkey) {
+			return MembershipElected
+		}
+	}
+	return MembershipNotElected
+}
+
+// buildCovenantAddress returns the P2SH address (as 20 bytes) of the covenant
+// built from the ordered pubkeys of the operators and monitors
+func buildCovenantAddress(operators []*sbchrpctypes.OperatorInfo,
+	monitors []*sbchrpctypes.MonitorInfo) (addr gethcmn.Address, err error) {
+
+	operatorPks := make([][]byte, len(operators))
+	for i, operator := range operators {
+		operatorPks[i] = operator.Pubkey
+	}
+	monitorPks := make([][]byte, len(monitors))
+	for i, monitor := range monitors {
+		monitorPks[i] = monitor.Pubkey
+	}
+
+	ccCovenant, err := covenant.NewDefaultCcCovenant(operatorPks, monitorPks)
+	if err != nil {
+		return addr, err
+	}
+	return ccCovenant.GetP2SHAddress20()
+}
+
+// checkCovenant returns an error if this operator can not sign for the UTXOs on the covenant
+func (m *Membership) checkCovenant(addr gethcmn.Address) error {
+	switch {
+	case m.Status == MembershipUnknown || m.Status == MembershipCovenantMismatch:
+		return fmt.Errorf("can not sign, membership: %s", m.Status)
+	case addr == m.currCovenant:
+		if m.Status != MembershipElected {
+			return fmt.Errorf("can not sign, membership: %s", m.Status)
+		}
+	case m.LastStatus != "" && addr == m.lastCovenant:
+		if m.LastStatus != MembershipElected {
+			return fmt.Errorf("can not sign, last covenant membership: %s", m.LastStatus)
+		}
+	default:
+		return errors.New("not on the current or last covenant: " + addr.Hex())
+	}
+	return nil
+}
+
+// checkUtxo returns an error if this operator can not sign for the UTXO in the flow
+func (m *Membership) checkUtxo(flow string, utxo *sbchrpctypes.UtxoInfo) error {
+	if flow == flowConvert && (m.LastStatus == "" || utxo.CovenantAddr != m.lastCovenant) {
+		return errors.New("to be converted UTXO not on the last covenant: " + utxo.CovenantAddr.Hex())
+	}
+	return m.checkCovenant(utxo.CovenantAddr)
+}
+
+// checkMembership keeps the last membership if CcInfo can not be read
+func (signer *txSigner) checkMembership(ctx context.Context) {
+	snapshot, err := signer.sbchClient.getCcInfoSnapshot(ctx)
+	if err != nil {
+		log.Error("failed to get CcInfo:", err.Error())
+		return
+	}
+	signer.ccInfo.Store(snapshot)
+
+	m := newMembership(snapshot.CcInfo, signer.pubkey)
+	if last := signer.loadMembership(); last.Status != m.Status || last.LastStatus != m.LastStatus {
+		log.Warn("membership changed:", toJSON(m))
+	}
+	signer.membership.Store(m)
+}
+
+func (signer *txSigner) loadMembership() *Membership {
+	if m := signer.membership.Load(); m != nil {
+		return m
+	}
+	return unknownMembership
+}
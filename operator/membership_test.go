@@ -0,0 +1,185 @@
+package operator
+
+import (
+	"context"
+	"testing"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	"github.com/gcash/bchd/bchec"
+	"github.com/stretchr/testify/require"
+
+	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
+
+	"github.com/smartbch/cc-operator/sbch"
+	"github.com/smartbch/cc-operator/utils"
+)
+
+func genPubkeys(t *testing.T, n int) [][]byte {
+	pks := make([][]byte, n)
+	for i := range pks {
+		key, err := bchec.NewPrivateKey(bchec.S256())
+		require.NoError(t, err)
+		pks[i] = key.PubKey().SerializeCompressed()
+	}
+	return pks
+}
+
+func TestNewMembership(t *testing.T) {
+	operatorPks, monitorPks := genPubkeys(t, 10), genPubkeys(t, 3)
+	ccInfo := &sbchrpctypes.CcInfo{}
+	for _, pk := range operatorPks {
+		ccInfo.Operators = append(ccInfo.Operators, &sbchrpctypes.OperatorInfo{Pubkey: pk})
+	}
+	for _, pk := range monitorPks {
+		ccInfo.Monitors = append(ccInfo.Monitors, &sbchrpctypes.MonitorInfo{Pubkey: pk})
+	}
+	addr, err := buildCovenantAddress(ccInfo.Operators, ccInfo.Monitors)
+	require.NoError(t, err)
+	ccInfo.CurrCovenantAddress = addr.String()
+
+	m := newMembership(ccInfo, operatorPks[3])
+	require.Equal(t, MembershipElected, m.Status)
+	require.Equal(t, ccInfo.CurrCovenantAddress, m.BuiltCovenantAddress)
+	require.Equal(t, MembershipNotElected, newMembership(ccInfo, monitorPks[0]).Status)
+
+	// operators in another order
+	ccInfo.Operators[0], ccInfo.Operators[1] = ccInfo.Operators[1], ccInfo.Operators[0]
+	m = newMembership(ccInfo, operatorPks[3])
+	require.Equal(t, MembershipCovenantMismatch, m.Status)
+	require.Equal(t, "covenant address not match", m.Reason)
+	require.NotEqual(t, m.CurrCovenantAddress, m.BuiltCovenantAddress)
+
+	ccInfo.Operators = ccInfo.Operators[1:]
+	m = newMembership(ccInfo, operatorPks[3])
+	require.Equal(t, MembershipCovenantMismatch, m.Status)
+	require.Contains(t, m.Reason, "invalid operatorPks count")
+
+	ccInfo.Operators, ccInfo.Monitors = nil, nil
+	ccInfo.CurrCovenantAddress = gethcmn.Address{}.String()
+	require.Equal(t, MembershipCovenantMismatch, newMembership(ccInfo, operatorPks[3]).Status)
+}
+
+func newTestUtxo(txid byte, covenantAddr gethcmn.Address) *sbchrpctypes.UtxoInfo {
+	return &sbchrpctypes.UtxoInfo{Txid: gethcmn.Hash{txid}, CovenantAddr: covenantAddr, TxSigHash: []byte{txid}}
+}
+
+func TestSignerCheckMembership(t *testing.T) {
+	ctx := context.Background()
+	chain := newFakeChain()
+	node := newFakeSbchd(chain)
+	defer node.close()
+	chain.setNodes(node)
+
+	key, err := bchec.NewPrivateKey(bchec.S256())
+	require.NoError(t, err)
+	operatorPks, monitorPks := genPubkeys(t, 10), genPubkeys(t, 3)
+	operatorPks[9] = key.PubKey().SerializeCompressed()
+	chain.setCovenant(operatorPks, monitorPks)
+
+	client, err := newSbchClient(ctx, fakeNodesGovAddr, []string{node.url()}, nil, "",
+		sbch.ChainPolicy{}, sbch.EnclavePolicy{})
+	require.NoError(t, err)
+	signer := newSigner(key, client)
+	covenantAddr := gethcmn.HexToAddress(chain.covenantAddr)
+	signer.signUtxos4Op(flowRedeem, []*sbchrpctypes.UtxoInfo{newTestUtxo(0x01, covenantAddr)})
+	require.False(t, signer.sigCache.Has("01"))
+
+	signer.checkMembership(ctx)
+	require.Equal(t, MembershipElected, signer.loadMembership().Status)
+	require.Empty(t, signer.loadMembership().LastStatus)
+	signer.signUtxos4Op(flowRedeem, []*sbchrpctypes.UtxoInfo{
+		newTestUtxo(0x01, covenantAddr), newTestUtxo(0x02, gethcmn.Address{0x02})})
+	require.True(t, signer.sigCache.Has("01"))
+	require.False(t, signer.sigCache.Has("02")) // unknown covenant
+	signer.signUtxos4Op(flowConvert, []*sbchrpctypes.UtxoInfo{newTestUtxo(0x03, covenantAddr)})
+	require.False(t, signer.sigCache.Has("03")) // no migration
+
+	// replaced by another operator
+	chain.setCovenant(genPubkeys(t, 10), monitorPks)
+	signer.checkMembership(ctx)
+	require.Equal(t, MembershipNotElected, signer.loadMembership().Status)
+	signer.signUtxos4Op(flowRedeem, []*sbchrpctypes.UtxoInfo{
+		newTestUtxo(0x04, gethcmn.HexToAddress(chain.covenantAddr))})
+	require.False(t, signer.sigCache.Has("04"))
+
+	opInfo := &OpInfo{}
+	signer.fillMonitorsAndNodesInfo(opInfo)
+	require.Equal(t, MembershipNotElected, opInfo.Membership.Status)
+
+	// covenant address on chain is not built from the pubkeys
+	chain.setCovenant(operatorPks, monitorPks)
+	chain.lock.Lock()
+	chain.covenantAddr = gethcmn.Address{0x01}.String()
+	chain.lock.Unlock()
+	signer.checkMembership(ctx)
+	require.Equal(t, MembershipCovenantMismatch, signer.loadMembership().Status)
+	_, err = signer.getSig("01")
+	require.EqualError(t, err, "can not sign, membership: covenant-mismatch")
+}
+
+func TestSignerCovenantMigration(t *testing.T) {
+	ctx := context.Background()
+	chain := newFakeChain()
+	node := newFakeSbchd(chain)
+	defer node.close()
+	chain.setNodes(node)
+
+	key, err := bchec.NewPrivateKey(bchec.S256())
+	require.NoError(t, err)
+	operatorPks, monitorPks := genPubkeys(t, 10), genPubkeys(t, 3)
+	operatorPks[0] = key.PubKey().SerializeCompressed()
+	chain.setCovenant(operatorPks, monitorPks)
+	lastCovenant := gethcmn.HexToAddress(chain.covenantAddr)
+
+	// this operator is replaced, and monitors are not changed
+	chain.migrateCovenant(genPubkeys(t, 10), monitorPks)
+	chain.lock.Lock()
+	chain.oldMonitors = nil
+	chain.lock.Unlock()
+	currCovenant := gethcmn.HexToAddress(chain.covenantAddr)
+
+	client, err := newSbchClient(ctx, fakeNodesGovAddr, []string{node.url()}, nil, "",
+		sbch.ChainPolicy{}, sbch.EnclavePolicy{})
+	require.NoError(t, err)
+	signer := newSigner(key, client)
+	signer.checkMembership(ctx)
+	m := signer.loadMembership()
+	require.Equal(t, MembershipNotElected, m.Status)
+	require.Equal(t, MembershipElected, m.LastStatus)
+	require.Equal(t, lastCovenant.String(), m.LastCovenantAddress)
+
+	// only the UTXOs on the last covenant are signed
+	signer.signUtxos4Op(flowRedeem, []*sbchrpctypes.UtxoInfo{newTestUtxo(0x01, currCovenant)})
+	toBeConverted := []*sbchrpctypes.UtxoInfo{
+		newTestUtxo(0x02, lastCovenant), newTestUtxo(0x03, lastCovenant), newTestUtxo(0x04, currCovenant)}
+	signer.signUtxos4Op(flowConvert, toBeConverted)
+	require.False(t, signer.sigCache.Has("01"))
+	require.True(t, signer.sigCache.Has("02"))
+	require.True(t, signer.sigCache.Has("03"))
+	require.False(t, signer.sigCache.Has("04"))
+
+	// UTXO 0x02 has passed the publicity period
+	require.NoError(t, signer.timeCache.Set("02", utils.GetTimestampFromTSC()-10))
+	require.NoError(t, signer.timeCache.Set("03", utils.GetTimestampFromTSC()+1000))
+	signer.updateMigration(toBeConverted)
+	opInfo := &OpInfo{}
+	signer.fillMonitorsAndNodesInfo(opInfo)
+	require.Equal(t, 2, opInfo.Migration.Remaining)
+	require.Equal(t, 2, opInfo.Migration.Signed)
+	require.Equal(t, 1, opInfo.Migration.Waiting)
+	sig, err := signer.getSig("02")
+	require.NoError(t, err)
+	require.NotEmpty(t, sig)
+
+	// migration done
+	chain.setCovenant(genPubkeys(t, 10), monitorPks)
+	chain.lock.Lock()
+	chain.lastCovenant = chain.covenantAddr
+	chain.lock.Unlock()
+	signer.checkMembership(ctx)
+	require.Empty(t, signer.loadMembership().LastStatus)
+	signer.updateMigration(nil)
+	require.Nil(t, signer.migration.Load())
+	_, err = signer.getSig("02")
+	require.EqualError(t, err, "not on the current or last covenant: "+lastCovenant.Hex())
+}
@@ -0,0 +1,69 @@
+package operator
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/smartbch/cc-operator/sbch"
+)
+
+// handleMetrics serves the metrics in Prometheus text format
+func (op *Operator) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	writeMetricHeader(w, "cc_operator_suspended", "gauge", "1 if the operator is suspended by monitors")
+	writeMetric(w, "cc_operator_suspended", "", boolToFloat(op.isSuspended()))
+
+	var nodesHealth []sbch.NodeHealth
+	if clusterClient := op.signer.sbchClient.currClusterClient(); clusterClient != nil {
+		nodesHealth = clusterClient.NodesHealth()
+	}
+
+	writeMetricHeader(w, "cc_operator_sbchd_node_breaker_state", "gauge",
+		"circuit breaker state of sbchd node")
+	for _, h := range nodesHealth {
+		for _, state := range []string{sbch.BreakerClosed, sbch.BreakerOpen, sbch.BreakerHalfOpen} {
+			labels := fmt.Sprintf(`node=%s,state=%s`, strconv.Quote(h.RpcUrl), strconv.Quote(state))
+			writeMetric(w, "cc_operator_sbchd_node_breaker_state", labels, boolToFloat(h.State == state))
+		}
+	}
+
+	counters := []struct {
+		name  string
+		help  string
+		value func(h sbch.NodeHealth) uint64
+	}{
+		{"cc_operator_sbchd_node_calls_total", "calls sent to sbchd node",
+			func(h sbch.NodeHealth) uint64 { return h.TotalCalls }},
+		{"cc_operator_sbchd_node_failures_total", "failed calls of sbchd node",
+			func(h sbch.NodeHealth) uint64 { return h.TotalFailures }},
+		{"cc_operator_sbchd_node_retries_total", "retried calls of sbchd node",
+			func(h sbch.NodeHealth) uint64 { return h.TotalRetries }},
+	}
+	for _, counter := range counters {
+		writeMetricHeader(w, counter.name, "counter", counter.help)
+		for _, h := range nodesHealth {
+			writeMetric(w, counter.name, "node="+strconv.Quote(h.RpcUrl), float64(counter.value(h)))
+		}
+	}
+}
+
+func writeMetricHeader(w io.Writer, name, typ, help string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeMetric(w io.Writer, name, labels string, value float64) {
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+	_, _ = fmt.Fprintf(w, "%s %s\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,51 @@
+package operator
+
+import (
+	"encoding/hex"
+	"time"
+
+	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
+
+	"github.com/smartbch/cc-operator/utils"
+)
+
+// MigrationProgress is the progress of converting the UTXOs from the last covenant to the current one
+type MigrationProgress struct {
+	LastCovenantAddress string `json:"lastCovenantAddress"`
+	CurrCovenantAddress string `json:"currCovenantAddress"`
+	Remaining           int    `json:"remaining"` // UTXOs still on the last covenant
+	Signed              int    `json:"signed"`    // of the remaining, signed by this operator
+	Waiting             int    `json:"waiting"`   // of the remaining, still in the publicity period
+	UpdatedTime         int64  `json:"updatedTime"`
+}
+
+// updateMigration counts the to be converted UTXOs, it is cleared when no migration is in progress
+func (signer *txSigner) updateMigration(toBeConvertedUtxos []*sbchrpctypes.UtxoInfo) {
+	m := signer.loadMembership()
+	if m.LastStatus == "" {
+		signer.migration.Store(nil)
+		return
+	}
+
+	progress := &MigrationProgress{
+		LastCovenantAddress: m.LastCovenantAddress,
+		CurrCovenantAddress: m.CurrCovenantAddress,
+		UpdatedTime:         time.Now().Unix(),
+	}
+	now := utils.GetTimestampFromTSC()
+	for _, utxo := range toBeConvertedUtxos {
+		if utxo.CovenantAddr != m.lastCovenant {
+			continue
+		}
+		progress.Remaining++
+		sigHashHex := hex.EncodeToString(utxo.TxSigHash)
+		if signer.sigCache.Has(sigHashHex) {
+			progress.Signed++
+		}
+		val, err := signer.timeCache.Get(sigHashHex)
+		if okTs, ok := val.(uint64); err != nil || !ok || okTs > now {
+			progress.Waiting++
+		}
+	}
+	signer.migration.Store(progress)
+}
@@ -0,0 +1,157 @@
+package operator
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+
+	"github.com/smartbch/cc-operator/sbch"
+	"github.com/smartbch/cc-operator/utils"
+)
+
+const (
+	NodeAdded   = "added"
+	NodeRemoved = "removed"
+	NodeUpdated = "updated"
+)
+
+// the NodesGov event name => the change it records
+var nodesGovEventChanges = map[string]string{
+	"NodeAdded":   NodeAdded,
+	"NodeRemoved": NodeRemoved,
+	"NodeUpdated": NodeUpdated,
+}
+
+// NodeChange is a change of the NodesGov node list found by the operator,
+// either from a NodesGov event, or by the full scan if the event was missed
+type NodeChange struct {
+	Change   string         `json:"change"`
+	NodeID   uint64         `json:"nodeId"`
+	Node     *sbch.NodeInfo `json:"node,omitempty"`     // found by the full scan, the old one if removed
+	BlockNum uint64         `json:"blockNum,omitempty"` // of the event
+	TxHash   *gethcmn.Hash  `json:"txHash,omitempty"`   // of the event
+	Time     int64          `json:"time"`               // when the change was found
+}
+
+// diffNodes returns the changes from oldNodes to newNodes by node ID
+func diffNodes(oldNodes, newNodes []sbch.NodeInfo) []NodeChange {
+	now := time.Now().Unix()
+	oldMap := make(map[uint64]sbch.NodeInfo, len(oldNodes))
+	for _, node := range oldNodes {
+		oldMap[node.ID] = node
+	}
+	var changes []NodeChange
+	for i, node := range newNodes {
+		oldNode, ok := oldMap[node.ID]
+		if !ok {
+			changes = append(changes, NodeChange{Change: NodeAdded, NodeID: node.ID, Node: &newNodes[i], Time: now})
+		} else if oldNode != node {
+			changes = append(changes, NodeChange{Change: NodeUpdated, NodeID: node.ID, Node: &newNodes[i], Time: now})
+		}
+		delete(oldMap, node.ID)
+	}
+	for i, node := range oldNodes {
+		if _, ok := oldMap[node.ID]; ok {
+			changes = append(changes, NodeChange{Change: NodeRemoved, NodeID: node.ID, Node: &oldNodes[i], Time: now})
+		}
+	}
+	return changes
+}
+
+// nodesHistory keeps the last maxNodesHistory node changes
+type nodesHistory struct {
+	lock     sync.Mutex
+	changes  []NodeChange    // oldest first
+	nodes    []sbch.NodeInfo // the node list of the last full scan
+	eventIDs map[uint64]bool // the nodes with events since the last full scan
+}
+
+// init sets the node list which the first full scan is compared with
+func (nh *nodesHistory) init(nodes []sbch.NodeInfo) {
+	nh.lock.Lock()
+	defer nh.lock.Unlock()
+	nh.nodes = nodes
+}
+
+// addEvents records the NodesGov events
+func (nh *nodesHistory) addEvents(events []sbch.NodesGovEvent) {
+	nh.lock.Lock()
+	defer nh.lock.Unlock()
+
+	now := time.Now().Unix()
+	if nh.eventIDs == nil {
+		nh.eventIDs = map[uint64]bool{}
+	}
+	for i, event := range events {
+		nh.eventIDs[event.NodeID] = true
+		nh.append(NodeChange{
+			Change:   nodesGovEventChanges[event.Event],
+			NodeID:   event.NodeID,
+			BlockNum: event.BlockNum,
+			TxHash:   &events[i].TxHash,
+			Time:     now,
+		})
+	}
+}
+
+// addScan records the changes from the node list of the last full scan,
+// except for the nodes already recorded by events
+func (nh *nodesHistory) addScan(nodes []sbch.NodeInfo) {
+	nh.lock.Lock()
+	defer nh.lock.Unlock()
+
+	for _, change := range diffNodes(nh.nodes, nodes) {
+		if !nh.eventIDs[change.NodeID] {
+			nh.append(change)
+		}
+	}
+	nh.nodes = nodes
+	nh.eventIDs = nil
+}
+
+func (nh *nodesHistory) append(changes ...NodeChange) {
+	nh.changes = append(nh.changes, changes...)
+	if n := len(nh.changes); n > maxNodesHistory {
+		nh.changes = append([]NodeChange{}, nh.changes[n-maxNodesHistory:]...)
+	}
+}
+
+// query returns the changes found since the unix time, newest first
+func (nh *nodesHistory) query(since int64, limit int) []NodeChange {
+	nh.lock.Lock()
+	defer nh.lock.Unlock()
+
+	result := make([]NodeChange, 0)
+	for i := len(nh.changes) - 1; i >= 0 && (limit <= 0 || len(result) < limit); i-- {
+		if nh.changes[i].Time >= since {
+			result = append(result, nh.changes[i])
+		}
+	}
+	return result
+}
+
+// handleNodesHistory serves the recent node changes,
+// optional query parameters: since (unix time), limit
+func (op *Operator) handleNodesHistory(w http.ResponseWriter, r *http.Request) {
+	var since int64
+	if s := utils.GetQueryParam(r, "since"); s != "" {
+		var err error
+		if since, err = strconv.ParseInt(s, 10, 64); err != nil {
+			NewErrResp("invalid query parameter: since").WriteTo(w)
+			return
+		}
+	}
+	var limit int
+	if s := utils.GetQueryParam(r, "limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil || limit < 0 {
+			NewErrResp("invalid query parameter: limit").WriteTo(w)
+			return
+		}
+	}
+
+	NewOkResp(op.signer.sbchClient.nodesHistory.query(since, limit)).WriteTo(w)
+}
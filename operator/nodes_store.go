@@ -0,0 +1,110 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/smartbch/cc-operator/sbch"
+)
+
+// persistedNodes is the last verified node set, sealed to nodesFile
+// so the operator does not depend on bootstrap nodes after restarts
+type persistedNodes struct {
+	NodesGovAddr     gethcmn.Address `json:"nodesGovAddr"`
+	CurrNodes        []sbch.NodeInfo `json:"currNodes"`
+	CurrNodesTime    int64           `json:"currNodesTime"` // when currNodes became active
+	NewNodes         []sbch.NodeInfo `json:"newNodes,omitempty"`
+	NodesChangedTime int64           `json:"nodesChangedTime,omitempty"`
+	LastEventBlock   uint64          `json:"lastEventBlock,omitempty"` // NodesGov events are processed up to it
+}
+
+func (client *sbchRpcClient) saveNodes() {
+	if client.nodesFile == "" {
+		return
+	}
+
+	state := client.loadState()
+	if state.currClusterClient == nil {
+		return
+	}
+	nodes := persistedNodes{
+		NodesGovAddr:   gethcmn.HexToAddress(client.nodesGovAddr),
+		CurrNodes:      state.currClusterClient.PublicNodes,
+		CurrNodesTime:  state.currNodesTime.Unix(),
+		LastEventBlock: state.lastEventBlock,
+	}
+	if state.newClusterClient != nil {
+		nodes.NewNodes = state.newClusterClient.PublicNodes
+		nodes.NodesChangedTime = state.nodesChangedTime.Unix()
+	}
+
+	data, _ := json.Marshal(nodes)
+	if err := writeSealedFile(client.nodesFile, data); err != nil {
+		log.Error("failed to save nodes:", err.Error())
+	}
+}
+
+// restoreNodes rebuilds the curr and pending cluster clients from nodesFile
+func (client *sbchRpcClient) restoreNodes(ctx context.Context) (*nodesState, error) {
+	if client.nodesFile == "" {
+		return nil, errors.New("no nodes file")
+	}
+	data, err := readSealedFile(client.nodesFile)
+	if err != nil {
+		return nil, err
+	}
+	var nodes persistedNodes
+	if err = json.Unmarshal(data, &nodes); err != nil {
+		return nil, err
+	}
+	if nodes.NodesGovAddr != gethcmn.HexToAddress(client.nodesGovAddr) {
+		return nil, errors.New("nodesGovAddr not match")
+	}
+	log.Info("restore nodes:", toJSON(nodes))
+
+	currClusterClient, err := client.dialCluster(ctx, nodes.CurrNodes, client.privateUrls)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clusterClient: %w", err)
+	}
+
+	state := &nodesState{
+		currClusterClient: currClusterClient,
+		currNodesTime:     time.Unix(nodes.CurrNodesTime, 0),
+		lastEventBlock:    nodes.LastEventBlock,
+		allMonitorMap:     map[gethcmn.Address]bool{},
+	}
+	if len(nodes.NewNodes) > 0 {
+		newClusterClient, err := client.dialCluster(ctx, nodes.NewNodes, client.privateUrls)
+		if err != nil {
+			// the new nodes will be checked again by watchSbchdNodes
+			log.Error("failed to restore new nodes:", err.Error())
+		} else {
+			state.newClusterClient = newClusterClient
+			state.nodesChangedTime = time.Unix(nodes.NodesChangedTime, 0)
+		}
+	}
+	return state, nil
+}
+
+// crossCheckBootstrapNodes only logs the differences, bootstrap nodes may be down or stale
+func (client *sbchRpcClient) crossCheckBootstrapNodes(ctx context.Context, bootstrapRpcURLs []string, state *nodesState) {
+	bootNodes, err := client.getBootNodes(ctx, bootstrapRpcURLs)
+	if err != nil {
+		log.Warn("failed to cross-check bootstrap nodes:", err.Error())
+		return
+	}
+
+	knownNodes := state.currClusterClient.PublicNodes
+	if state.newClusterClient != nil {
+		knownNodes = state.newClusterClient.PublicNodes
+	}
+	if !nodesEqual(bootNodes, knownNodes) {
+		log.Warn("bootstrap nodes differ from restored nodes, bootNodes:", toJSON(bootNodes))
+	}
+}
@@ -0,0 +1,281 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/smartbch/cc-operator/sbch"
+)
+
+// Config of an operator. KeyFile, NodesFile and AuditFile can not be shared by the operators
+// of a process, so their defaults are only for the single operator of a process.
+type Config struct {
+	ServerName       string // server name to generate TLS certificate
+	ListenAddr       string // optional, if empty the operator is only served through a Host or Handler()
+	NodesGovAddr     string
+	KeyFile          string // optional, default: /data/key.txt
+	NodesFile        string // optional, default: /data/nodes.txt
+	AuditFile        string // optional, default: /data/audit.log
+	SignerKeyWIF     string // integration test only
+	BootstrapRpcURLs []string
+	PrivateRpcURLs   []string
+	ChainPolicy      sbch.ChainPolicy   // optional, the sbchd nodes are checked against it
+	EnclavePolicy    sbch.EnclavePolicy // optional, the public sbchd nodes must be attested by it
+	KeyBackup        KeyBackupParams
+	// optional, default: 5 minutes. The signatures are not served anymore
+	// if their sigHashes are not listed for operators for this period
+	SigRevokeGracePeriod time.Duration
+	WithChaos            bool // integration test only
+}
+
+// Operator holds one operator identity: its key, signer, sbchd nodes and suspend state.
+// Several operators can be hosted in one process, see Host.
+type Operator struct {
+	pubKeyBytes []byte
+	certBytes   []byte
+	suspended   atomic.Value
+	withChaos   bool
+	signer      *txSigner
+	server      *http.Server // nil if ListenAddr is empty
+	files       []string     // claimed by this operator until it is closed
+	lifecycle   lifecycle
+}
+
+func NewOperator(ctx context.Context, cfg Config) (*Operator, error) {
+	if cfg.KeyFile == "" {
+		cfg.KeyFile = defaultKeyFile
+	}
+	if cfg.NodesFile == "" {
+		cfg.NodesFile = defaultNodesFile
+	}
+	if cfg.AuditFile == "" {
+		cfg.AuditFile = defaultAuditFile
+	}
+	files := []string{cfg.KeyFile, cfg.NodesFile, cfg.AuditFile}
+	if err := claimFiles(files...); err != nil {
+		return nil, err
+	}
+
+	op, err := newOperator(ctx, cfg)
+	if err != nil {
+		releaseFiles(files...)
+		return nil, err
+	}
+	op.files = files
+	return op, nil
+}
+
+func newOperator(ctx context.Context, cfg Config) (*Operator, error) {
+	privKey, pbkBytes, err := loadOrGenKey(ctx, cfg.KeyFile, cfg.SignerKeyWIF, cfg.KeyBackup)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key: %w", err)
+	}
+
+	sbchClient, err := newSbchClient(ctx, cfg.NodesGovAddr, cfg.BootstrapRpcURLs, cfg.PrivateRpcURLs,
+		cfg.NodesFile, cfg.ChainPolicy, cfg.EnclavePolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	op := &Operator{
+		pubKeyBytes: pbkBytes,
+		withChaos:   cfg.WithChaos,
+		signer:      newSigner(privKey, sbchClient),
+	}
+	if cfg.SigRevokeGracePeriod > 0 {
+		op.signer.revokeGracePeriod = cfg.SigRevokeGracePeriod
+	}
+	if op.signer.audit, err = openAuditLog(cfg.AuditFile, privKey); err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if cfg.ListenAddr != "" {
+		op.server = newHttpsServer(cfg.ServerName, cfg.ListenAddr, map[string]*Operator{"": op})
+	}
+	return op, nil
+}
+
+// claimedFiles are the files used by the operators created in this process
+var (
+	claimedFilesLock sync.Mutex
+	claimedFiles     = map[string]bool{}
+)
+
+// claimFiles fails if any of the files is used by another operator of this process,
+// the files are claimed until the operator is closed
+func claimFiles(files ...string) error {
+	claimedFilesLock.Lock()
+	defer claimedFilesLock.Unlock()
+
+	seen := map[string]bool{}
+	for _, file := range files {
+		file = filepath.Clean(file)
+		if claimedFiles[file] || seen[file] {
+			return errors.New("file used by another operator: " + file)
+		}
+		seen[file] = true
+	}
+	for file := range seen {
+		claimedFiles[file] = true
+	}
+	return nil
+}
+
+func releaseFiles(files ...string) {
+	claimedFilesLock.Lock()
+	defer claimedFilesLock.Unlock()
+	for _, file := range files {
+		delete(claimedFiles, filepath.Clean(file))
+	}
+}
+
+func (op *Operator) PubKey() []byte {
+	return op.pubKeyBytes
+}
+
+// Handler returns the HTTP handlers of this operator, so it can be embedded in other services.
+func (op *Operator) Handler() http.Handler {
+	return op.createHttpHandlers()
+}
+
+func (op *Operator) isSuspended() bool {
+	suspended, _ := op.suspended.Load().(bool)
+	return suspended
+}
+
+// Run starts the background tasks and the HTTPS listener (if any),
+// and blocks until ctx is done, Shutdown is called or the listener fails.
+func (op *Operator) Run(ctx context.Context) error {
+	ctx, done, err := op.lifecycle.start(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wg := sync.WaitGroup{}
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		op.signer.sbchClient.watchMonitorsAndSbchdNodes(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		op.signer.getAndSignSigHashes(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		op.signer.watchInfoUtxos(ctx)
+	}()
+
+	if op.server != nil {
+		err = serveHttps(ctx, op.server)
+	} else {
+		<-ctx.Done()
+	}
+
+	cancel() // stop the background tasks if the listener failed
+	wg.Wait()
+	return err
+}
+
+// Shutdown stops Run and waits for it to return or ctx to be done, then closes the operator.
+func (op *Operator) Shutdown(ctx context.Context) error {
+	if err := op.lifecycle.shutdown(ctx); err != nil {
+		return err
+	}
+	return op.Close()
+}
+
+// Close closes the audit log and releases the files of the operator, so that a new operator can use them.
+// It fails if the operator is running, and a closed operator can not be run again.
+func (op *Operator) Close() error {
+	closed, err := op.lifecycle.close()
+	if err != nil || closed {
+		return err
+	}
+	err = op.signer.audit.close()
+	releaseFiles(op.files...)
+	return err
+}
+
+// lifecycle lets Run and Shutdown be called from different goroutines
+type lifecycle struct {
+	lock    sync.Mutex
+	running bool
+	closed  bool
+	stopFn  context.CancelFunc
+	stopped chan struct{}
+}
+
+// start returns the context of the run and the function to call when the run is done
+func (l *lifecycle) start(ctx context.Context) (context.Context, func(), error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.running {
+		return nil, nil, errors.New("already running")
+	}
+	if l.closed {
+		return nil, nil, errors.New("closed")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	l.running = true
+	l.stopFn = cancel
+	l.stopped = stopped
+
+	once := sync.Once{}
+	done := func() {
+		cancel()
+		once.Do(func() {
+			l.lock.Lock()
+			l.running = false
+			close(stopped)
+			l.lock.Unlock()
+		})
+	}
+	return ctx, done, nil
+}
+
+func (l *lifecycle) isRunning() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.running
+}
+
+// close marks it closed if it is not running, and returns if it was closed before
+func (l *lifecycle) close() (bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.running {
+		return false, errors.New("still running")
+	}
+	closed := l.closed
+	l.closed = true
+	return closed, nil
+}
+
+func (l *lifecycle) shutdown(ctx context.Context) error {
+	l.lock.Lock()
+	if !l.running {
+		l.lock.Unlock()
+		return nil
+	}
+	stopFn, stopped := l.stopFn, l.stopped
+	l.lock.Unlock()
+
+	stopFn()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,98 @@
+package operator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunAndShutdown(t *testing.T) {
+	op := &Operator{signer: newSigner(nil, &sbchRpcClient{})}
+	op.server = newHttpsServer("cc-operator", "127.0.0.1:0", map[string]*Operator{"": op})
+
+	runErr := make(chan error)
+	go func() { runErr <- op.Run(context.Background()) }()
+	require.Eventually(t, op.lifecycle.isRunning, 5*time.Second, time.Millisecond)
+	require.EqualError(t, op.Run(context.Background()), "already running")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, op.Shutdown(ctx))
+	require.NoError(t, <-runErr)
+	require.NoError(t, op.Shutdown(ctx))
+}
+
+func TestHostRunAndCancel(t *testing.T) {
+	op1 := &Operator{signer: newSigner(nil, &sbchRpcClient{})}
+	op2 := &Operator{signer: newSigner(nil, &sbchRpcClient{})}
+	host, err := NewHost("cc-operator", "127.0.0.1:0", map[string]*Operator{"a": op1, "b": op2})
+	require.NoError(t, err)
+	require.Equal(t, op1.certBytes, op2.certBytes)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error)
+	go func() { runErr <- host.Run(ctx) }()
+	require.Eventually(t, host.lifecycle.isRunning, 5*time.Second, time.Millisecond)
+	cancel()
+	require.NoError(t, <-runErr)
+
+	op3 := &Operator{signer: newSigner(nil, &sbchRpcClient{})}
+	op3.server = newHttpsServer("cc-operator", "127.0.0.1:0", map[string]*Operator{"": op3})
+	_, err = NewHost("cc-operator", "127.0.0.1:0", map[string]*Operator{"c": op3})
+	require.Error(t, err)
+}
+
+func TestClaimFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, claimFiles(dir+"/key.txt", dir+"/nodes.txt", dir+"/audit.log"))
+	require.EqualError(t, claimFiles(dir+"/key2.txt", dir+"/./nodes.txt", dir+"/audit2.log"),
+		"file used by another operator: "+dir+"/nodes.txt")
+	require.EqualError(t, claimFiles(dir+"/a.txt", dir+"/a.txt"), "file used by another operator: "+dir+"/a.txt")
+	require.NoError(t, claimFiles(dir+"/key2.txt", dir+"/nodes2.txt", dir+"/audit2.log"))
+}
+
+func TestRecreateOperatorAfterShutdown(t *testing.T) {
+	ctx := context.Background()
+	chain := newFakeChain()
+	node := newFakeSbchd(chain)
+	defer node.close()
+	chain.setNodes(node)
+	dir := t.TempDir()
+	cfg := Config{
+		NodesGovAddr:     fakeNodesGovAddr,
+		KeyFile:          filepath.Join(dir, "key.txt"),
+		NodesFile:        filepath.Join(dir, "nodes.txt"),
+		AuditFile:        filepath.Join(dir, "audit.log"),
+		BootstrapRpcURLs: []string{node.url()},
+	}
+
+	// the files are released if NewOperator fails
+	badCfg := cfg
+	badCfg.BootstrapRpcURLs = []string{"http://127.0.0.1:1"}
+	_, err := NewOperator(ctx, badCfg)
+	require.Error(t, err)
+
+	op, err := NewOperator(ctx, cfg)
+	require.NoError(t, err)
+	_, err = NewOperator(ctx, cfg)
+	require.EqualError(t, err, "file used by another operator: "+cfg.KeyFile)
+
+	runErr := make(chan error)
+	go func() { runErr <- op.Run(ctx) }()
+	require.Eventually(t, op.lifecycle.isRunning, 5*time.Second, time.Millisecond)
+	require.EqualError(t, op.Close(), "still running")
+	require.NoError(t, op.Shutdown(ctx))
+	require.NoError(t, <-runErr)
+	require.EqualError(t, op.Run(ctx), "closed")
+	_, err = op.signer.audit.file.Stat()
+	require.ErrorIs(t, err, os.ErrClosed)
+
+	op2, err := NewOperator(ctx, cfg)
+	require.NoError(t, err)
+	require.Equal(t, op.PubKey(), op2.PubKey())
+	require.NoError(t, op2.Close())
+}
@@ -5,17 +5,45 @@ import (
 )
 
 const (
-	keyFile = "/data/key.txt"
+	defaultKeyFile   = "/data/key.txt"
+	defaultNodesFile = "/data/nodes.txt"
+	defaultAuditFile = "/data/audit.log"
+
+	defaultRecoveryListenAddr = "0.0.0.0:8802"
 
 	sigCacheMaxCount    = 100000
 	sigCacheExpiration  = 24 * time.Hour
 	timeCacheMaxCount   = 200000
 	timeCacheExpiration = 24 * time.Hour
 
-	getSigHashesInterval = 10 * time.Second
-	checkNodesInterval   = 6 * time.Minute
-	newNodesDelayTime    = 6 * time.Hour
-	clientReqTimeout     = 5 * time.Minute
+	getSigHashesInterval    = 10 * time.Second
+	utxosStaleAfter         = 3 * getSigHashesInterval // the UTXO lists are served as stale after it
+	pollInfoUtxosInterval   = 1 * time.Minute          // for the redeemable and lost-and-found UTXOs
+	infoUtxosStaleAfter     = 3 * pollInfoUtxosInterval
+	checkNodesInterval      = 6 * time.Minute
+	checkChainInterval      = 1 * time.Minute
+	checkEventsInterval     = 30 * time.Second
+	checkMembershipInterval = 1 * time.Minute
+	ccInfoStaleAfter        = 3 * checkMembershipInterval // /cc-info is served as stale after it
+	newNodesDelayTime       = 6 * time.Hour
+	sigRevokeGracePeriod    = 5 * time.Minute // default, see Config.SigRevokeGracePeriod
+	clientReqTimeout        = 5 * time.Minute
+
+	serverShutdownTimeout = 5 * time.Second
+
+	sigEventsHeartbeat          = 15 * time.Second
+	sigEventsRetryDelay         = 1 * time.Second
+	sigEventsFallbackStreamTime = 4 * time.Second // less than the WriteTimeout of the server
+
+	maxDisagreementReports = 100
+	maxNodesHistory        = 1000
+	maxUtxosPageLimit      = 1000
+	maxSigsBatchSize       = 100
+	maxSigsBatchBodySize   = 16 * 1024
+	maxAuditPageLimit      = 1000
+	maxSigEvents           = 10000
+	maxLogsBlockRange      = 5000 // max blocks per eth_getLogs
+	maxCcInfoAttempts      = 3    // CcInfo is read again if a new block comes meanwhile
 
 	redeemPublicityPeriod  = 25  // * 60
 	convertPublicityPeriod = 100 // * 60
@@ -1,10 +1,11 @@
 package operator
 
 import (
-	"encoding/hex"
+	"context"
 	"fmt"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	gethcmn "github.com/ethereum/go-ethereum/common"
@@ -17,12 +18,28 @@ type sbchRpcClient struct {
 	// never changed
 	nodesGovAddr string
 	privateUrls  []string
+	nodesFile    string // optional, the verified nodes are persisted to it
+	chainPolicy  sbch.ChainPolicy
+	nodePolicy   sbch.EnclavePolicy
 
-	// curr/new clients, protected by mutex
-	rpcClientLock     sync.RWMutex
+	disagreements disagreementLog
+	nodesHistory  nodesHistory
+
+	// readers load the snapshot without locking,
+	// writers hold stateLock and publish a modified copy
+	state     atomic.Pointer[nodesState]
+	stateLock sync.Mutex
+}
+
+// nodesState is an immutable snapshot of the sbchd nodes and monitors,
+// it must not be modified after being published
+type nodesState struct {
+	// curr/new clients
 	currClusterClient *sbch.ClusterClient
+	currNodesTime     time.Time // when the curr nodes became active
 	newClusterClient  *sbch.ClusterClient
 	nodesChangedTime  time.Time
+	lastEventBlock    uint64 // NodesGov events are processed up to this block, persisted to nodesFile
 
 	// monitors info
 	currMonitors  []gethcmn.Address
@@ -30,26 +47,82 @@ type sbchRpcClient struct {
 	allMonitorMap map[gethcmn.Address]bool
 }
 
-func newSbchClient(nodesGovAddr string, bootstrapRpcURLs, privateUrls []string) (*sbchRpcClient, error) {
+var emptyNodesState = &nodesState{}
+
+func (client *sbchRpcClient) loadState() *nodesState {
+	if state := client.state.Load(); state != nil {
+		return state
+	}
+	return emptyNodesState
+}
+
+// updateState applies fn to a copy of the current snapshot and publishes the copy
+func (client *sbchRpcClient) updateState(fn func(state *nodesState)) {
+	client.stateLock.Lock()
+	defer client.stateLock.Unlock()
+
+	newState := *client.loadState()
+	fn(&newState)
+	client.state.Store(&newState)
+}
+
+func (client *sbchRpcClient) currClusterClient() *sbch.ClusterClient {
+	return client.loadState().currClusterClient
+}
+
+func newSbchClient(ctx context.Context, nodesGovAddr string, bootstrapRpcURLs, privateUrls []string,
+	nodesFile string, chainPolicy sbch.ChainPolicy, nodePolicy sbch.EnclavePolicy) (*sbchRpcClient, error) {
+
 	log.Info("initRpcClient, nodesGovAddr:", nodesGovAddr,
 		", bootstrapRpcURLs:", bootstrapRpcURLs, ", privateUrls:", privateUrls)
 
-	// create bootstrapClient and use it to get all nodes
-	bootstrapClient, err := sbch.NewClusterRpcClient(nodesGovAddr, nil, bootstrapRpcURLs, clientReqTimeout)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create bootstrapClient: %w", err)
+	client := &sbchRpcClient{
+		nodesGovAddr: nodesGovAddr,
+		privateUrls:  privateUrls,
+		nodesFile:    nodesFile,
+		chainPolicy:  chainPolicy,
+		nodePolicy:   nodePolicy,
+	}
+
+	state, err := client.restoreNodes(ctx)
+	if err == nil {
+		client.crossCheckBootstrapNodes(ctx, bootstrapRpcURLs, state)
+	} else {
+		log.Info("can not restore nodes:", err.Error(), ", use bootstrap nodes")
+		state, err = client.initNodesFromBootstrap(ctx, bootstrapRpcURLs)
+		if err != nil {
+			return nil, err
+		}
 	}
-	bootNodes, err := bootstrapClient.GetSbchdNodesSorted()
+
+	// follow NodesGov events from now on if not restored, the nodes before are read in full
+	if state.lastEventBlock == 0 {
+		if blockNum, err := state.currClusterClient.GetBlockNumber(ctx); err == nil {
+			state.lastEventBlock = blockNum
+		} else {
+			log.Warn("failed to get block number:", err.Error())
+		}
+	}
+
+	client.nodesHistory.init(state.latestNodes())
+	client.state.Store(state)
+	client.saveNodes()
+	return client, nil
+}
+
+func (client *sbchRpcClient) initNodesFromBootstrap(ctx context.Context, bootstrapRpcURLs []string) (*nodesState, error) {
+	// use bootstrapClient to get all nodes
+	bootNodes, err := client.getBootNodes(ctx, bootstrapRpcURLs)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get bootNodes: %w", err)
+		return nil, err
 	}
 
 	// create clusterClient and check nodes
-	clusterClient, err := sbch.NewClusterRpcClient(nodesGovAddr, bootNodes, privateUrls, clientReqTimeout)
+	clusterClient, err := client.dialCluster(ctx, bootNodes, client.privateUrls)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create clusterClient: %w", err)
 	}
-	latestNodes, err := clusterClient.GetSbchdNodesSorted()
+	latestNodes, err := clusterClient.GetSbchdNodesSorted(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get latestNodes: %w", err)
 	}
@@ -59,174 +132,261 @@ func newSbchClient(nodesGovAddr string, bootstrapRpcURLs, privateUrls []string)
 		return nil, fmt.Errorf("nodes not match")
 	}
 
-	client := &sbchRpcClient{
-		nodesGovAddr:      nodesGovAddr,
-		privateUrls:       privateUrls,
+	return &nodesState{
 		currClusterClient: clusterClient,
+		currNodesTime:     time.Now(),
 		allMonitorMap:     map[gethcmn.Address]bool{},
-	}
-	return client, nil
+	}, nil
 }
 
-func (client *sbchRpcClient) getAllSigHashes4Op() ([]string, error) {
-	client.rpcClientLock.RLock()
-	rpcClient := client.currClusterClient
-	client.rpcClientLock.RUnlock()
+// dialCluster creates a cluster client whose disagreements are recorded
+func (client *sbchRpcClient) dialCluster(ctx context.Context, nodes []sbch.NodeInfo,
+	privateUrls []string) (*sbch.ClusterClient, error) {
 
-	log.Info("call GetRedeemingUtxosForOperators ...")
-	redeemingUtxos4Op, err := rpcClient.GetRedeemingUtxosForOperators()
+	clusterClient, err := sbch.NewClusterRpcClient(ctx,
+		client.nodesGovAddr, nodes, privateUrls, clientReqTimeout, client.chainPolicy, client.nodePolicy)
 	if err != nil {
-		log.Error("failed to call GetRedeemingUtxosForOperators:", err.Error())
 		return nil, err
 	}
+	clusterClient.SetDisagreementHandler(client.disagreements.add)
+	return clusterClient, nil
+}
 
-	log.Info("call GetToBeConvertedUtxosForOperators ...")
-	toBeConvertedUtxos4Op, err := rpcClient.GetToBeConvertedUtxosForOperators()
+func (client *sbchRpcClient) getBootNodes(ctx context.Context, bootstrapRpcURLs []string) ([]sbch.NodeInfo, error) {
+	bootstrapClient, err := client.dialCluster(ctx, nil, bootstrapRpcURLs)
 	if err != nil {
-		log.Error("failed to call GetToBeConvertedUtxosForOperators:", err.Error())
-		return nil, err
+		return nil, fmt.Errorf("failed to create bootstrapClient: %w", err)
 	}
+	bootNodes, err := bootstrapClient.GetSbchdNodesSorted(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bootNodes: %w", err)
+	}
+	return bootNodes, nil
+}
 
-	sigHashes := make([]string, 0, len(redeemingUtxos4Op)+len(toBeConvertedUtxos4Op))
-	for _, utxo := range redeemingUtxos4Op {
-		sigHashes = append(sigHashes, hex.EncodeToString(utxo.TxSigHash))
+// getCcInfoSnapshot reads the CcInfo from all nodes, between two same block numbers
+func (client *sbchRpcClient) getCcInfoSnapshot(ctx context.Context) (*CcInfoSnapshot, error) {
+	clusterClient := client.currClusterClient()
+	height, err := clusterClient.GetBlockNumber(ctx)
+	if err != nil {
+		return nil, err
 	}
-	for _, utxo := range toBeConvertedUtxos4Op {
-		sigHashes = append(sigHashes, hex.EncodeToString(utxo.TxSigHash))
+	for i := 0; i < maxCcInfoAttempts; i++ {
+		ccInfo, err := clusterClient.GetCcInfo(ctx)
+		if err != nil {
+			return nil, err
+		}
+		latestHeight, err := clusterClient.GetBlockNumber(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if latestHeight == height {
+			return &CcInfoSnapshot{Height: height, FetchedTime: time.Now().Unix(), CcInfo: ccInfo}, nil
+		}
+		height = latestHeight
 	}
-	log.Info("allSigHashes4Op:", sigHashes)
-	return sigHashes, nil
+	return nil, fmt.Errorf("new blocks keep coming while reading CcInfo, height: %d", height)
 }
 
-func (client *sbchRpcClient) getAllSigHashes4Mo() ([]string, []string, error) {
-	client.rpcClientLock.RLock()
-	rpcClient := client.currClusterClient
-	client.rpcClientLock.RUnlock()
-
-	log.Info("call GetRedeemingUtxosForMonitors ...")
-	redeemingUtxos4Mo, err := rpcClient.GetRedeemingUtxosForMonitors()
-	if err != nil {
-		log.Error("failed to call GetRedeemingUtxosForOperators:", err.Error())
-		return nil, nil, err
+// run this in a goroutine, returns when ctx is done
+func (client *sbchRpcClient) watchMonitorsAndSbchdNodes(ctx context.Context) {
+	log.Info("start to watchMonitorsAndSbchdNodes ...")
+	ticker := time.NewTicker(checkNodesInterval)
+	defer ticker.Stop()
+	chainTicker := time.NewTicker(checkChainInterval)
+	defer chainTicker.Stop()
+	eventsTicker := time.NewTicker(checkEventsInterval)
+	defer eventsTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("stop watchMonitorsAndSbchdNodes")
+			return
+		case <-chainTicker.C:
+			client.checkNodesChain(ctx)
+		case <-eventsTicker.C:
+			if client.watchNodesGovEvents(ctx) {
+				client.watchSbchdNodes(ctx)
+			}
+		case <-ticker.C:
+			// full reconciliation, in case some events are missed
+			client.watchMonitors(ctx)
+			client.watchSbchdNodes(ctx)
+		}
 	}
+}
 
-	log.Info("call GetToBeConvertedUtxosForMonitors ...")
-	toBeConvertedUtxos4Mo, err := rpcClient.GetToBeConvertedUtxosForMonitors()
+// watchNodesGovEvents processes the NodesGov events since lastEventBlock,
+// records them in nodesHistory, and returns true if there are any
+func (client *sbchRpcClient) watchNodesGovEvents(ctx context.Context) bool {
+	clusterClient := client.currClusterClient()
+	latestBlock, err := clusterClient.GetBlockNumber(ctx)
 	if err != nil {
-		log.Error("failed to call GetToBeConvertedUtxosForMonitors:", err.Error())
-		return nil, nil, err
+		log.Error("failed to get block number:", err.Error())
+		return false
 	}
 
-	redeemingSigHashes := make([]string, len(redeemingUtxos4Mo))
-	for i, utxo := range redeemingUtxos4Mo {
-		redeemingSigHashes[i] = hex.EncodeToString(utxo.TxSigHash)
+	lastEventBlock := client.loadState().lastEventBlock
+	if lastEventBlock == 0 {
+		// block number was not available at startup
+		client.setLastEventBlock(latestBlock)
+		return false
 	}
-	log.Info("redeemingSigHashes4Mo:", redeemingSigHashes)
 
-	toBeConvertedSigHashes := make([]string, len(toBeConvertedUtxos4Mo))
-	for i, utxo := range toBeConvertedUtxos4Mo {
-		toBeConvertedSigHashes[i] = hex.EncodeToString(utxo.TxSigHash)
+	found := false
+	for fromBlock := lastEventBlock + 1; fromBlock <= latestBlock; fromBlock += maxLogsBlockRange {
+		toBlock := fromBlock + maxLogsBlockRange - 1
+		if toBlock > latestBlock {
+			toBlock = latestBlock
+		}
+		events, err := clusterClient.GetNodesGovEvents(ctx, fromBlock, toBlock)
+		if err != nil {
+			// retry from fromBlock next time
+			log.Error("failed to get NodesGov events:", err.Error())
+			break
+		}
+		if len(events) > 0 {
+			log.Info("NodesGov events:", toJSON(events))
+			client.nodesHistory.addEvents(events)
+			found = true
+		}
+		lastEventBlock = toBlock
 	}
-	log.Info("toBeConvertedSigHashes4Mo:", toBeConvertedSigHashes)
-	return redeemingSigHashes, toBeConvertedSigHashes, nil
+	client.setLastEventBlock(lastEventBlock)
+	return found
 }
 
-// run this in a goroutine
-func (client *sbchRpcClient) watchMonitorsAndSbchdNodes() {
-	log.Info("start to watchMonitorsAndSbchdNodes ...")
-	// TODO: change to time.Ticker?
-	for {
-		time.Sleep(checkNodesInterval)
+func (client *sbchRpcClient) setLastEventBlock(blockNum uint64) {
+	if blockNum == client.loadState().lastEventBlock {
+		return
+	}
+	client.updateState(func(state *nodesState) {
+		state.lastEventBlock = blockNum
+	})
+	client.saveNodes()
+}
 
-		client.watchMonitors()
-		client.watchSbchdNodes()
+// checkNodesChain excludes the nodes which are on the wrong chain or lagging
+func (client *sbchRpcClient) checkNodesChain(ctx context.Context) {
+	state := client.loadState()
+	for _, clusterClient := range []*sbch.ClusterClient{state.currClusterClient, state.newClusterClient} {
+		if clusterClient == nil {
+			continue
+		}
+		clusterClient.CheckNodes(ctx)
+		if exclusions := clusterClient.Exclusions(); len(exclusions) > 0 {
+			log.Warn("excluded nodes:", toJSON(exclusions))
+		}
 	}
 }
 
-func (client *sbchRpcClient) watchMonitors() {
+func (client *sbchRpcClient) watchMonitors(ctx context.Context) {
 	log.Info("get monitors ...")
-	latestMonitors, err := client.currClusterClient.GetMonitors()
+	latestMonitors, err := client.currClusterClient().GetMonitors(ctx)
 	if err != nil {
 		log.Error("failed to get monitors:", err.Error())
 		return
 	}
 
-	if !reflect.DeepEqual(latestMonitors, client.currMonitors) {
+	if !reflect.DeepEqual(latestMonitors, client.loadState().currMonitors) {
 		log.Info("monitors changed:", toJSON(latestMonitors))
-		client.rpcClientLock.Lock()
-		defer client.rpcClientLock.Unlock()
-		client.currMonitors = latestMonitors
-		for _, monitor := range latestMonitors {
-			if !client.allMonitorMap[monitor] {
-				client.allMonitorMap[monitor] = true
-				client.allMonitors = append(client.allMonitors, monitor)
+		client.updateState(func(state *nodesState) {
+			state.currMonitors = latestMonitors
+			allMonitors := append([]gethcmn.Address{}, state.allMonitors...)
+			allMonitorMap := make(map[gethcmn.Address]bool, len(state.allMonitorMap))
+			for monitor := range state.allMonitorMap {
+				allMonitorMap[monitor] = true
 			}
-		}
+			for _, monitor := range latestMonitors {
+				if !allMonitorMap[monitor] {
+					allMonitorMap[monitor] = true
+					allMonitors = append(allMonitors, monitor)
+				}
+			}
+			state.allMonitors = allMonitors
+			state.allMonitorMap = allMonitorMap
+		})
 	}
 }
 
-func (client *sbchRpcClient) watchSbchdNodes() {
+func (client *sbchRpcClient) watchSbchdNodes(ctx context.Context) {
 	log.Info("get latest nodes ...")
-	latestNodes, err := client.currClusterClient.GetSbchdNodesSorted()
+	latestNodes, err := client.currClusterClient().GetSbchdNodesSorted(ctx)
 	if err != nil {
 		log.Error("failed to get sbchd nodes:", err.Error())
 		return
 	}
 
-	if client.nodesChanged(latestNodes) {
+	// compared with the last scan, not the dialed nodes, so that a failed dial is recorded once
+	client.nodesHistory.addScan(latestNodes)
+	if client.loadState().nodesChanged(latestNodes) {
 		log.Info("nodes changed:", toJSON(latestNodes))
-		client.newClusterClient = nil
-		clusterClient, err := sbch.NewClusterRpcClient(
-			client.nodesGovAddr, latestNodes, client.privateUrls, clientReqTimeout)
+		client.updateState(func(state *nodesState) {
+			state.newClusterClient = nil
+		})
+		clusterClient, err := client.dialCluster(ctx, latestNodes, client.privateUrls)
 		if err != nil {
 			log.Error("failed to check sbchd nodes:", err.Error())
 			return
 		}
 
-		client.nodesChangedTime = time.Now()
-		client.newClusterClient = clusterClient
+		client.updateState(func(state *nodesState) {
+			state.nodesChangedTime = time.Now()
+			state.newClusterClient = clusterClient
+		})
+		client.saveNodes()
 		return
 	} else {
 		log.Info("nodes not changed")
 	}
 
-	if client.newClusterClient != nil {
-		if time.Since(client.nodesChangedTime) > newNodesDelayTime {
+	switched := false
+	client.updateState(func(state *nodesState) {
+		if state.newClusterClient != nil && time.Since(state.nodesChangedTime) > newNodesDelayTime {
 			log.Info("switch to new cluster client")
-			client.rpcClientLock.Lock()
-			defer client.rpcClientLock.Unlock()
-			client.currClusterClient = client.newClusterClient
-			client.newClusterClient = nil
+			state.currClusterClient = state.newClusterClient
+			state.currNodesTime = time.Now()
+			state.newClusterClient = nil
+			switched = true
 		}
+	})
+	if switched {
+		client.saveNodes()
 	}
 }
-func (client *sbchRpcClient) nodesChanged(latestNodes []sbch.NodeInfo) bool {
-	if client.newClusterClient != nil {
-		return !nodesEqual(client.newClusterClient.PublicNodes, latestNodes)
+func (state *nodesState) nodesChanged(latestNodes []sbch.NodeInfo) bool {
+	return !nodesEqual(state.latestNodes(), latestNodes)
+}
+
+// latestNodes returns the new nodes if any, or the current nodes
+func (state *nodesState) latestNodes() []sbch.NodeInfo {
+	if state.newClusterClient != nil {
+		return state.newClusterClient.PublicNodes
 	}
-	return !nodesEqual(client.currClusterClient.PublicNodes, latestNodes)
+	return state.currClusterClient.PublicNodes
 }
 func nodesEqual(s1, s2 []sbch.NodeInfo) bool {
 	return reflect.DeepEqual(s1, s2)
 }
 
 func (client *sbchRpcClient) isMonitor(addr gethcmn.Address) bool {
-	client.rpcClientLock.RLock()
-	defer client.rpcClientLock.RUnlock()
-
-	return client.allMonitorMap[addr]
+	return client.loadState().allMonitorMap[addr]
 }
 
 func (client *sbchRpcClient) fillMonitorsAndNodesInfo(opInfo *OpInfo) {
-	client.rpcClientLock.RLock()
-	defer client.rpcClientLock.RUnlock()
+	state := client.loadState()
 
-	opInfo.Monitors = client.allMonitors
-	if client.currClusterClient != nil {
-		opInfo.CurrNodes = client.currClusterClient.PublicNodes
+	opInfo.Monitors = state.allMonitors
+	if state.currClusterClient != nil {
+		opInfo.CurrNodes = state.currClusterClient.PublicNodes
+		opInfo.NodesHealth = state.currClusterClient.NodesHealth()
+		opInfo.ExcludedNodes = state.currClusterClient.Exclusions()
+	}
+	if !state.currNodesTime.IsZero() {
+		opInfo.CurrNodesTime = state.currNodesTime.Unix()
 	}
-	if client.newClusterClient != nil {
-		opInfo.NewNodes = client.newClusterClient.PublicNodes
-		opInfo.NodesChangedTime = client.nodesChangedTime.Unix()
+	if state.newClusterClient != nil {
+		opInfo.NewNodes = state.newClusterClient.PublicNodes
+		opInfo.NodesChangedTime = state.nodesChangedTime.Unix()
 	}
 }
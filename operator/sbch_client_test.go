@@ -0,0 +1,317 @@
+package operator
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/cc-operator/sbch"
+)
+
+func TestNewSbchClient(t *testing.T) {
+	ctx := context.Background()
+	chain := newFakeChain()
+	node1, node2 := newFakeSbchd(chain), newFakeSbchd(chain)
+	defer node1.close()
+	defer node2.close()
+	chain.setNodes(node1, node2)
+
+	client, err := newSbchClient(ctx, fakeNodesGovAddr, []string{node1.url()}, nil, "", sbch.ChainPolicy{}, sbch.EnclavePolicy{})
+	require.NoError(t, err)
+	require.Len(t, client.currClusterClient().PublicNodes, 2)
+}
+
+func TestSbchClientSwitchNodes(t *testing.T) {
+	ctx := context.Background()
+	chain := newFakeChain()
+	node1, node2, node3 := newFakeSbchd(chain), newFakeSbchd(chain), newFakeSbchd(chain)
+	defer node1.close()
+	defer node2.close()
+	defer node3.close()
+	chain.setNodes(node1, node2)
+	chain.setMonitors(gethcmn.Address{0x01})
+
+	client, err := newSbchClient(ctx, fakeNodesGovAddr, []string{node1.url()}, nil, "", sbch.ChainPolicy{}, sbch.EnclavePolicy{})
+	require.NoError(t, err)
+
+	client.watchMonitors(ctx)
+	require.True(t, client.isMonitor(gethcmn.Address{0x01}))
+
+	// new nodes are only used after newNodesDelayTime
+	chain.setNodes(node1, node2, node3)
+	client.watchSbchdNodes(ctx)
+	state := client.loadState()
+	require.Len(t, state.currClusterClient.PublicNodes, 2)
+	require.Len(t, state.newClusterClient.PublicNodes, 3)
+
+	client.watchSbchdNodes(ctx)
+	require.Equal(t, state.newClusterClient, client.loadState().newClusterClient)
+
+	client.updateState(func(state *nodesState) {
+		state.nodesChangedTime = time.Now().Add(-newNodesDelayTime - time.Second)
+	})
+	client.watchSbchdNodes(ctx)
+	state = client.loadState()
+	require.Len(t, state.currClusterClient.PublicNodes, 3)
+	require.Nil(t, state.newClusterClient)
+
+	// old monitors are still accepted
+	chain.setMonitors(gethcmn.Address{0x02})
+	client.watchMonitors(ctx)
+	require.True(t, client.isMonitor(gethcmn.Address{0x01}))
+	require.True(t, client.isMonitor(gethcmn.Address{0x02}))
+	require.Len(t, client.loadState().allMonitors, 2)
+}
+
+// run with: go test -race
+func TestSbchClientConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	chain := newFakeChain()
+	nodes := []*fakeSbchd{newFakeSbchd(chain), newFakeSbchd(chain), newFakeSbchd(chain)}
+	for _, node := range nodes {
+		defer node.close()
+	}
+	chain.setNodes(nodes[0], nodes[1])
+	chain.setUtxos("sbch_getRedeemingUtxosForOperators",
+		&sbchrpctypes.UtxoInfo{TxSigHash: []byte{0x12, 0x34}})
+
+	client, err := newSbchClient(ctx, fakeNodesGovAddr, []string{nodes[0].url()}, nil, "", sbch.ChainPolicy{}, sbch.EnclavePolicy{})
+	require.NoError(t, err)
+	op := &Operator{signer: newSigner(nil, client)}
+	mux := op.createHttpHandlers()
+	_, err = op.signer.pollUtxos(ctx)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	wg := sync.WaitGroup{}
+
+	// poll nodes & monitors, and switch nodes
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			chain.setNodes(nodes[:2+i%2]...)
+			chain.setMonitors(gethcmn.Address{byte(i)})
+			client.watchMonitors(ctx)
+			client.watchSbchdNodes(ctx)
+			client.updateState(func(state *nodesState) {
+				state.nodesChangedTime = time.Time{}
+			})
+			client.watchSbchdNodes(ctx)
+		}
+		close(done)
+	}()
+
+	// HTTP reads, the failed responses are checked after all goroutines are done
+	failed := make(chan string, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for _, path := range []string{"/info", "/redeeming-utxos-for-operators"} {
+					if resp := callMuxHandler(mux, path); !strings.Contains(resp, `"success":true`) {
+						failed <- path + ": " + resp
+						return
+					}
+				}
+				_, _ = op.signer.pollUtxos(ctx)
+				_ = client.isMonitor(gethcmn.Address{0x01})
+			}
+		}()
+	}
+	wg.Wait()
+	close(failed)
+	for resp := range failed {
+		t.Error(resp)
+	}
+}
+
+func TestSbchClientRestoreNodes(t *testing.T) {
+	ctx := context.Background()
+	chain := newFakeChain()
+	node1, node2, node3 := newFakeSbchd(chain), newFakeSbchd(chain), newFakeSbchd(chain)
+	defer node1.close()
+	defer node2.close()
+	defer node3.close()
+	chain.setNodes(node1, node2)
+	nodesFile := filepath.Join(t.TempDir(), "nodes.txt")
+
+	client, err := newSbchClient(ctx, fakeNodesGovAddr, []string{node1.url()}, nil, nodesFile, sbch.ChainPolicy{}, sbch.EnclavePolicy{})
+	require.NoError(t, err)
+	chain.setNodes(node1, node2, node3)
+	client.watchSbchdNodes(ctx)
+	state := client.loadState()
+	require.NotNil(t, state.newClusterClient)
+
+	// bootstrap node is down, restore nodes from file
+	client, err = newSbchClient(ctx, fakeNodesGovAddr, []string{"http://127.0.0.1:1"}, nil,
+		nodesFile, sbch.ChainPolicy{}, sbch.EnclavePolicy{})
+	require.NoError(t, err)
+	restored := client.loadState()
+	require.Equal(t, state.currClusterClient.PublicNodes, restored.currClusterClient.PublicNodes)
+	require.Equal(t, state.currNodesTime.Unix(), restored.currNodesTime.Unix())
+	require.Equal(t, state.newClusterClient.PublicNodes, restored.newClusterClient.PublicNodes)
+	require.Equal(t, state.nodesChangedTime.Unix(), restored.nodesChangedTime.Unix())
+
+	// nodesGovAddr changed, fallback to bootstrap nodes
+	_, err = newSbchClient(ctx, "0x0000000000000000000000000000000000005678",
+		[]string{"http://127.0.0.1:1"}, nil, nodesFile, sbch.ChainPolicy{}, sbch.EnclavePolicy{})
+	require.Error(t, err)
+}
+
+func TestSbchClientChainCheck(t *testing.T) {
+	ctx := context.Background()
+	chain, laggingChain, otherChain := newFakeChain(), newFakeChain(), newFakeChain()
+	node1, node2, node3 := newFakeSbchd(chain), newFakeSbchd(laggingChain), newFakeSbchd(otherChain)
+	defer node1.close()
+	defer node2.close()
+	defer node3.close()
+	otherChain.chainID = fakeChainID + 1
+	laggingChain.setLatestBlock(90, time.Now().Add(-time.Hour))
+	for _, c := range []*fakeChain{chain, laggingChain, otherChain} {
+		c.setNodes(node1, node2)
+	}
+	policy := sbch.ChainPolicy{ChainID: fakeChainID, GenesisHash: fakeGenesisHash, MaxLag: time.Minute, MinActiveNodes: 1}
+
+	// node on the wrong chain is rejected
+	_, err := newSbchClient(ctx, fakeNodesGovAddr, []string{node1.url()}, []string{node3.url()}, "", policy, sbch.EnclavePolicy{})
+	require.ErrorIs(t, err, sbch.ErrWrongChain)
+
+	// lagging node is excluded
+	client, err := newSbchClient(ctx, fakeNodesGovAddr, []string{node1.url()}, nil, "", policy, sbch.EnclavePolicy{})
+	require.NoError(t, err)
+	exclusions := client.currClusterClient().Exclusions()
+	require.Len(t, exclusions, 1)
+	require.Equal(t, node2.url(), exclusions[0].RpcUrl)
+	require.Contains(t, exclusions[0].Reason, "node lagging")
+
+	opInfo := &OpInfo{}
+	client.fillMonitorsAndNodesInfo(opInfo)
+	require.Equal(t, exclusions, opInfo.ExcludedNodes)
+
+	// only the active node is called
+	laggingChain.setMonitors(gethcmn.Address{0x01})
+	monitors, err := client.currClusterClient().GetMonitors(ctx)
+	require.NoError(t, err)
+	require.Empty(t, monitors)
+
+	// lagging node catches up
+	laggingChain.setLatestBlock(100, time.Now())
+	client.checkNodesChain(ctx)
+	require.Empty(t, client.currClusterClient().Exclusions())
+	_, err = client.currClusterClient().GetMonitors(ctx)
+	require.Error(t, err)
+}
+
+func TestSbchClientNodesHistory(t *testing.T) {
+	ctx := context.Background()
+	chain := newFakeChain()
+	node1, node2, node3 := newFakeSbchd(chain), newFakeSbchd(chain), newFakeSbchd(chain)
+	defer node1.close()
+	defer node2.close()
+	defer node3.close()
+	chain.setNodes(node1, node2)
+
+	client, err := newSbchClient(ctx, fakeNodesGovAddr, []string{node1.url()}, nil, "", sbch.ChainPolicy{}, sbch.EnclavePolicy{})
+	require.NoError(t, err)
+	client.watchSbchdNodes(ctx)
+	require.Empty(t, client.nodesHistory.query(0, 0))
+
+	// node 2 is replaced by node3, then node 3 is removed
+	chain.setNodes(node1, node3)
+	client.watchSbchdNodes(ctx)
+	changes := client.nodesHistory.query(0, 0)
+	require.Len(t, changes, 1)
+	require.Equal(t, NodeUpdated, changes[0].Change)
+	require.Equal(t, node3.url(), changes[0].Node.RpcUrl)
+	chain.setNodes(node1)
+	client.watchSbchdNodes(ctx)
+	changes = client.nodesHistory.query(0, 0)
+	require.Len(t, changes, 2)
+	require.Equal(t, NodeRemoved, changes[0].Change)
+	require.Equal(t, uint64(2), changes[0].Node.ID)
+	require.Empty(t, client.nodesHistory.query(time.Now().Unix()+1, 0))
+
+	// recorded once even if the new nodes can not be dialed
+	node4 := newFakeSbchd(chain)
+	node4.close()
+	chain.setNodes(node1, node4)
+	client.watchSbchdNodes(ctx)
+	client.watchSbchdNodes(ctx)
+	require.Nil(t, client.loadState().newClusterClient)
+	changes = client.nodesHistory.query(0, 0)
+	require.Len(t, changes, 3)
+	require.Equal(t, NodeAdded, changes[0].Change)
+	require.Equal(t, uint64(2), changes[0].NodeID)
+
+	op := &Operator{signer: newSigner(nil, client)}
+	resp := callMuxHandler(op.createHttpHandlers(), "/nodes-history?limit=2")
+	require.Contains(t, resp, `"change":"removed","nodeId":2,"node":{"id":2,`)
+	require.NotContains(t, resp, `"updated"`)
+	require.Equal(t, `{"success":false,"error":"invalid query parameter: since"}`,
+		callMuxHandler(op.createHttpHandlers(), "/nodes-history?since=x"))
+}
+
+func TestSbchClientNodesGovEvents(t *testing.T) {
+	ctx := context.Background()
+	chain := newFakeChain()
+	node1, node2 := newFakeSbchd(chain), newFakeSbchd(chain)
+	defer node1.close()
+	defer node2.close()
+	chain.setNodes(node1)
+
+	nodesFile := filepath.Join(t.TempDir(), "nodes.txt")
+	client, err := newSbchClient(ctx, fakeNodesGovAddr, []string{node1.url()}, nil, nodesFile, sbch.ChainPolicy{}, sbch.EnclavePolicy{})
+	require.NoError(t, err)
+	require.Equal(t, uint64(100), client.loadState().lastEventBlock)
+	require.False(t, client.watchNodesGovEvents(ctx))
+
+	chain.setNodes(node1, node2)
+	chain.addNodesGovEvent("NodeAdded", 2)
+	chain.addNodesGovEvent("NodeUpdated", 1)
+	require.True(t, client.watchNodesGovEvents(ctx))
+	require.Equal(t, uint64(102), client.loadState().lastEventBlock)
+	require.False(t, client.watchNodesGovEvents(ctx))
+
+	// the full scan does not record the changes again
+	client.watchSbchdNodes(ctx)
+	require.Len(t, client.loadState().newClusterClient.PublicNodes, 2)
+	changes := client.nodesHistory.query(0, 0)
+	require.Len(t, changes, 2)
+	require.Equal(t, NodeUpdated, changes[0].Change)
+	require.Equal(t, uint64(1), changes[0].NodeID)
+	require.Equal(t, NodeAdded, changes[1].Change)
+	require.Equal(t, uint64(2), changes[1].NodeID)
+	require.Equal(t, uint64(101), changes[1].BlockNum)
+	require.Nil(t, changes[1].Node)
+
+	// the missed events are found by the full scan
+	chain.setNodes(node1)
+	client.watchSbchdNodes(ctx)
+	changes = client.nodesHistory.query(0, 0)
+	require.Len(t, changes, 3)
+	require.Equal(t, NodeRemoved, changes[0].Change)
+	require.Equal(t, uint64(2), changes[0].NodeID)
+	require.Zero(t, changes[0].BlockNum)
+
+	// the events are followed from the persisted block after restarts
+	chain.addNodesGovEvent("NodeRemoved", 2)
+	client, err = newSbchClient(ctx, fakeNodesGovAddr, []string{node1.url()}, nil, nodesFile, sbch.ChainPolicy{}, sbch.EnclavePolicy{})
+	require.NoError(t, err)
+	require.Equal(t, uint64(102), client.loadState().lastEventBlock)
+	require.True(t, client.watchNodesGovEvents(ctx))
+	require.Equal(t, uint64(103), client.loadState().lastEventBlock)
+}
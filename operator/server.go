@@ -1,13 +1,14 @@
 package operator
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"strconv"
-	"sync/atomic"
+	"strings"
 	"time"
 
 	"github.com/edgelesssys/ego/enclave"
@@ -15,6 +16,7 @@ import (
 	gethcmn "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	log "github.com/sirupsen/logrus"
+	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
 
 	"github.com/smartbch/cc-operator/utils"
 )
@@ -24,95 +26,107 @@ const (
 	attestationProviderURL  = "https://shareduks.uks.attest.azure.net"
 )
 
-var (
-	pubKeyBytes []byte
-	certBytes   []byte
-	suspended   atomic.Value
-	withChaos   bool
-	signer      *txSigner
-)
-
 var (
 	errTsTooOld   = errors.New("ts too old")
 	errTsTooNew   = errors.New("ts too new")
 	errNotMonitor = errors.New("not monitor")
 )
 
-func Start(serverName, listenAddr, nodesGovAddr, signerKeyWIF string,
-	bootstrapRpcURLs []string, privateUrls []string, _withChaos bool) {
-
-	withChaos = _withChaos
-
-	privKey, pbkBytes, err := loadOrGenKey(signerKeyWIF)
-	if err != nil {
-		panic(err)
-	}
-	pubKeyBytes = pbkBytes
-
-	sbchClient, err := newSbchClient(nodesGovAddr, bootstrapRpcURLs, privateUrls)
-	if err != nil {
-		panic(err)
-	}
-	signer = newSigner(privKey, sbchClient)
-
-	go sbchClient.watchMonitorsAndSbchdNodes()
-	go signer.getAndSignSigHashes()
-	go startHttpsServer(serverName, listenAddr)
-	select {}
-}
-
-func startHttpsServer(serverName, listenAddr string) {
+func newHttpsServer(serverName, listenAddr string, ops map[string]*Operator) *http.Server {
 	// Create a TLS config with a self-signed certificate and an embedded report.
 	cert, _, tlsCfg := utils.CreateCertificate(serverName)
-	certBytes = cert
+	for _, op := range ops {
+		op.certBytes = cert
+	}
 
-	mux := createHttpHandlers()
-	server := http.Server{
+	return &http.Server{
 		Addr:         listenAddr,
-		Handler:      mux,
+		Handler:      createMultiHttpHandlers(ops),
 		ReadTimeout:  3 * time.Second,
 		WriteTimeout: 5 * time.Second,
 		TLSConfig:    tlsCfg,
 	}
-	log.Info("listening at:", listenAddr, "...")
-	err := server.ListenAndServeTLS("", "")
-	if err != nil {
-		log.Fatal(err)
+}
+
+// serveHttps serves until ctx is done, then shuts the server down gracefully
+func serveHttps(ctx context.Context, server *http.Server) error {
+	errCh := make(chan error, 1)
+	go func() {
+		log.Info("listening at:", server.Addr, "...")
+		errCh <- server.ListenAndServeTLS("", "")
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
 	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer cancel()
+	err := server.Shutdown(shutdownCtx)
+	if _err := <-errCh; !errors.Is(_err, http.ErrServerClosed) {
+		err = _err
+	}
+	return err
+}
+
+// mount the handlers of each operator under its path prefix
+func createMultiHttpHandlers(ops map[string]*Operator) *http.ServeMux {
+	mux := http.NewServeMux()
+	for prefix, op := range ops {
+		prefix = strings.Trim(prefix, "/")
+		if prefix == "" {
+			mux.Handle("/", op.createHttpHandlers())
+		} else {
+			mux.Handle("/"+prefix+"/", http.StripPrefix("/"+prefix, op.createHttpHandlers()))
+		}
+	}
+	return mux
 }
 
-func createHttpHandlers() *http.ServeMux {
+func (op *Operator) createHttpHandlers() *http.ServeMux {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/cert", handleCert)
-	mux.HandleFunc("/cert-report", handleCertReport)
-	mux.HandleFunc("/pubkey", handlePubKey)
-	mux.HandleFunc("/pubkey-report", handlePubkeyReport)
-	mux.HandleFunc("/pubkey-jwt", handlePubkeyJwt)
-	mux.HandleFunc("/sig", handleSig)
-	mux.HandleFunc("/info", handleOpInfo)
-	mux.HandleFunc("/suspend", handleSuspend) // only monitor
-	mux.HandleFunc("/redeeming-utxos-for-operators", handleGetRedeemingUtxosForOperators)
-	mux.HandleFunc("/redeeming-utxos-for-monitors", handleGetRedeemingUtxosForMonitors)
-	mux.HandleFunc("/to-be-converted-utxos-for-operators", handleGetToBeConvertedUtxosForOperators)
-	mux.HandleFunc("/to-be-converted-utxos-for-monitors", handleGetToBeConvertedUtxosForMonitors)
+	mux.HandleFunc("/cert", op.handleCert)
+	mux.HandleFunc("/cert-report", op.handleCertReport)
+	mux.HandleFunc("/pubkey", op.handlePubKey)
+	mux.HandleFunc("/pubkey-report", op.handlePubkeyReport)
+	mux.HandleFunc("/pubkey-jwt", op.handlePubkeyJwt)
+	mux.HandleFunc("/sig", op.handleSig)
+	mux.HandleFunc("/sig-status", op.handleSigStatus)
+	mux.HandleFunc("/sigs", op.handleSigs) // POST
+	mux.HandleFunc("/sig-events", op.handleSigEvents)
+	mux.HandleFunc("/audit", op.handleAudit)
+	mux.HandleFunc("/info", op.handleOpInfo)
+	mux.HandleFunc("/metrics", op.handleMetrics)
+	mux.HandleFunc("/diagnostics/disagreements", op.handleDisagreements)
+	mux.HandleFunc("/nodes-history", op.handleNodesHistory)
+	mux.HandleFunc("/cc-info", op.handleCcInfo)
+	mux.HandleFunc("/suspend", op.handleSuspend) // only monitor
+	mux.HandleFunc("/redeeming-utxos-for-operators", op.handleGetRedeemingUtxosForOperators)
+	mux.HandleFunc("/redeeming-utxos-for-monitors", op.handleGetRedeemingUtxosForMonitors)
+	mux.HandleFunc("/to-be-converted-utxos-for-operators", op.handleGetToBeConvertedUtxosForOperators)
+	mux.HandleFunc("/to-be-converted-utxos-for-monitors", op.handleGetToBeConvertedUtxosForMonitors)
+	mux.HandleFunc("/redeemable-utxos", op.handleGetRedeemableUtxos)
+	mux.HandleFunc("/lost-and-found-utxos", op.handleGetLostAndFoundUtxos)
 	return mux
 }
 
-func handleCert(w http.ResponseWriter, r *http.Request) {
+func (op *Operator) handleCert(w http.ResponseWriter, r *http.Request) {
 	if utils.GetQueryParam(r, "raw") != "" {
-		_, _ = w.Write(certBytes)
+		_, _ = w.Write(op.certBytes)
 		return
 	}
-	NewOkResp("0x" + hex.EncodeToString(certBytes)).WriteTo(w)
+	NewOkResp("0x" + hex.EncodeToString(op.certBytes)).WriteTo(w)
 }
 
-func handleCertReport(w http.ResponseWriter, r *http.Request) {
+func (op *Operator) handleCertReport(w http.ResponseWriter, r *http.Request) {
 	if !sgxMode {
 		NewErrResp("non-SGX mode").WriteTo(w)
 		return
 	}
 
-	certHash := sha256.Sum256(certBytes)
+	certHash := sha256.Sum256(op.certBytes)
 	report, err := enclave.GetRemoteReport(certHash[:])
 	if err != nil {
 		NewErrResp(err.Error()).WriteTo(w)
@@ -126,21 +140,21 @@ func handleCertReport(w http.ResponseWriter, r *http.Request) {
 	NewOkResp("0x" + hex.EncodeToString(report)).WriteTo(w)
 }
 
-func handlePubKey(w http.ResponseWriter, r *http.Request) {
+func (op *Operator) handlePubKey(w http.ResponseWriter, r *http.Request) {
 	if utils.GetQueryParam(r, "raw") != "" {
-		_, _ = w.Write(pubKeyBytes)
+		_, _ = w.Write(op.pubKeyBytes)
 		return
 	}
-	NewOkResp("0x" + hex.EncodeToString(pubKeyBytes)).WriteTo(w)
+	NewOkResp("0x" + hex.EncodeToString(op.pubKeyBytes)).WriteTo(w)
 }
 
-func handlePubkeyReport(w http.ResponseWriter, r *http.Request) {
+func (op *Operator) handlePubkeyReport(w http.ResponseWriter, r *http.Request) {
 	if !sgxMode {
 		NewErrResp("non-SGX mode").WriteTo(w)
 		return
 	}
 
-	pbkHash := sha256.Sum256(pubKeyBytes)
+	pbkHash := sha256.Sum256(op.pubKeyBytes)
 	report, err := enclave.GetRemoteReport(pbkHash[:])
 	if err != nil {
 		NewErrResp(err.Error()).WriteTo(w)
@@ -154,13 +168,13 @@ func handlePubkeyReport(w http.ResponseWriter, r *http.Request) {
 	NewOkResp("0x" + hex.EncodeToString(report)).WriteTo(w)
 }
 
-func handlePubkeyJwt(w http.ResponseWriter, r *http.Request) {
+func (op *Operator) handlePubkeyJwt(w http.ResponseWriter, r *http.Request) {
 	if !sgxMode {
 		NewErrResp("non-SGX mode").WriteTo(w)
 		return
 	}
 
-	token, err := enclave.CreateAzureAttestationToken(pubKeyBytes, attestationProviderURL)
+	token, err := enclave.CreateAzureAttestationToken(op.pubKeyBytes, attestationProviderURL)
 	if err != nil {
 		NewErrResp(err.Error()).WriteTo(w)
 		return
@@ -169,8 +183,8 @@ func handlePubkeyJwt(w http.ResponseWriter, r *http.Request) {
 	NewOkResp(json.RawMessage(token)).WriteTo(w)
 }
 
-func handleSig(w http.ResponseWriter, r *http.Request) {
-	if suspended.Load() != nil {
+func (op *Operator) handleSig(w http.ResponseWriter, r *http.Request) {
+	if op.isSuspended() {
 		NewErrResp("suspended").WriteTo(w)
 		return
 	}
@@ -182,21 +196,22 @@ func handleSig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sig, err := signer.getSig(hash)
+	sig, err := op.signer.getSig(hash)
 	if err != nil {
 		NewErrResp("no signature found:" + err.Error()).WriteTo(w)
 		return
 	}
+	op.signer.markServed(strings.TrimPrefix(hash, "0x"), r)
 
 	NewOkResp("0x" + hex.EncodeToString(sig)).WriteTo(w)
 }
 
-func handleOpInfo(w http.ResponseWriter, r *http.Request) {
+func (op *Operator) handleOpInfo(w http.ResponseWriter, r *http.Request) {
 	opInfo := &OpInfo{}
-	signer.fillMonitorsAndNodesInfo(opInfo)
+	op.signer.fillMonitorsAndNodesInfo(opInfo)
 
 	opInfo.Status = "ok"
-	if suspended.Load() != nil {
+	if op.isSuspended() {
 		opInfo.Status = "suspended"
 	}
 
@@ -204,7 +219,7 @@ func handleOpInfo(w http.ResponseWriter, r *http.Request) {
 }
 
 // only monitors can call this
-func handleSuspend(w http.ResponseWriter, r *http.Request) {
+func (op *Operator) handleSuspend(w http.ResponseWriter, r *http.Request) {
 	sig := utils.GetQueryParam(r, "sig")
 	ts := utils.GetQueryParam(r, "ts")
 
@@ -221,12 +236,12 @@ func handleSuspend(w http.ResponseWriter, r *http.Request) {
 		NewErrResp(err.Error()).WriteTo(w)
 		return
 	}
-	if err := checkSig(ts, sig); err != nil {
+	if err := op.checkSig(ts, sig); err != nil {
 		NewErrResp(err.Error()).WriteTo(w)
 		return
 	}
 
-	suspended.Store(true)
+	op.suspend()
 	NewOkResp("ok").WriteTo(w)
 }
 func parseAndCheckTs(tsParam string) error {
@@ -244,8 +259,8 @@ func parseAndCheckTs(tsParam string) error {
 	}
 	return nil
 }
-func checkSig(ts, sig string) error {
-	pk := "0x" + hex.EncodeToString(pubKeyBytes)
+func (op *Operator) checkSig(ts, sig string) error {
+	pk := "0x" + hex.EncodeToString(op.pubKeyBytes)
 	hash := gethacc.TextHash([]byte(pk + "," + ts))
 	pbk, err := crypto.SigToPub(hash[:], gethcmn.FromHex(sig))
 	if err != nil {
@@ -253,46 +268,48 @@ func checkSig(ts, sig string) error {
 	}
 
 	addr := crypto.PubkeyToAddress(*pbk)
-	if !signer.isMonitor(addr) {
+	if !op.signer.isMonitor(addr) {
 		return errNotMonitor
 	}
 
 	return nil
 }
 
-func handleGetRedeemingUtxosForOperators(w http.ResponseWriter, r *http.Request) {
-	utxos, err := signer.sbchClient.currClusterClient.GetRedeemingUtxosForOperators()
-	if integrationTestMode && withChaos && err == nil {
-		if n := len(utxos); n > 0 {
-			utxos = utxos[:n-1]
-		}
+// handleCcInfo serves the CcInfo read by the last membership check
+func (op *Operator) handleCcInfo(w http.ResponseWriter, r *http.Request) {
+	snapshot := op.signer.ccInfo.Load()
+	if snapshot == nil {
+		NewErrResp("CcInfo not fetched yet").WriteTo(w)
+		return
 	}
-	NewResp(utxos, err).WriteTo(w)
+	result := *snapshot
+	result.Stale = time.Since(time.Unix(snapshot.FetchedTime, 0)) > ccInfoStaleAfter
+	NewOkResp(result).WriteTo(w)
 }
-func handleGetRedeemingUtxosForMonitors(w http.ResponseWriter, r *http.Request) {
-	utxos, err := signer.sbchClient.currClusterClient.GetRedeemingUtxosForMonitors()
-	if integrationTestMode && withChaos && err == nil {
-		if n := len(utxos); n > 0 {
-			utxos = utxos[:n-1]
-		}
-	}
-	NewResp(utxos, err).WriteTo(w)
+
+func (op *Operator) handleGetRedeemingUtxosForOperators(w http.ResponseWriter, r *http.Request) {
+	op.handleUtxoList(w, r, op.signer.loadUtxoList(func(snapshot *UtxosSnapshot) []*sbchrpctypes.UtxoInfo {
+		return snapshot.RedeemingUtxos4Op
+	}))
 }
-func handleGetToBeConvertedUtxosForOperators(w http.ResponseWriter, r *http.Request) {
-	utxos, err := signer.sbchClient.currClusterClient.GetToBeConvertedUtxosForOperators()
-	if integrationTestMode && withChaos && err == nil {
-		if n := len(utxos); n > 0 {
-			utxos = utxos[:n-1]
-		}
-	}
-	NewResp(utxos, err).WriteTo(w)
+func (op *Operator) handleGetRedeemingUtxosForMonitors(w http.ResponseWriter, r *http.Request) {
+	op.handleUtxoList(w, r, op.signer.loadUtxoList(func(snapshot *UtxosSnapshot) []*sbchrpctypes.UtxoInfo {
+		return snapshot.RedeemingUtxos4Mo
+	}))
 }
-func handleGetToBeConvertedUtxosForMonitors(w http.ResponseWriter, r *http.Request) {
-	utxos, err := signer.sbchClient.currClusterClient.GetToBeConvertedUtxosForMonitors()
-	if integrationTestMode && withChaos && err == nil {
-		if n := len(utxos); n > 0 {
-			utxos = utxos[:n-1]
-		}
-	}
-	NewResp(utxos, err).WriteTo(w)
+func (op *Operator) handleGetToBeConvertedUtxosForOperators(w http.ResponseWriter, r *http.Request) {
+	op.handleUtxoList(w, r, op.signer.loadUtxoList(func(snapshot *UtxosSnapshot) []*sbchrpctypes.UtxoInfo {
+		return snapshot.ToBeConvertedUtxos4Op
+	}))
+}
+func (op *Operator) handleGetToBeConvertedUtxosForMonitors(w http.ResponseWriter, r *http.Request) {
+	op.handleUtxoList(w, r, op.signer.loadUtxoList(func(snapshot *UtxosSnapshot) []*sbchrpctypes.UtxoInfo {
+		return snapshot.ToBeConvertedUtxos4Mo
+	}))
+}
+func (op *Operator) handleGetRedeemableUtxos(w http.ResponseWriter, r *http.Request) {
+	op.handleUtxoList(w, r, loadInfoUtxoList(&op.signer.redeemableUtxos))
+}
+func (op *Operator) handleGetLostAndFoundUtxos(w http.ResponseWriter, r *http.Request) {
+	op.handleUtxoList(w, r, loadInfoUtxoList(&op.signer.lostAndFoundUtxos))
 }
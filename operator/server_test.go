@@ -1,12 +1,16 @@
 package operator
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -16,19 +20,23 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/stretchr/testify/require"
 
+	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
+
 	"github.com/smartbch/cc-operator/sbch"
 	"github.com/smartbch/cc-operator/utils"
 )
 
+var testOp *Operator
+
 func TestInit(t *testing.T) {
 	sbchClient := &sbchRpcClient{}
-	signer = newSigner(nil, sbchClient)
+	testOp = &Operator{signer: newSigner(nil, sbchClient)}
 }
 
 func TestHandleCert(t *testing.T) {
-	oldCertBytes := certBytes
-	certBytes = []byte{0x12, 0x34}
-	defer func() { certBytes = oldCertBytes }()
+	oldCertBytes := testOp.certBytes
+	testOp.certBytes = []byte{0x12, 0x34}
+	defer func() { testOp.certBytes = oldCertBytes }()
 
 	require.Equal(t, `{"success":true,"result":"0x1234"}`,
 		mustCallHandler("/cert"))
@@ -41,9 +49,9 @@ func TestHandleCertReport(t *testing.T) {
 }
 
 func TestHandlePubKey(t *testing.T) {
-	oldPubkeyBytes := pubKeyBytes
-	pubKeyBytes = []byte{0x12, 0x34}
-	defer func() { pubKeyBytes = oldPubkeyBytes }()
+	oldPubkeyBytes := testOp.pubKeyBytes
+	testOp.pubKeyBytes = []byte{0x12, 0x34}
+	defer func() { testOp.pubKeyBytes = oldPubkeyBytes }()
 
 	require.Equal(t, `{"success":true,"result":"0x1234"}`,
 		mustCallHandler("/pubkey"))
@@ -67,8 +75,14 @@ func TestHandleSig(t *testing.T) {
 			mustCallHandler(path))
 	}
 
-	require.NoError(t, signer.sigCache.Set("1234", []byte{0x56, 0x78}))
-	_ = signer.timeCache.Set("1234", utils.GetTimestampFromTSC()-10)
+	require.NoError(t, testOp.signer.sigCache.Set("1234", &sigRecord{sig: []byte{0x56, 0x78}, flow: flowRedeem}))
+	_ = testOp.signer.timeCache.Set("1234", utils.GetTimestampFromTSC()-10)
+
+	// only elected operator signs
+	require.Equal(t, `{"success":false,"error":"no signature found:can not sign, membership: unknown"}`,
+		mustCallHandler("/sig?hash=1234"))
+	testOp.signer.membership.Store(&Membership{Status: MembershipElected}) // zero covenant address
+	defer testOp.signer.membership.Store(nil)
 
 	for _, path := range []string{"/sig?hash=0x4321", "/sig?hash=4321"} {
 		require.Equal(t, `{"success":false,"error":"no signature found:Key not found."}`,
@@ -82,64 +96,64 @@ func TestHandleSig(t *testing.T) {
 }
 
 func TestHandleCurrNodes(t *testing.T) {
-	_currClusterClient := signer.sbchClient.currClusterClient
-	signer.sbchClient.currClusterClient = &sbch.ClusterClient{
-		PublicNodes: []sbch.NodeInfo{
-			{
-				ID:      1234,
-				PbkHash: [32]byte{0xce, 0x12, 0x34},
-				RpcUrl:  "rpc1234",
-				Intro:   "node1234",
+	_state := testOp.signer.sbchClient.loadState()
+	testOp.signer.sbchClient.updateState(func(state *nodesState) {
+		state.currClusterClient = &sbch.ClusterClient{
+			PublicNodes: []sbch.NodeInfo{
+				{
+					ID:      1234,
+					PbkHash: [32]byte{0xce, 0x12, 0x34},
+					RpcUrl:  "rpc1234",
+					Intro:   "node1234",
+				},
 			},
-		},
-	}
-	defer func() { signer.sbchClient.currClusterClient = _currClusterClient }()
+		}
+	})
+	defer testOp.signer.sbchClient.state.Store(_state)
 
-	expected := `{"success":true,"result":{"status":"ok","currNodes":[{"id":1234,"pbkHash":"0xce12340000000000000000000000000000000000000000000000000000000000","rpcUrl":"rpc1234","intro":"node1234"}]}}`
+	expected := `{"success":true,"result":{"status":"ok","currNodes":[{"id":1234,"pbkHash":"0xce12340000000000000000000000000000000000000000000000000000000000","rpcUrl":"rpc1234","intro":"node1234"}],"membership":{"status":"unknown"}}}`
 	require.Equal(t, expected, mustCallHandler("/info"))
 }
 
 func TestHandleNewNodes(t *testing.T) {
-	_currClusterClient := signer.sbchClient.currClusterClient
-	signer.sbchClient.currClusterClient = &sbch.ClusterClient{
-		PublicNodes: []sbch.NodeInfo{
-			{
-				ID:      1234,
-				PbkHash: [32]byte{0xce, 0x12, 0x34},
-				RpcUrl:  "rpc1234",
-				Intro:   "node1234",
+	_state := testOp.signer.sbchClient.loadState()
+	testOp.signer.sbchClient.updateState(func(state *nodesState) {
+		state.currClusterClient = &sbch.ClusterClient{
+			PublicNodes: []sbch.NodeInfo{
+				{
+					ID:      1234,
+					PbkHash: [32]byte{0xce, 0x12, 0x34},
+					RpcUrl:  "rpc1234",
+					Intro:   "node1234",
+				},
 			},
-		},
-	}
-	_newClusterClient := signer.sbchClient.newClusterClient
-	signer.sbchClient.nodesChangedTime = time.Unix(1671681687, 0)
-	signer.sbchClient.newClusterClient = &sbch.ClusterClient{
-		PublicNodes: []sbch.NodeInfo{
-			{
-				ID:      2345,
-				PbkHash: [32]byte{0xce, 0x23, 0x45},
-				RpcUrl:  "rpc2345",
-				Intro:   "node2345",
+		}
+		state.nodesChangedTime = time.Unix(1671681687, 0)
+		state.newClusterClient = &sbch.ClusterClient{
+			PublicNodes: []sbch.NodeInfo{
+				{
+					ID:      2345,
+					PbkHash: [32]byte{0xce, 0x23, 0x45},
+					RpcUrl:  "rpc2345",
+					Intro:   "node2345",
+				},
 			},
-		},
-	}
-	defer func() {
-		signer.sbchClient.currClusterClient = _currClusterClient
-		signer.sbchClient.newClusterClient = _newClusterClient
-	}()
+		}
+	})
+	defer testOp.signer.sbchClient.state.Store(_state)
 
-	expected := `{"success":true,"result":{"status":"ok","currNodes":[{"id":1234,"pbkHash":"0xce12340000000000000000000000000000000000000000000000000000000000","rpcUrl":"rpc1234","intro":"node1234"}],"newNodes":[{"id":2345,"pbkHash":"0xce23450000000000000000000000000000000000000000000000000000000000","rpcUrl":"rpc2345","intro":"node2345"}],"nodesChangedTime":1671681687}}`
+	expected := `{"success":true,"result":{"status":"ok","currNodes":[{"id":1234,"pbkHash":"0xce12340000000000000000000000000000000000000000000000000000000000","rpcUrl":"rpc1234","intro":"node1234"}],"newNodes":[{"id":2345,"pbkHash":"0xce23450000000000000000000000000000000000000000000000000000000000","rpcUrl":"rpc2345","intro":"node2345"}],"nodesChangedTime":1671681687,"membership":{"status":"unknown"}}}`
 	require.Equal(t, expected, mustCallHandler("/info"))
 }
 
 func TestHandleStats(t *testing.T) {
-	require.Equal(t, `{"success":true,"result":{"status":"ok"}}`,
+	require.Equal(t, `{"success":true,"result":{"status":"ok","membership":{"status":"unknown"}}}`,
 		mustCallHandler("/info"))
 
-	suspended.Store(true)
-	defer func() { suspended = atomic.Value{} }()
+	testOp.suspended.Store(true)
+	defer func() { testOp.suspended = atomic.Value{} }()
 
-	require.Equal(t, `{"success":true,"result":{"status":"suspended"}}`,
+	require.Equal(t, `{"success":true,"result":{"status":"suspended","membership":{"status":"unknown"}}}`,
 		mustCallHandler("/info"))
 	require.Equal(t, `{"success":false,"error":"suspended"}`,
 		mustCallHandler("/sig?hash=1234"))
@@ -162,17 +176,20 @@ func TestHandleSuspend(t *testing.T) {
 	key3, _ := genKeyAndAddr()
 
 	ts := time.Now().Unix()
-	pk := "0x" + hex.EncodeToString(pubKeyBytes)
+	pk := "0x" + hex.EncodeToString(testOp.pubKeyBytes)
 	sig1, _ := crypto.Sign(gethacc.TextHash([]byte(fmt.Sprintf("%s,%d", pk, ts))), key1)
 	sig3, _ := crypto.Sign(gethacc.TextHash([]byte(fmt.Sprintf("%s,%d", pk, ts))), key3)
 
-	signer.sbchClient.allMonitorMap = map[gethcmn.Address]bool{
-		addr1: true,
-		addr2: true,
-	}
+	_state := testOp.signer.sbchClient.loadState()
+	testOp.signer.sbchClient.updateState(func(state *nodesState) {
+		state.allMonitorMap = map[gethcmn.Address]bool{
+			addr1: true,
+			addr2: true,
+		}
+	})
 	defer func() {
-		signer.sbchClient.allMonitorMap = map[gethcmn.Address]bool{}
-		suspended = atomic.Value{}
+		testOp.signer.sbchClient.state.Store(_state)
+		testOp.suspended = atomic.Value{}
 	}()
 
 	require.Equal(t, `{"success":false,"error":"not monitor"}`,
@@ -181,7 +198,7 @@ func TestHandleSuspend(t *testing.T) {
 	// ok
 	require.Equal(t, `{"success":true,"result":"ok"}`,
 		mustCallHandler(fmt.Sprintf("/suspend?sig=%s&ts=%d", hex.EncodeToString(sig1), ts)))
-	require.True(t, suspended.Load().(bool))
+	require.True(t, testOp.suspended.Load().(bool))
 }
 
 func mustCallHandler(path string) string {
@@ -195,7 +212,7 @@ func callHandler(path string) (string, error) {
 	r := httptest.NewRequest(http.MethodGet, path, nil)
 	w := httptest.NewRecorder()
 
-	mux := createHttpHandlers()
+	mux := testOp.createHttpHandlers()
 	mux.ServeHTTP(w, r)
 
 	res := w.Result()
@@ -203,9 +220,309 @@ func callHandler(path string) (string, error) {
 	data, err := io.ReadAll(res.Body)
 	return string(data), err
 }
+func callMuxHandler(mux http.Handler, path string) string {
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w.Body.String()
+}
 
 func genKeyAndAddr() (*ecdsa.PrivateKey, gethcmn.Address) {
 	key, _ := crypto.GenerateKey()
 	addr := crypto.PubkeyToAddress(key.PublicKey)
 	return key, addr
 }
+
+func TestMultiOperatorHandlers(t *testing.T) {
+	op1 := &Operator{pubKeyBytes: []byte{0x12, 0x34}, signer: newSigner(nil, &sbchRpcClient{})}
+	op2 := &Operator{pubKeyBytes: []byte{0x56, 0x78}, signer: newSigner(nil, &sbchRpcClient{})}
+	op2.suspended.Store(true)
+	mux := createMultiHttpHandlers(map[string]*Operator{"mainnet": op1, "/testnet/": op2})
+
+	require.Equal(t, `{"success":true,"result":"0x1234"}`, callMuxHandler(mux, "/mainnet/pubkey"))
+	require.Equal(t, `{"success":true,"result":"0x5678"}`, callMuxHandler(mux, "/testnet/pubkey"))
+	require.Equal(t, `{"success":true,"result":{"status":"ok","membership":{"status":"unknown"}}}`, callMuxHandler(mux, "/mainnet/info"))
+	require.Equal(t, `{"success":true,"result":{"status":"suspended","membership":{"status":"unknown"}}}`, callMuxHandler(mux, "/testnet/info"))
+}
+
+func TestHandleMetrics(t *testing.T) {
+	chain := newFakeChain()
+	node1, node2 := newFakeSbchd(chain), newFakeSbchd(chain)
+	defer node1.close()
+	chain.setNodes(node1, node2)
+
+	client, err := newSbchClient(context.Background(), fakeNodesGovAddr, []string{node1.url()}, nil,
+		"", sbch.ChainPolicy{}, sbch.EnclavePolicy{})
+	require.NoError(t, err)
+	op := &Operator{signer: newSigner(nil, client)}
+	mux := op.createHttpHandlers()
+
+	// node2 is dead
+	node2.close()
+	_, err = client.getUtxosSnapshot(context.Background())
+	require.Error(t, err)
+
+	metrics := callMuxHandler(mux, "/metrics")
+	require.Contains(t, metrics, "cc_operator_suspended 0\n")
+	require.Contains(t, metrics, fmt.Sprintf(`cc_operator_sbchd_node_breaker_state{node="%s",state="closed"} 1`, node1.url()))
+	require.Contains(t, metrics, fmt.Sprintf(`cc_operator_sbchd_node_retries_total{node="%s"} %d`, node2.url(), 2))
+
+	info := callMuxHandler(mux, "/info")
+	require.Contains(t, info, fmt.Sprintf(`{"rpcUrl":"%s","state":"closed","consecutiveFailures":3,`, node2.url()))
+}
+
+func TestHandleDisagreements(t *testing.T) {
+	chain1, chain2 := newFakeChain(), newFakeChain()
+	node1, node2 := newFakeSbchd(chain1), newFakeSbchd(chain2)
+	defer node1.close()
+	defer node2.close()
+	chain1.setNodes(node1)
+	chain2.setNodes(node1)
+	chain1.setUtxos("sbch_getRedeemingUtxosForOperators",
+		&sbchrpctypes.UtxoInfo{Txid: gethcmn.Hash{0x01}, TxSigHash: []byte{0x01}})
+
+	// node2 is a private node which does not see the utxo
+	client, err := newSbchClient(context.Background(), fakeNodesGovAddr, []string{node1.url()},
+		[]string{node2.url()}, "", sbch.ChainPolicy{}, sbch.EnclavePolicy{})
+	require.NoError(t, err)
+	op := &Operator{signer: newSigner(nil, client)}
+	mux := op.createHttpHandlers()
+
+	require.Equal(t, `{"success":true,"result":[]}`, callMuxHandler(mux, "/diagnostics/disagreements"))
+
+	_, err = client.getUtxosSnapshot(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "response not match between:")
+
+	resp := callMuxHandler(mux, "/diagnostics/disagreements")
+	require.Contains(t, resp, `"method":"GetRedeemingUtxosForOperators"`)
+	require.Contains(t, resp, fmt.Sprintf(`"groups":[["%s"],["%s"]]`, node1.url(), node2.url()))
+	require.Contains(t, resp, fmt.Sprintf(`"missing":["%s:0"]`, gethcmn.Hash{0x01}.Hex()))
+
+	require.Equal(t, `{"success":true,"result":[]}`,
+		callMuxHandler(mux, "/diagnostics/disagreements?method=GetMonitors"))
+	require.Equal(t, `{"success":false,"error":"invalid query parameter: limit"}`,
+		callMuxHandler(mux, "/diagnostics/disagreements?limit=x"))
+}
+
+func TestDisagreementLog(t *testing.T) {
+	var dl disagreementLog
+	for i := 0; i < maxDisagreementReports+10; i++ {
+		dl.add(&sbch.Disagreement{Time: int64(i), Method: "GetMonitors"})
+	}
+	require.Len(t, dl.reports, maxDisagreementReports)
+
+	reports := dl.query("", 0, 3)
+	require.Len(t, reports, 3)
+	require.Equal(t, int64(maxDisagreementReports+9), reports[0].Time)
+	require.Len(t, dl.query("GetMonitors", maxDisagreementReports+5, 0), 5)
+	require.Len(t, dl.query("GetSbchdNodes", 0, 0), 0)
+}
+
+func TestHandleCcInfo(t *testing.T) {
+	chain1, chain2 := newFakeChain(), newFakeChain()
+	node1, node2 := newFakeSbchd(chain1), newFakeSbchd(chain2)
+	defer node1.close()
+	defer node2.close()
+	chain1.setNodes(node1)
+	chain2.setNodes(node1)
+	chain1.setMonitors(gethcmn.Address{0x01})
+	chain2.setMonitors(gethcmn.Address{0x01})
+
+	client, err := newSbchClient(context.Background(), fakeNodesGovAddr, []string{node1.url()},
+		[]string{node2.url()}, "", sbch.ChainPolicy{}, sbch.EnclavePolicy{})
+	require.NoError(t, err)
+	op := &Operator{signer: newSigner(nil, client)}
+	mux := op.createHttpHandlers()
+	require.Equal(t, `{"success":false,"error":"CcInfo not fetched yet"}`, callMuxHandler(mux, "/cc-info"))
+
+	op.signer.checkMembership(context.Background())
+	resp := callMuxHandler(mux, "/cc-info")
+	require.Contains(t, resp, `{"success":true,"result":{"height":100,"fetchedTime":`)
+	require.Contains(t, resp, `"stale":false,"ccInfo":{`)
+	require.Contains(t, resp, fmt.Sprintf(`"monitors":[{"address":"%s"`, gethcmn.Address{0x01}.Hex()))
+	require.Contains(t, resp, `"signature":"0x"`) // per-node signature dropped
+
+	// the height is the minimum of the nodes
+	chain2.setLatestBlock(99, time.Now())
+	op.signer.checkMembership(context.Background())
+	require.Contains(t, callMuxHandler(mux, "/cc-info"), `"height":99`)
+
+	// the nodes disagree, the last snapshot is kept
+	chain2.setMonitors(gethcmn.Address{0x02})
+	op.signer.checkMembership(context.Background())
+	require.Contains(t, callMuxHandler(mux, "/cc-info"), `"height":99`)
+	snapshot := *op.signer.ccInfo.Load()
+	snapshot.FetchedTime -= int64(ccInfoStaleAfter/time.Second) + 1
+	op.signer.ccInfo.Store(&snapshot)
+	require.Contains(t, callMuxHandler(mux, "/cc-info"), `"stale":true`)
+}
+
+func TestHandleUtxoList(t *testing.T) {
+	chain := newFakeChain()
+	node1 := newFakeSbchd(chain)
+	chain.setNodes(node1)
+	chain.setUtxos("sbch_getToBeConvertedUtxosForMonitors",
+		&sbchrpctypes.UtxoInfo{Txid: gethcmn.Hash{0x01}, TxSigHash: []byte{0x01}})
+	chain.setUtxos("sbch_getRedeemableUtxos", &sbchrpctypes.UtxoInfo{Txid: gethcmn.Hash{0x02}})
+	chain.setUtxos("sbch_getLostAndFoundUtxos", &sbchrpctypes.UtxoInfo{Txid: gethcmn.Hash{0x03}})
+
+	client, err := newSbchClient(context.Background(), fakeNodesGovAddr, []string{node1.url()}, nil,
+		"", sbch.ChainPolicy{}, sbch.EnclavePolicy{})
+	require.NoError(t, err)
+	op := &Operator{signer: newSigner(nil, client)}
+	mux := op.createHttpHandlers()
+
+	require.Equal(t, `{"success":false,"error":"UTXOs not fetched yet"}`,
+		callMuxHandler(mux, "/to-be-converted-utxos-for-monitors"))
+	snapshot, err := op.signer.pollUtxos(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, `{"success":false,"error":"UTXOs not fetched yet"}`, callMuxHandler(mux, "/redeemable-utxos"))
+	op.signer.pollInfoUtxos(context.Background())
+
+	// the nodes are not queried by the handlers
+	node1.close()
+	resp := callMuxHandler(mux, "/to-be-converted-utxos-for-monitors?meta=true")
+	require.Contains(t, resp, fmt.Sprintf(`{"success":true,"result":{"height":100,"fetchedTime":%d,"stale":false,"utxos":[{`,
+		snapshot.FetchedTime.Unix()))
+	require.Contains(t, resp, fmt.Sprintf(`"txid":"%s"`, gethcmn.Hash{0x01}.Hex()))
+	require.Contains(t, callMuxHandler(mux, "/redeeming-utxos-for-operators?meta=true"), `"stale":false,"utxos":[]}`)
+	require.Contains(t, callMuxHandler(mux, "/redeemable-utxos"), fmt.Sprintf(`"txid":"%s"`, gethcmn.Hash{0x02}.Hex()))
+	resp = callMuxHandler(mux, "/lost-and-found-utxos?meta=true")
+	require.Contains(t, resp, `"height":100,`)
+	require.Contains(t, resp, fmt.Sprintf(`"txid":"%s"`, gethcmn.Hash{0x03}.Hex()))
+	require.Equal(t, `{"success":false,"error":"invalid query parameter: meta"}`,
+		callMuxHandler(mux, "/redeeming-utxos-for-operators?meta=x"))
+
+	// the redeemable and lost-and-found UTXOs are kept if they can not be fetched
+	op.signer.pollInfoUtxos(context.Background())
+	resp = callMuxHandler(mux, "/redeemable-utxos?meta=true")
+	require.Contains(t, resp, `"height":100,`)
+	require.Contains(t, resp, `"stale":true,`)
+	require.Contains(t, resp, fmt.Sprintf(`"txid":"%s"`, gethcmn.Hash{0x02}.Hex()))
+	require.Contains(t, callMuxHandler(mux, "/redeeming-utxos-for-operators?meta=true"), `"stale":false,`)
+
+	// without meta, only the list is returned, the others are in the headers
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/to-be-converted-utxos-for-monitors", nil))
+	require.Contains(t, w.Body.String(), `{"success":true,"result":[{`)
+	require.Equal(t, "100", w.Header().Get("X-Utxos-Height"))
+	require.Equal(t, strconv.FormatInt(snapshot.FetchedTime.Unix(), 10), w.Header().Get("X-Utxos-Fetched-Time"))
+	require.Equal(t, "false", w.Header().Get("X-Utxos-Stale"))
+	require.Empty(t, w.Header().Get("X-Next-Cursor"))
+	bareEtag := w.Header().Get("ETag")
+
+	// conditional requests
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/to-be-converted-utxos-for-monitors?meta=true", nil))
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	r := httptest.NewRequest(http.MethodGet, "/to-be-converted-utxos-for-monitors?meta=true", nil)
+	r.Header.Set("If-None-Match", `"x", `+etag)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	require.Equal(t, http.StatusNotModified, w.Code)
+	require.Empty(t, w.Body.String())
+
+	// polling has been failing
+	staleSnapshot := *snapshot
+	staleSnapshot.FetchedTime = snapshot.FetchedTime.Add(-utxosStaleAfter - time.Second)
+	op.signer.utxos.Store(&staleSnapshot)
+	r = httptest.NewRequest(http.MethodGet, "/to-be-converted-utxos-for-monitors?meta=true", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	require.Equal(t, http.StatusNotModified, w.Code)
+	require.Equal(t, etag, w.Header().Get("ETag"))
+	require.Equal(t, "true", w.Header().Get("X-Utxos-Stale"))
+	require.Contains(t, callMuxHandler(mux, "/to-be-converted-utxos-for-monitors?meta=true"), `"stale":true`)
+
+	// the list is not changed, but the headers of 304 tell it is stale
+	r = httptest.NewRequest(http.MethodGet, "/to-be-converted-utxos-for-monitors", nil)
+	r.Header.Set("If-None-Match", bareEtag)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	require.Equal(t, http.StatusNotModified, w.Code)
+	require.Equal(t, "true", w.Header().Get("X-Utxos-Stale"))
+}
+
+func TestHandleUtxoListQuery(t *testing.T) {
+	covenant1, covenant2 := gethcmn.Address{0xc1}, gethcmn.Address{0xc2}
+	target := gethcmn.Address{0xaa}
+	utxos := []*sbchrpctypes.UtxoInfo{
+		{Txid: gethcmn.Hash{0x01}, Index: 0, CovenantAddr: covenant1, Amount: 100},
+		{Txid: gethcmn.Hash{0x01}, Index: 1, CovenantAddr: covenant1, Amount: 200, IsRedeemed: true, RedeemTarget: target},
+		{Txid: gethcmn.Hash{0x02}, Index: 0, CovenantAddr: covenant2, Amount: 300, IsRedeemed: true, RedeemTarget: target},
+		{Txid: gethcmn.Hash{0x03}, Index: 0, CovenantAddr: covenant1, Amount: 400},
+	}
+	op := &Operator{signer: newSigner(nil, &sbchRpcClient{})}
+	op.signer.utxos.Store(&UtxosSnapshot{Height: 10, FetchedTime: time.Now(), RedeemingUtxos4Op: utxos})
+	op.signer.redeemableUtxos.Store(&InfoUtxosSnapshot{Height: 10, FetchedTime: time.Now(), Utxos: utxos})
+	op.signer.lostAndFoundUtxos.Store(&InfoUtxosSnapshot{Height: 10, FetchedTime: time.Now(), Utxos: utxos})
+	mux := op.createHttpHandlers()
+
+	getListAt := func(path, query string) UtxoList {
+		resp := UnmarshalResp([]byte(callMuxHandler(mux, path+"?meta=true&"+strings.TrimPrefix(query, "?"))))
+		require.True(t, resp.Success, resp.Error)
+		var list UtxoList
+		bz, _ := json.Marshal(resp.Result)
+		require.NoError(t, json.Unmarshal(bz, &list))
+		return list
+	}
+	getList := func(query string) UtxoList {
+		return getListAt("/redeeming-utxos-for-operators", query)
+	}
+	indexes := func(list UtxoList) (result []int) {
+		for _, utxo := range list.Utxos {
+			for i := range utxos {
+				if utxo.Txid == utxos[i].Txid && utxo.Index == utxos[i].Index {
+					result = append(result, i)
+				}
+			}
+		}
+		return
+	}
+
+	require.Equal(t, []int{0, 1, 2, 3}, indexes(getList("")))
+	require.Equal(t, []int{0, 1, 3}, indexes(getList("?covenantAddr="+covenant1.Hex())))
+	require.Equal(t, []int{1, 2}, indexes(getList("?redeemTarget="+target.Hex())))
+	require.Equal(t, []int{0, 1}, indexes(getList("?txid="+gethcmn.Hash{0x01}.Hex())))
+	require.Equal(t, []int{1, 2}, indexes(getList("?minAmount=200&maxAmount=300")))
+	require.Equal(t, []int{0, 3}, indexes(getList("?isRedeemed=false")))
+	require.Empty(t, getList("?covenantAddr="+covenant2.Hex()+"&isRedeemed=false").Utxos)
+
+	// pages of the UTXOs on covenant1
+	list := getList("?covenantAddr=" + covenant1.Hex() + "&limit=2")
+	require.Equal(t, []int{0, 1}, indexes(list))
+	require.Equal(t, gethcmn.Hash{0x01}.Hex()+":1", list.NextCursor)
+	list = getList("?covenantAddr=" + covenant1.Hex() + "&limit=2&cursor=" + list.NextCursor)
+	require.Equal(t, []int{3}, indexes(list))
+	require.Empty(t, list.NextCursor)
+	list = getList("?limit=4")
+	require.Len(t, list.Utxos, 4)
+	require.Empty(t, list.NextCursor)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/redeeming-utxos-for-operators?limit=3", nil))
+	require.Equal(t, gethcmn.Hash{0x02}.Hex()+":0", w.Header().Get("X-Next-Cursor"))
+
+	// the same filters and pages on the redeemable and lost-and-found UTXOs
+	for _, path := range []string{"/redeemable-utxos", "/lost-and-found-utxos"} {
+		list = getListAt(path, "?isRedeemed=false&limit=1")
+		require.Equal(t, []int{0}, indexes(list), path)
+		list = getListAt(path, "?isRedeemed=false&limit=1&cursor="+list.NextCursor)
+		require.Equal(t, []int{3}, indexes(list), path)
+		require.Empty(t, list.NextCursor, path)
+	}
+
+	// the cursor stays valid after the UTXO it points to is gone
+	op.signer.utxos.Store(&UtxosSnapshot{Height: 11, FetchedTime: time.Now(), RedeemingUtxos4Op: utxos[2:]})
+	list = getList("?limit=1&cursor=" + gethcmn.Hash{0x01}.Hex() + ":1")
+	require.Equal(t, []int{2}, indexes(list))
+	require.Equal(t, uint64(11), list.Height)
+
+	for _, param := range []string{"covenantAddr=0x12", "redeemTarget=x", "txid=0x01", "minAmount=-1",
+		"maxAmount=x", "isRedeemed=x", "cursor=0x01", "limit=0", "limit=1001"} {
+		name, _, _ := strings.Cut(param, "=")
+		require.Equal(t, `{"success":false,"error":"invalid query parameter: `+name+`"}`,
+			callMuxHandler(mux, "/redeeming-utxos-for-operators?"+param))
+	}
+}
@@ -0,0 +1,227 @@
+package operator
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
+
+	"github.com/smartbch/cc-operator/utils"
+)
+
+const (
+	SigEventReady     = "ready"     // the signature can be got from /sig
+	SigEventVetoed    = "vetoed"    // see SigStatusVetoed
+	SigEventRevoked   = "revoked"   // a ready signature is not served anymore
+	SigEventSuspended = "suspended" // the operator is suspended until it restarts, which is seen as SigEventReset
+
+	// the subscriber may have missed events, it should check the sigHashes it waits for with /sig-status
+	SigEventReset = "reset" // the operator has restarted, the kept events of the new epoch follow
+	SigEventGap   = "gap"   // Dropped events after the last one got are not kept anymore
+)
+
+// SigEvent is pushed by /sig-events, Seq increases by one for each event of the operator
+// and restarts from 1 in a new Epoch when the operator restarts.
+// The reset and gap events do not take a Seq, theirs is the one before the next event.
+type SigEvent struct {
+	Epoch   string `json:"epoch"`
+	Seq     uint64 `json:"seq"`
+	Type    string `json:"type"`
+	SigHash string `json:"sigHash,omitempty"`
+	Flow    string `json:"flow,omitempty"`
+	Dropped uint64 `json:"dropped,omitempty"` // only for reset and gap, the events of Epoch missed
+	Time    int64  `json:"time"`
+}
+
+// ID returns the SSE id of the event, which can be used to resume after it
+func (event *SigEvent) ID() string {
+	return formatSigEventID(event.Epoch, event.Seq)
+}
+
+func formatSigEventID(epoch string, seq uint64) string {
+	return epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+// parseSigEventID parses "<epoch>-<seq>", a plain seq has an empty epoch
+func parseSigEventID(id string) (string, uint64, error) {
+	epoch, seqStr, ok := strings.Cut(id, "-")
+	if !ok {
+		epoch, seqStr = "", id
+	}
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	return epoch, seq, err
+}
+
+// sigEventLog keeps the latest events, the zero value is ready to use
+type sigEventLog struct {
+	lock    sync.Mutex
+	epoch   string // random for each boot, so that seqs of different boots are told apart
+	events  []*SigEvent
+	lastSeq uint64
+	notify  chan struct{} // closed and replaced when an event is published
+}
+
+func (el *sigEventLog) initEpochLocked() {
+	if el.epoch == "" {
+		var bz [8]byte
+		_, _ = rand.Read(bz[:])
+		el.epoch = hex.EncodeToString(bz[:])
+	}
+}
+
+func (el *sigEventLog) publish(eventType, sigHash, flow string) {
+	el.lock.Lock()
+	defer el.lock.Unlock()
+
+	el.initEpochLocked()
+	el.lastSeq++
+	event := &SigEvent{Epoch: el.epoch, Seq: el.lastSeq, Type: eventType, SigHash: sigHash, Flow: flow, Time: time.Now().Unix()}
+	log.Info("sig event:", toJSON(event))
+	el.events = append(el.events, event)
+	if len(el.events) > maxSigEvents {
+		el.events = el.events[len(el.events)-maxSigEvents:]
+	}
+	if el.notify != nil {
+		close(el.notify)
+		el.notify = nil
+	}
+}
+
+// after returns the kept events after seq of epoch, and a channel closed when a new event is published.
+// If epoch is not the current one, or seq is ahead of the last one, the operator has restarted,
+// so all kept events are returned after a reset event. If some events after seq are not kept anymore,
+// the kept ones are returned after a gap event.
+func (el *sigEventLog) after(epoch string, seq uint64) ([]*SigEvent, <-chan struct{}) {
+	el.lock.Lock()
+	defer el.lock.Unlock()
+
+	el.initEpochLocked()
+	if el.notify == nil {
+		el.notify = make(chan struct{})
+	}
+	var notice *SigEvent
+	dropped := el.lastSeq - uint64(len(el.events)) // the seq of the last event not kept
+	if epoch != el.epoch || seq > el.lastSeq {
+		notice = &SigEvent{Epoch: el.epoch, Seq: dropped, Type: SigEventReset, Dropped: dropped, Time: time.Now().Unix()}
+		seq = dropped
+	} else if seq < dropped {
+		notice = &SigEvent{Epoch: el.epoch, Seq: dropped, Type: SigEventGap, Dropped: dropped - seq, Time: time.Now().Unix()}
+		seq = dropped
+	}
+
+	events := make([]*SigEvent, 0, el.lastSeq-seq+1)
+	if notice != nil {
+		events = append(events, notice)
+	}
+	return append(events, el.events[len(el.events)-int(el.lastSeq-seq):]...), el.notify
+}
+
+// last returns the epoch and the seq of the last event
+func (el *sigEventLog) last() (string, uint64) {
+	el.lock.Lock()
+	defer el.lock.Unlock()
+	el.initEpochLocked()
+	return el.epoch, el.lastSeq
+}
+
+// publishReady publishes the signed sigHashes which have just become ready
+func (signer *txSigner) publishReady(snapshot *UtxosSnapshot) {
+	for _, utxos := range [][]*sbchrpctypes.UtxoInfo{snapshot.RedeemingUtxos4Op, snapshot.ToBeConvertedUtxos4Op} {
+		for _, sigHashHex := range getSigHashes(utxos) {
+			record := signer.loadSigHashRecord(sigHashHex)
+			if record == nil || record.readyTime != 0 {
+				continue
+			}
+			if signer.getSigStatus(sigHashHex, false).Status != SigStatusReady {
+				continue
+			}
+			signer.updateSigHashRecord(sigHashHex, record.flow, func(record *sigHashRecord) {
+				record.readyTime = time.Now().Unix()
+			})
+			signer.events.publish(SigEventReady, sigHashHex, record.flow)
+			signer.auditSigHash(AuditReady, sigHashHex, record.flow)
+		}
+	}
+}
+
+// suspend stops serving signatures, there is no way to resume but restarting the operator
+func (op *Operator) suspend() {
+	if op.isSuspended() {
+		return
+	}
+	op.suspended.Store(true)
+	op.signer.events.publish(SigEventSuspended, "", "")
+}
+
+// handleSigEvents streams the events as Server-Sent Events, each of them has "<epoch>-<seq>" as the id.
+// The kept events after the id in the query parameter since, or the Last-Event-ID header, are sent first.
+func (op *Operator) handleSigEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		NewErrResp("streaming unsupported").WriteTo(w)
+		return
+	}
+
+	epoch, since := op.signer.events.last() // only the new events by default
+	sinceStr := utils.GetQueryParam(r, "since")
+	if sinceStr == "" {
+		sinceStr = r.Header.Get("Last-Event-ID")
+	}
+	if sinceStr != "" {
+		var err error
+		if epoch, since, err = parseSigEventID(sinceStr); err != nil {
+			NewErrResp("invalid query parameter: since").WriteTo(w)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	// the id lets the client resume from here even if no event is received
+	_, _ = fmt.Fprintf(w, "retry: %d\nid: %s\n\n", sigEventsRetryDelay.Milliseconds(), formatSigEventID(epoch, since))
+
+	// without a way to extend the write deadline of the server,
+	// the stream ends before it and the client reconnects
+	streamEnd := time.After(sigEventsFallbackStreamTime)
+	if extendWriteDeadline(w, sigEventsHeartbeat*2) {
+		streamEnd = nil
+	}
+	heartbeat := time.NewTicker(sigEventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		events, notify := op.signer.events.after(epoch, since)
+		for _, event := range events {
+			data, _ := json.Marshal(event)
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID(), event.Type, data); err != nil {
+				return
+			}
+			epoch, since = event.Epoch, event.Seq
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-streamEnd:
+			return
+		case <-notify:
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		if streamEnd == nil {
+			extendWriteDeadline(w, sigEventsHeartbeat*2)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package operator
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	"github.com/gcash/bchd/bchec"
+	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/cc-operator/utils"
+)
+
+func TestSigEventLog(t *testing.T) {
+	var el sigEventLog
+	epoch, seq := el.last()
+	require.Len(t, epoch, 16)
+	require.Zero(t, seq)
+	events, notify := el.after(epoch, 0)
+	require.Empty(t, events)
+
+	el.publish(SigEventReady, "01", flowRedeem)
+	el.publish(SigEventVetoed, "02", flowConvert)
+	select {
+	case <-notify:
+	default:
+		t.Fatal("not notified")
+	}
+	events, _ = el.after(epoch, 1)
+	require.Len(t, events, 1)
+	require.Equal(t, SigEvent{Epoch: epoch, Seq: 2, Type: SigEventVetoed, SigHash: "02", Flow: flowConvert, Time: events[0].Time}, *events[0])
+	require.Equal(t, epoch+"-2", events[0].ID())
+
+	// the operator has restarted
+	for _, id := range []string{"0123456789abcdef-1", "1", epoch + "-100"} {
+		oldEpoch, oldSeq, err := parseSigEventID(id)
+		require.NoError(t, err)
+		events, _ = el.after(oldEpoch, oldSeq)
+		require.Len(t, events, 3, id)
+		require.Equal(t, SigEvent{Epoch: epoch, Type: SigEventReset, Time: events[0].Time}, *events[0])
+		require.Equal(t, uint64(1), events[1].Seq)
+	}
+
+	for i := 0; i < maxSigEvents; i++ {
+		el.publish(SigEventReady, "03", flowRedeem)
+	}
+	_, seq = el.last()
+	require.Equal(t, uint64(maxSigEvents+2), seq)
+	events, _ = el.after(epoch, 1)
+	require.Len(t, events, maxSigEvents+1)
+	require.Equal(t, SigEvent{Epoch: epoch, Seq: 2, Type: SigEventGap, Dropped: 1, Time: events[0].Time}, *events[0])
+	require.Equal(t, uint64(3), events[1].Seq)
+	events, _ = el.after("", 0)
+	require.Len(t, events, maxSigEvents+1)
+	require.Equal(t, SigEvent{Epoch: epoch, Seq: 2, Type: SigEventReset, Dropped: 2, Time: events[0].Time}, *events[0])
+	events, _ = el.after(epoch, 2)
+	require.Len(t, events, maxSigEvents)
+	require.Equal(t, uint64(3), events[0].Seq)
+
+	_, _, err := parseSigEventID(epoch + "-x")
+	require.Error(t, err)
+}
+
+func TestHandleSigEvents(t *testing.T) {
+	key, err := bchec.NewPrivateKey(bchec.S256())
+	require.NoError(t, err)
+	signer := newSigner(key, &sbchRpcClient{})
+	covenantAddr := gethcmn.Address{0xc1}
+	signer.membership.Store(&Membership{Status: MembershipElected, currCovenant: covenantAddr})
+	op := &Operator{signer: signer}
+	server := httptest.NewServer(op.createHttpHandlers())
+	defer server.Close()
+
+	signer.events.publish(SigEventReady, "00", flowRedeem)
+	resp, err := http.Get(server.URL + "/sig-events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	scanner := bufio.NewScanner(resp.Body)
+	readBlock := func() string {
+		var lines []string
+		for scanner.Scan() && scanner.Text() != "" {
+			lines = append(lines, scanner.Text())
+		}
+		return strings.Join(lines, "\n")
+	}
+	epoch, _ := signer.events.last()
+	require.Equal(t, "retry: 1000\nid: "+epoch+"-1", readBlock()) // the old event is not sent
+
+	// UTXO 0x01 becomes ready, 0x02 is removed during the publicity period
+	utxo1, utxo2 := newTestUtxo(0x01, covenantAddr), newTestUtxo(0x02, covenantAddr)
+	snapshot1 := &UtxosSnapshot{
+		RedeemingUtxos4Mo: []*sbchrpctypes.UtxoInfo{utxo1, utxo2},
+		RedeemingUtxos4Op: []*sbchrpctypes.UtxoInfo{utxo1, utxo2},
+	}
+	signer.handleUtxos(nil, snapshot1)
+	require.NoError(t, signer.timeCache.Set("01", utils.GetTimestampFromTSC()-10))
+	signer.handleUtxos(snapshot1, &UtxosSnapshot{
+		RedeemingUtxos4Mo: []*sbchrpctypes.UtxoInfo{utxo1},
+		RedeemingUtxos4Op: []*sbchrpctypes.UtxoInfo{utxo1},
+	})
+	block := readBlock()
+	require.True(t, strings.HasPrefix(block, "id: "+epoch+"-2\nevent: vetoed\ndata: {\"epoch\":\""+epoch+"\",\"seq\":2,\"type\":\"vetoed\",\"sigHash\":\"02\",\"flow\":\"redeem\","), block)
+	block = readBlock()
+	require.True(t, strings.HasPrefix(block, "id: "+epoch+"-3\nevent: ready\ndata: {\"epoch\":\""+epoch+"\",\"seq\":3,\"type\":\"ready\",\"sigHash\":\"01\","), block)
+
+	// ready is only published once
+	signer.handleUtxos(snapshot1, &UtxosSnapshot{RedeemingUtxos4Op: []*sbchrpctypes.UtxoInfo{utxo1}})
+	op.suspend()
+	op.suspend()
+	block = readBlock()
+	require.True(t, strings.HasPrefix(block, "id: "+epoch+"-4\nevent: suspended\n"), block)
+	_, seq := signer.events.last()
+	require.Equal(t, uint64(4), seq)
+
+	// resume after a disconnect
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/sig-events", nil)
+	req.Header.Set("Last-Event-ID", epoch+"-2")
+	resp2, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp2.Body.Close()
+	scanner = bufio.NewScanner(resp2.Body)
+	require.Equal(t, "retry: 1000\nid: "+epoch+"-2", readBlock())
+	require.True(t, strings.HasPrefix(readBlock(), "id: "+epoch+"-3\nevent: ready\n"))
+	require.True(t, strings.HasPrefix(readBlock(), "id: "+epoch+"-4\nevent: suspended\n"))
+
+	// resume with the id of an earlier boot
+	resp3, err := http.Get(server.URL + "/sig-events?since=0123456789abcdef-9")
+	require.NoError(t, err)
+	defer resp3.Body.Close()
+	scanner = bufio.NewScanner(resp3.Body)
+	require.Equal(t, "retry: 1000\nid: 0123456789abcdef-9", readBlock())
+	block = readBlock()
+	require.True(t, strings.HasPrefix(block, "id: "+epoch+"-0\nevent: reset\ndata: {\"epoch\":\""+epoch+"\",\"seq\":0,\"type\":\"reset\","), block)
+	require.True(t, strings.HasPrefix(readBlock(), "id: "+epoch+"-1\nevent: ready\n"))
+
+	require.Equal(t, `{"success":false,"error":"invalid query parameter: since"}`,
+		callMuxHandler(op.createHttpHandlers(), "/sig-events?since=x"))
+}
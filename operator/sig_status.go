@@ -0,0 +1,296 @@
+package operator
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	log "github.com/sirupsen/logrus"
+	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
+
+	"github.com/smartbch/cc-operator/utils"
+)
+
+const (
+	SigStatusUnknown          = "unknown"           // never listed by the nodes
+	SigStatusPendingPublicity = "pending-publicity" // listed, the publicity period is not over
+	SigStatusReady            = "ready"             // the signature can be got from /sig
+	SigStatusVetoed           = "vetoed"            // removed from the monitors' lists during the publicity period
+	SigStatusSuspended        = "suspended"         // the operator is suspended by a monitor
+	SigStatusPolicyRejected   = "policy-rejected"   // this operator refuses to sign it, see Reason
+	SigStatusRevoked          = "revoked"           // not listed for operators for the grace period after being signed
+)
+
+// SigStatus explains whether /sig returns the signature of a sigHash
+type SigStatus struct {
+	SigHash      string        `json:"sigHash"`
+	Status       string        `json:"status"`
+	Reason       string        `json:"reason,omitempty"`
+	Flow         string        `json:"flow,omitempty"`
+	FirstSeen    int64         `json:"firstSeen,omitempty"`    // when the sigHash was first listed
+	ReadyAt      int64         `json:"readyAt,omitempty"`      // when the publicity period ends, 0 if not listed for monitors yet
+	VetoedTime   int64         `json:"vetoedTime,omitempty"`   // when it was found removed
+	UnlistedTime int64         `json:"unlistedTime,omitempty"` // when the signed sigHash was found not listed for operators
+	RevokedTime  int64         `json:"revokedTime,omitempty"`  // when it was revoked after the grace period
+	Sig          hexutil.Bytes `json:"sig,omitempty"`          // only if ready
+}
+
+// sigHashRecord is what seenCache keeps for a listed sigHash,
+// it is replaced instead of modified since the handlers may be reading it
+type sigHashRecord struct {
+	flow         string
+	firstSeen    int64 // unix time
+	vetoedTime   int64 // unix time
+	readyTime    int64 // unix time, when it was found ready by the signing loop
+	unlistedTime int64 // unix time, 0 if listed for operators
+	revokedTime  int64 // unix time
+	servedTime   int64 // unix time, when the signature was first served
+	rejectReason string
+}
+
+func (signer *txSigner) loadSigHashRecord(sigHashHex string) *sigHashRecord {
+	val, err := signer.seenCache.Get(sigHashHex)
+	if err != nil {
+		return nil
+	}
+	record, _ := val.(*sigHashRecord)
+	return record
+}
+
+// updateSigHashRecord applies fn to a copy of the record of sigHashHex and stores the copy
+func (signer *txSigner) updateSigHashRecord(sigHashHex, flow string, fn func(record *sigHashRecord)) {
+	signer.recordLock.Lock()
+	defer signer.recordLock.Unlock()
+
+	newRecord := sigHashRecord{flow: flow, firstSeen: time.Now().Unix()}
+	if record := signer.loadSigHashRecord(sigHashHex); record != nil {
+		newRecord = *record
+	}
+	fn(&newRecord)
+	if err := signer.seenCache.SetWithExpire(sigHashHex, &newRecord, timeCacheExpiration); err != nil {
+		log.Error("failed to put sigHash into cache:", err.Error())
+	}
+}
+
+func (signer *txSigner) markSeen(flow string, utxos []*sbchrpctypes.UtxoInfo) {
+	for _, utxo := range utxos {
+		sigHashHex := hex.EncodeToString(utxo.TxSigHash)
+		if !signer.seenCache.Has(sigHashHex) {
+			signer.updateSigHashRecord(sigHashHex, flow, func(record *sigHashRecord) {})
+		}
+	}
+}
+
+// checkVetoed marks the sigHashes which were removed from the monitors' lists during the publicity period
+func (signer *txSigner) checkVetoed(prev, curr *UtxosSnapshot) {
+	if prev == nil {
+		return
+	}
+	listed := make(map[string]bool)
+	for _, utxos := range [][]*sbchrpctypes.UtxoInfo{curr.RedeemingUtxos4Mo, curr.ToBeConvertedUtxos4Mo} {
+		for _, sigHashHex := range getSigHashes(utxos) {
+			listed[sigHashHex] = true
+		}
+	}
+
+	now := utils.GetTimestampFromTSC()
+	for _, utxos := range [][]*sbchrpctypes.UtxoInfo{prev.RedeemingUtxos4Mo, prev.ToBeConvertedUtxos4Mo} {
+		for _, sigHashHex := range getSigHashes(utxos) {
+			if listed[sigHashHex] {
+				continue
+			}
+			record := signer.loadSigHashRecord(sigHashHex)
+			if record == nil || record.vetoedTime != 0 {
+				continue
+			}
+			if okTs, ok := signer.getOkToSignTime(sigHashHex); !ok || okTs <= now {
+				continue
+			}
+			log.Warn("sigHash removed during the publicity period:", sigHashHex)
+			signer.updateSigHashRecord(sigHashHex, record.flow, func(record *sigHashRecord) {
+				record.vetoedTime = time.Now().Unix()
+			})
+			signer.events.publish(SigEventVetoed, sigHashHex, record.flow)
+			signer.auditSigHash(AuditVetoed, sigHashHex, record.flow)
+		}
+	}
+}
+
+// reconcileSigs tracks the signed sigHashes which are not listed for operators anymore,
+// they are revoked if not listed again within the grace period, and restored if listed again after it
+func (signer *txSigner) reconcileSigs(prev, curr *UtxosSnapshot) {
+	listed := make(map[string]bool)
+	for _, utxos := range [][]*sbchrpctypes.UtxoInfo{curr.RedeemingUtxos4Op, curr.ToBeConvertedUtxos4Op} {
+		for _, sigHashHex := range getSigHashes(utxos) {
+			listed[sigHashHex] = true
+		}
+	}
+
+	if prev != nil {
+		for _, utxos := range [][]*sbchrpctypes.UtxoInfo{prev.RedeemingUtxos4Op, prev.ToBeConvertedUtxos4Op} {
+			for _, sigHashHex := range getSigHashes(utxos) {
+				if listed[sigHashHex] || !signer.sigCache.Has(sigHashHex) {
+					continue
+				}
+				if _, ok := signer.unlisted[sigHashHex]; ok {
+					continue
+				}
+				log.Warn("signed sigHash not listed anymore:", sigHashHex)
+				signer.unlisted[sigHashHex] = struct{}{}
+				signer.updateSigHashRecord(sigHashHex, "", func(record *sigHashRecord) {
+					record.unlistedTime = time.Now().Unix()
+				})
+			}
+		}
+	}
+
+	for sigHashHex := range signer.unlisted {
+		record := signer.loadSigHashRecord(sigHashHex)
+		switch {
+		case record == nil: // expired
+			delete(signer.unlisted, sigHashHex)
+		case listed[sigHashHex]:
+			log.Info("sigHash listed again:", sigHashHex)
+			delete(signer.unlisted, sigHashHex)
+			signer.updateSigHashRecord(sigHashHex, record.flow, func(record *sigHashRecord) {
+				if record.revokedTime != 0 {
+					record.readyTime = 0 // so it is published as ready again
+				}
+				record.unlistedTime = 0
+				record.revokedTime = 0
+			})
+			if record.revokedTime != 0 {
+				signer.auditSigHash(AuditRestored, sigHashHex, record.flow)
+			}
+		case record.revokedTime == 0 && time.Since(time.Unix(record.unlistedTime, 0)) >= signer.revokeGracePeriod:
+			log.Warn("revoke signature of sigHash:", sigHashHex, ", not listed since:", record.unlistedTime)
+			signer.updateSigHashRecord(sigHashHex, record.flow, func(record *sigHashRecord) {
+				record.revokedTime = time.Now().Unix()
+			})
+			signer.events.publish(SigEventRevoked, sigHashHex, record.flow)
+			signer.auditSigHash(AuditRevoked, sigHashHex, record.flow)
+		}
+	}
+}
+
+func (signer *txSigner) getOkToSignTime(sigHashHex string) (uint64, bool) {
+	val, err := signer.timeCache.Get(sigHashHex)
+	if err != nil {
+		return 0, false
+	}
+	okTs, ok := val.(uint64)
+	return okTs, ok
+}
+
+// getSigStatus follows the same rules as getSig, and explains the result
+func (signer *txSigner) getSigStatus(sigHashHex string, suspended bool) *SigStatus {
+	sigHashHex = strings.TrimPrefix(sigHashHex, "0x")
+	status := &SigStatus{SigHash: sigHashHex}
+
+	seen := signer.loadSigHashRecord(sigHashHex)
+	if seen != nil {
+		status.Flow = seen.flow
+		status.FirstSeen = seen.firstSeen
+		status.VetoedTime = seen.vetoedTime
+		status.UnlistedTime = seen.unlistedTime
+		status.RevokedTime = seen.revokedTime
+	}
+	okTs, hasOkTs := signer.getOkToSignTime(sigHashHex)
+	nowTs := utils.GetTimestampFromTSC()
+	if hasOkTs {
+		// the TSC timestamps are not unix time
+		status.ReadyAt = time.Now().Unix() + int64(okTs) - int64(nowTs)
+	}
+	var record *sigRecord
+	if val, err := signer.sigCache.Get(sigHashHex); err == nil {
+		record, _ = val.(*sigRecord)
+	}
+	var covenantErr error
+	if record != nil {
+		if status.Flow == "" {
+			status.Flow = record.flow
+		}
+		covenantErr = signer.loadMembership().checkCovenant(record.covenant)
+	}
+
+	switch {
+	case suspended:
+		status.Status = SigStatusSuspended
+	case seen == nil && record == nil && !hasOkTs:
+		status.Status = SigStatusUnknown
+	case seen != nil && seen.vetoedTime != 0:
+		status.Status = SigStatusVetoed
+	case seen != nil && seen.revokedTime != 0:
+		status.Status = SigStatusRevoked
+	case covenantErr != nil:
+		status.Status = SigStatusPolicyRejected
+		status.Reason = covenantErr.Error()
+	case record == nil && seen != nil && seen.rejectReason != "":
+		status.Status = SigStatusPolicyRejected
+		status.Reason = seen.rejectReason
+	case !hasOkTs:
+		status.Status = SigStatusPendingPublicity
+		status.Reason = "not listed for monitors yet"
+	case nowTs < okTs:
+		status.Status = SigStatusPendingPublicity
+	case record == nil:
+		status.Status = SigStatusPendingPublicity
+		status.Reason = "not listed for operators yet"
+	default:
+		status.Status = SigStatusReady
+		status.Sig = record.sig
+	}
+	return status
+}
+
+func (op *Operator) handleSigStatus(w http.ResponseWriter, r *http.Request) {
+	hash := utils.GetQueryParam(r, "hash")
+	if len(hash) == 0 {
+		NewErrResp("missing query parameter: hash").WriteTo(w)
+		return
+	}
+	status := op.signer.getSigStatus(hash, op.isSuspended())
+	if status.Status == SigStatusReady {
+		op.signer.markServed(status.SigHash, r)
+	}
+	NewOkResp(status).WriteTo(w)
+}
+
+// handleSigs gets the statuses of a batch of sigHashes, the body is a JSON array of them,
+// the signature is only included in the statuses which are ready
+func (op *Operator) handleSigs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		NewErrResp("only POST is supported").WriteTo(w)
+		return
+	}
+
+	var sigHashes []string
+	r.Body = http.MaxBytesReader(w, r.Body, maxSigsBatchBodySize)
+	if err := json.NewDecoder(r.Body).Decode(&sigHashes); err != nil {
+		NewErrResp("invalid body: " + err.Error()).WriteTo(w)
+		return
+	}
+	if len(sigHashes) == 0 {
+		NewErrResp("no sigHashes").WriteTo(w)
+		return
+	}
+	if len(sigHashes) > maxSigsBatchSize {
+		NewErrResp(fmt.Sprintf("too many sigHashes: %d, max: %d", len(sigHashes), maxSigsBatchSize)).WriteTo(w)
+		return
+	}
+
+	log.Info("handleSigs:", len(sigHashes))
+	suspended := op.isSuspended()
+	statuses := make([]*SigStatus, len(sigHashes))
+	for i, sigHashHex := range sigHashes {
+		statuses[i] = op.signer.getSigStatus(sigHashHex, suspended)
+		if statuses[i].Status == SigStatusReady {
+			op.signer.markServed(statuses[i].SigHash, r)
+		}
+	}
+	NewOkResp(statuses).WriteTo(w)
+}
@@ -0,0 +1,195 @@
+package operator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/gcash/bchd/bchec"
+	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/cc-operator/utils"
+)
+
+func TestSigStatus(t *testing.T) {
+	key, err := bchec.NewPrivateKey(bchec.S256())
+	require.NoError(t, err)
+	signer := newSigner(key, &sbchRpcClient{})
+	covenantAddr := gethcmn.Address{0xc1}
+	signer.membership.Store(&Membership{Status: MembershipElected, currCovenant: covenantAddr})
+	require.Equal(t, SigStatusUnknown, signer.getSigStatus("01", false).Status)
+
+	utxo1, utxo2, utxo4 := newTestUtxo(0x01, covenantAddr), newTestUtxo(0x02, covenantAddr), newTestUtxo(0x04, covenantAddr)
+	utxo3 := newTestUtxo(0x03, gethcmn.Address{0x02})
+	snapshot1 := &UtxosSnapshot{
+		RedeemingUtxos4Mo: []*sbchrpctypes.UtxoInfo{utxo1, utxo2, utxo3},
+		RedeemingUtxos4Op: []*sbchrpctypes.UtxoInfo{utxo2, utxo3, utxo4},
+	}
+	signer.handleUtxos(nil, snapshot1)
+
+	status := signer.getSigStatus("0x01", false)
+	require.Equal(t, SigStatusPendingPublicity, status.Status)
+	require.Equal(t, flowRedeem, status.Flow)
+	require.NotZero(t, status.FirstSeen)
+	require.InDelta(t, status.FirstSeen+redeemPublicityPeriod, status.ReadyAt, 1)
+	require.Empty(t, status.Sig)
+
+	status = signer.getSigStatus("03", false)
+	require.Equal(t, SigStatusPolicyRejected, status.Status)
+	require.Equal(t, "not on the current or last covenant: "+gethcmn.Address{0x02}.Hex(), status.Reason)
+
+	status = signer.getSigStatus("04", false)
+	require.Equal(t, SigStatusPendingPublicity, status.Status)
+	require.Equal(t, "not listed for monitors yet", status.Reason)
+	require.Zero(t, status.ReadyAt)
+
+	// UTXO 0x01 has passed the publicity period, but is not signed yet
+	require.NoError(t, signer.timeCache.Set("01", utils.GetTimestampFromTSC()-10))
+	status = signer.getSigStatus("01", false)
+	require.Equal(t, SigStatusPendingPublicity, status.Status)
+	require.Equal(t, "not listed for operators yet", status.Reason)
+
+	// UTXO 0x02 is removed during the publicity period
+	snapshot2 := &UtxosSnapshot{
+		RedeemingUtxos4Mo: []*sbchrpctypes.UtxoInfo{utxo1},
+		RedeemingUtxos4Op: []*sbchrpctypes.UtxoInfo{utxo1},
+	}
+	signer.handleUtxos(snapshot1, snapshot2)
+	status = signer.getSigStatus("02", false)
+	require.Equal(t, SigStatusVetoed, status.Status)
+	require.NotZero(t, status.VetoedTime)
+	_, err = signer.getSig("02")
+	require.EqualError(t, err, "removed during the publicity period")
+
+	status = signer.getSigStatus("01", false)
+	require.Equal(t, SigStatusReady, status.Status)
+	sig, err := signer.getSig("01")
+	require.NoError(t, err)
+	require.Equal(t, sig, []byte(status.Sig))
+	require.Equal(t, SigStatusSuspended, signer.getSigStatus("01", true).Status)
+
+	// replaced by another operator
+	signer.membership.Store(&Membership{Status: MembershipNotElected, currCovenant: covenantAddr})
+	status = signer.getSigStatus("01", false)
+	require.Equal(t, SigStatusPolicyRejected, status.Status)
+	require.Equal(t, "can not sign, membership: not-elected", status.Reason)
+
+	op := &Operator{signer: signer}
+	mux := op.createHttpHandlers()
+	require.Equal(t, `{"success":false,"error":"missing query parameter: hash"}`, callMuxHandler(mux, "/sig-status"))
+	require.Contains(t, callMuxHandler(mux, "/sig-status?hash=0x02"), `"sigHash":"02","status":"vetoed","flow":"redeem",`)
+	op.suspended.Store(true)
+	require.Contains(t, callMuxHandler(mux, "/sig-status?hash=01"), `"status":"suspended"`)
+}
+
+func TestHandleSigs(t *testing.T) {
+	key, err := bchec.NewPrivateKey(bchec.S256())
+	require.NoError(t, err)
+	signer := newSigner(key, &sbchRpcClient{})
+	covenantAddr := gethcmn.Address{0xc1}
+	signer.membership.Store(&Membership{Status: MembershipElected, currCovenant: covenantAddr})
+	utxo1, utxo2 := newTestUtxo(0x01, covenantAddr), newTestUtxo(0x02, covenantAddr)
+	signer.handleUtxos(nil, &UtxosSnapshot{
+		RedeemingUtxos4Mo: []*sbchrpctypes.UtxoInfo{utxo1, utxo2},
+		RedeemingUtxos4Op: []*sbchrpctypes.UtxoInfo{utxo1, utxo2},
+	})
+	require.NoError(t, signer.timeCache.Set("01", utils.GetTimestampFromTSC()-10))
+	sig, err := signer.getSig("01")
+	require.NoError(t, err)
+
+	op := &Operator{signer: signer}
+	mux := op.createHttpHandlers()
+	postSigs := func(body string) string {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/sigs", strings.NewReader(body)))
+		return w.Body.String()
+	}
+
+	resp := postSigs(`["0x01","02","03"]`)
+	require.Contains(t, resp, `{"sigHash":"01","status":"ready","flow":"redeem",`)
+	require.Contains(t, resp, `"sig":"`+hexutil.Encode(sig)+`"}`)
+	require.Contains(t, resp, `{"sigHash":"02","status":"pending-publicity","flow":"redeem",`)
+	require.Contains(t, resp, `{"sigHash":"03","status":"unknown"}`)
+
+	op.suspended.Store(true)
+	resp = postSigs(`["01","02"]`)
+	require.Equal(t, 2, strings.Count(resp, `"status":"suspended"`))
+	require.NotContains(t, resp, `"sig":`)
+
+	require.Equal(t, `{"success":false,"error":"only POST is supported"}`, callMuxHandler(mux, "/sigs"))
+	require.Equal(t, `{"success":false,"error":"no sigHashes"}`, postSigs(`[]`))
+	require.Contains(t, postSigs(`{"hash":"01"}`), `"error":"invalid body: `)
+	tooMany := `["01"` + strings.Repeat(`,"01"`, maxSigsBatchSize) + `]`
+	require.Equal(t, `{"success":false,"error":"too many sigHashes: 101, max: 100"}`, postSigs(tooMany))
+	require.Contains(t, postSigs(`["`+strings.Repeat("0", maxSigsBatchBodySize)+`"]`), `"error":"invalid body: `)
+}
+
+func TestRevokeUnlistedSigs(t *testing.T) {
+	key, err := bchec.NewPrivateKey(bchec.S256())
+	require.NoError(t, err)
+	signer := newSigner(key, &sbchRpcClient{})
+	signer.revokeGracePeriod = time.Hour
+	covenantAddr := gethcmn.Address{0xc1}
+	signer.membership.Store(&Membership{Status: MembershipElected, currCovenant: covenantAddr})
+
+	utxo1, utxo2 := newTestUtxo(0x01, covenantAddr), newTestUtxo(0x02, covenantAddr)
+	snapshot1 := &UtxosSnapshot{
+		RedeemingUtxos4Mo: []*sbchrpctypes.UtxoInfo{utxo1, utxo2},
+		RedeemingUtxos4Op: []*sbchrpctypes.UtxoInfo{utxo1, utxo2},
+	}
+	signer.handleUtxos(nil, snapshot1)
+	require.NoError(t, signer.timeCache.Set("01", utils.GetTimestampFromTSC()-10))
+	require.NoError(t, signer.timeCache.Set("02", utils.GetTimestampFromTSC()-10))
+	signer.handleUtxos(snapshot1, snapshot1)
+	require.Equal(t, SigStatusReady, signer.getSigStatus("01", false).Status)
+
+	// both are not listed anymore, still served in the grace period
+	snapshot2 := &UtxosSnapshot{}
+	signer.handleUtxos(snapshot1, snapshot2)
+	status := signer.getSigStatus("01", false)
+	require.Equal(t, SigStatusReady, status.Status)
+	require.NotZero(t, status.UnlistedTime)
+	require.Len(t, signer.unlisted, 2)
+	signer.handleUtxos(snapshot2, snapshot2)
+	require.Len(t, signer.unlisted, 2)
+
+	// 0x01 is listed again
+	snapshot3 := &UtxosSnapshot{RedeemingUtxos4Mo: []*sbchrpctypes.UtxoInfo{utxo1}, RedeemingUtxos4Op: []*sbchrpctypes.UtxoInfo{utxo1}}
+	signer.handleUtxos(snapshot2, snapshot3)
+	require.Len(t, signer.unlisted, 1)
+	require.Zero(t, signer.getSigStatus("01", false).UnlistedTime)
+
+	// the grace period of 0x02 is over
+	signer.revokeGracePeriod = 0
+	epoch, last := signer.events.last()
+	signer.handleUtxos(snapshot3, snapshot3)
+	require.Len(t, signer.unlisted, 1)
+	status = signer.getSigStatus("02", false)
+	require.Equal(t, SigStatusRevoked, status.Status)
+	require.NotZero(t, status.RevokedTime)
+	require.Empty(t, status.Sig)
+	_, err = signer.getSig("02")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "revoked, not listed since ")
+	events, _ := signer.events.after(epoch, last)
+	require.Len(t, events, 1)
+	require.Equal(t, SigEventRevoked, events[0].Type)
+	require.Equal(t, "02", events[0].SigHash)
+
+	_, err = signer.getSig("01")
+	require.NoError(t, err)
+
+	// restored if listed again
+	signer.handleUtxos(snapshot3, snapshot1)
+	require.Empty(t, signer.unlisted)
+	require.Equal(t, SigStatusReady, signer.getSigStatus("02", false).Status)
+	events, _ = signer.events.after(epoch, last+1)
+	require.Len(t, events, 1)
+	require.Equal(t, SigEventReady, events[0].Type)
+	require.Equal(t, "02", events[0].SigHash)
+}
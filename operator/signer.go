@@ -1,10 +1,13 @@
 package operator
 
 import (
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bluele/gcache"
@@ -14,50 +17,122 @@ import (
 
 	"github.com/smartbch/cc-operator/utils"
 	"github.com/smartbch/smartbch/crosschain/covenant"
+	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
 )
 
 type txSigner struct {
-	privKey    *bchec.PrivateKey
-	sbchClient *sbchRpcClient
+	privKey           *bchec.PrivateKey
+	pubkey            []byte // compressed
+	sbchClient        *sbchRpcClient
+	membership        atomic.Pointer[Membership]
+	migration         atomic.Pointer[MigrationProgress] // nil if no migration is in progress
+	utxos             atomic.Pointer[UtxosSnapshot]     // nil before the first successful poll
+	redeemableUtxos   atomic.Pointer[InfoUtxosSnapshot] // nil before the first successful poll
+	lostAndFoundUtxos atomic.Pointer[InfoUtxosSnapshot] // nil before the first successful poll
+	ccInfo            atomic.Pointer[CcInfoSnapshot]    // nil before the first successful membership check
 
 	sigCache  gcache.Cache
 	timeCache gcache.Cache
+	seenCache gcache.Cache // sigHash => *sigHashRecord
+	events    sigEventLog
+	audit     *auditLog // nil if disabled
+
+	recordLock sync.Mutex // serializes the updates of seenCache, the handlers mark the served sigHashes
+
+	revokeGracePeriod time.Duration
+	unlisted          map[string]struct{} // signed sigHashes not listed for operators, only used by the signing loop
 }
 
 func newSigner(privKey *bchec.PrivateKey, sbchClient *sbchRpcClient) *txSigner {
-	return &txSigner{
+	signer := &txSigner{
 		privKey:    privKey,
 		sbchClient: sbchClient,
 		sigCache:   gcache.New(sigCacheMaxCount).Expiration(sigCacheExpiration).Simple().Build(),
 		timeCache:  gcache.New(timeCacheMaxCount).Expiration(sigCacheExpiration).Simple().Build(),
+		seenCache:  gcache.New(timeCacheMaxCount).Expiration(timeCacheExpiration).Simple().Build(),
+
+		revokeGracePeriod: sigRevokeGracePeriod,
+		unlisted:          make(map[string]struct{}),
 	}
+	if privKey != nil {
+		signer.pubkey = privKey.PubKey().SerializeCompressed()
+	}
+	return signer
 }
 
-// run this in a goroutine
-func (signer *txSigner) getAndSignSigHashes() {
+// run this in a goroutine, returns when ctx is done
+func (signer *txSigner) getAndSignSigHashes(ctx context.Context) {
 	log.Info("start to getAndSignSigHashes ...")
+	ticker := time.NewTicker(getSigHashesInterval)
+	defer ticker.Stop()
+	var membershipCheckedTime time.Time
 	for {
-		time.Sleep(getSigHashesInterval)
+		select {
+		case <-ctx.Done():
+			log.Info("stop getAndSignSigHashes")
+			return
+		case <-ticker.C:
+		}
 
-		allSigHashes4Op, err := signer.sbchClient.getAllSigHashes4Op()
-		if err != nil {
-			continue
+		// the first check is done before signing anything
+		if time.Since(membershipCheckedTime) >= checkMembershipInterval {
+			signer.checkMembership(ctx)
+			membershipCheckedTime = time.Now()
 		}
-		signer.signSigHashes4Op(allSigHashes4Op)
 
-		redeemingSigHashes4Mo, toBeConvertedSigHashes4Mo, err := signer.sbchClient.getAllSigHashes4Mo()
+		prev := signer.utxos.Load()
+		snapshot, err := signer.pollUtxos(ctx)
 		if err != nil {
 			continue
 		}
-		signer.cacheSigHashes4Mo(redeemingSigHashes4Mo, toBeConvertedSigHashes4Mo)
+		signer.handleUtxos(prev, snapshot)
 	}
 }
 
-func (signer *txSigner) signSigHashes4Op(allSigHashes4Op []string) {
-	for _, sigHashHex := range allSigHashes4Op {
+// handleUtxos signs and tracks the sigHashes of a new snapshot, prev is nil at the first time
+func (signer *txSigner) handleUtxos(prev, snapshot *UtxosSnapshot) {
+	signer.markSeen(flowRedeem, snapshot.RedeemingUtxos4Mo)
+	signer.markSeen(flowConvert, snapshot.ToBeConvertedUtxos4Mo)
+	signer.markSeen(flowRedeem, snapshot.RedeemingUtxos4Op)
+	signer.markSeen(flowConvert, snapshot.ToBeConvertedUtxos4Op)
+
+	signer.signUtxos4Op(flowRedeem, snapshot.RedeemingUtxos4Op)
+	signer.signUtxos4Op(flowConvert, snapshot.ToBeConvertedUtxos4Op)
+	signer.cacheSigHashes4Mo(getSigHashes(snapshot.RedeemingUtxos4Mo), getSigHashes(snapshot.ToBeConvertedUtxos4Mo))
+	signer.checkVetoed(prev, snapshot)
+	signer.reconcileSigs(prev, snapshot)
+	signer.publishReady(snapshot)
+	signer.updateMigration(snapshot.ToBeConvertedUtxos4Op)
+}
+
+// sigRecord is what sigCache keeps for a sigHash
+type sigRecord struct {
+	sig      []byte
+	flow     string
+	covenant gethcmn.Address // of the UTXO
+}
+
+func (signer *txSigner) signUtxos4Op(flow string, utxos []*sbchrpctypes.UtxoInfo) {
+	m := signer.loadMembership()
+	nSkipped := 0
+	for _, utxo := range utxos {
+		sigHashHex := hex.EncodeToString(utxo.TxSigHash)
 		if signer.sigCache.Has(sigHashHex) {
 			continue
 		}
+		if err := m.checkUtxo(flow, utxo); err != nil {
+			if nSkipped == 0 {
+				log.Warn("skip ", flow, " UTXO:", err.Error())
+			}
+			nSkipped++
+			if seen := signer.loadSigHashRecord(sigHashHex); seen == nil || seen.rejectReason != err.Error() {
+				signer.updateSigHashRecord(sigHashHex, flow, func(record *sigHashRecord) {
+					record.rejectReason = err.Error()
+				})
+				signer.auditUtxo(AuditRejected, flow, utxo, err.Error())
+			}
+			continue
+		}
 
 		sigBytes, err := signer.signSigHashECDSA(sigHashHex)
 		if err != nil {
@@ -66,11 +141,16 @@ func (signer *txSigner) signSigHashes4Op(allSigHashes4Op []string) {
 		}
 
 		log.Info("sigHash:", sigHashHex, "sig:", hex.EncodeToString(sigBytes))
-		err = signer.sigCache.SetWithExpire(sigHashHex, sigBytes, sigCacheExpiration)
+		signer.auditUtxo(AuditSigned, flow, utxo, "ok")
+		record := &sigRecord{sig: sigBytes, flow: flow, covenant: utxo.CovenantAddr}
+		err = signer.sigCache.SetWithExpire(sigHashHex, record, sigCacheExpiration)
 		if err != nil {
 			log.Error("failed to put sig into cache:", err.Error())
 		}
 	}
+	if nSkipped > 1 {
+		log.Warn("skipped ", nSkipped, " ", flow, " UTXOs")
+	}
 }
 
 func (signer *txSigner) signSigHashECDSA(sigHashHex string) ([]byte, error) {
@@ -113,6 +193,19 @@ func (signer *txSigner) getSig(sigHashHex string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	record, ok := val.(*sigRecord)
+	if !ok {
+		return nil, errors.New("invalid cached signature")
+	}
+	// the membership may have changed since signing
+	if err = signer.loadMembership().checkCovenant(record.covenant); err != nil {
+		return nil, err
+	}
+	if seen := signer.loadSigHashRecord(sigHashHex); seen != nil && seen.vetoedTime != 0 {
+		return nil, errors.New("removed during the publicity period")
+	} else if seen != nil && seen.revokedTime != 0 {
+		return nil, errors.New("revoked, not listed since " + time.Unix(seen.unlistedTime, 0).UTC().Format(time.RFC3339))
+	}
 
 	timestampIfc, err := signer.timeCache.Get(sigHashHex)
 	if err != nil {
@@ -127,11 +220,7 @@ func (signer *txSigner) getSig(sigHashHex string) ([]byte, error) {
 		return nil, fmt.Errorf("still too early to sign: %d < %d", currentTime, okToSignTime)
 	}
 
-	sig, ok := val.([]byte)
-	if !ok {
-		return nil, errors.New("invalid cached signature")
-	}
-	return sig, nil
+	return record.sig, nil
 }
 
 func (signer *txSigner) isMonitor(addr gethcmn.Address) bool {
@@ -140,4 +229,6 @@ func (signer *txSigner) isMonitor(addr gethcmn.Address) bool {
 
 func (signer *txSigner) fillMonitorsAndNodesInfo(opInfo *OpInfo) {
 	signer.sbchClient.fillMonitorsAndNodesInfo(opInfo)
+	opInfo.Membership = signer.loadMembership()
+	opInfo.Migration = signer.migration.Load()
 }
@@ -1,20 +1,38 @@
 package operator
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
+	"strings"
 
 	gethcmn "github.com/ethereum/go-ethereum/common"
+	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
 
 	"github.com/smartbch/cc-operator/sbch"
 )
 
 type OpInfo struct {
-	Status           string            `json:"status"`
-	CurrNodes        []sbch.NodeInfo   `json:"currNodes,omitempty"`
-	NewNodes         []sbch.NodeInfo   `json:"newNodes,omitempty"`
-	NodesChangedTime int64             `json:"nodesChangedTime,omitempty"`
-	Monitors         []gethcmn.Address `json:"monitors,omitempty"`
+	Status           string               `json:"status"`
+	CurrNodes        []sbch.NodeInfo      `json:"currNodes,omitempty"`
+	CurrNodesTime    int64                `json:"currNodesTime,omitempty"`
+	NewNodes         []sbch.NodeInfo      `json:"newNodes,omitempty"`
+	NodesChangedTime int64                `json:"nodesChangedTime,omitempty"`
+	Monitors         []gethcmn.Address    `json:"monitors,omitempty"`
+	NodesHealth      []sbch.NodeHealth    `json:"nodesHealth,omitempty"`
+	ExcludedNodes    []sbch.NodeExclusion `json:"excludedNodes,omitempty"`
+	Membership       *Membership          `json:"membership,omitempty"`
+	Migration        *MigrationProgress   `json:"migration,omitempty"`
+}
+
+// CcInfoSnapshot is the CcInfo agreed by all sbchd nodes,
+// Height is the latest block of the nodes (the minimum) which did not change while it was read
+type CcInfoSnapshot struct {
+	Height      uint64               `json:"height"`
+	FetchedTime int64                `json:"fetchedTime"`
+	Stale       bool                 `json:"stale"` // not refreshed for ccInfoStaleAfter
+	CcInfo      *sbchrpctypes.CcInfo `json:"ccInfo"`
 }
 
 type Resp struct {
@@ -54,11 +72,48 @@ func (resp Resp) ToJSON() []byte {
 }
 
 func (resp Resp) WriteTo(w http.ResponseWriter) {
+	bytes, _ := json.Marshal(resp)
+	writeJSON(w, bytes)
+}
+
+func writeJSON(w http.ResponseWriter, bytes []byte) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "*")
-	w.Header().Set("Access-Control-Allow-Headers", "origin, content-type, accept")
+	w.Header().Set("Access-Control-Allow-Headers", "origin, content-type, accept, if-none-match")
+	w.Header().Set("Access-Control-Expose-Headers", "etag, x-utxos-height, x-utxos-fetched-time, x-utxos-stale, x-next-cursor")
 
-	bytes, _ := json.Marshal(resp)
 	_, _ = w.Write(bytes)
 }
+
+// WriteWithETag writes resp with a strong ETag of its content,
+// or only 304 Not Modified if the request has a matching If-None-Match
+func (resp Resp) WriteWithETag(w http.ResponseWriter, r *http.Request) {
+	resp.writeWithETagOf(w, r, resp)
+}
+
+// writeWithETagOf is WriteWithETag with the ETag of v instead of the whole resp,
+// the fields of resp not in v do not change the ETag
+func (resp Resp) writeWithETagOf(w http.ResponseWriter, r *http.Request, v any) {
+	data, _ := json.Marshal(v)
+	hash := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(hash[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	bytes, _ := json.Marshal(resp)
+	writeJSON(w, bytes)
+}
+
+func etagMatch(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
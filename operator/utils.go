@@ -2,9 +2,40 @@ package operator
 
 import (
 	"encoding/json"
+	"os"
+
+	"github.com/edgelesssys/ego/ecrypto"
 )
 
 func toJSON(v any) string {
 	bs, _ := json.Marshal(v)
 	return string(bs)
 }
+
+func sealData(data []byte) ([]byte, error) {
+	return ecrypto.SealWithUniqueKey(data, nil)
+}
+
+func unsealData(sealed []byte) ([]byte, error) {
+	return ecrypto.Unseal(sealed, nil)
+}
+
+// writeSealedFile seals data in SGX mode, and writes it as plain text otherwise
+func writeSealedFile(file string, data []byte) error {
+	if sgxMode {
+		sealed, err := sealData(data)
+		if err != nil {
+			return err
+		}
+		data = sealed
+	}
+	return os.WriteFile(file, data, 0600)
+}
+
+func readSealedFile(file string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil || !sgxMode {
+		return data, err
+	}
+	return unsealData(data)
+}
@@ -0,0 +1,390 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
+
+	"github.com/smartbch/cc-operator/sbch"
+	"github.com/smartbch/cc-operator/utils"
+)
+
+var errNoUtxosSnapshot = errors.New("UTXOs not fetched yet")
+
+// UtxosSnapshot is an immutable snapshot of the UTXO lists polled by the signer,
+// it must not be modified after being published
+type UtxosSnapshot struct {
+	Height                uint64 // the lowest latest block of the nodes before the lists were read
+	FetchedTime           time.Time
+	RedeemingUtxos4Op     []*sbchrpctypes.UtxoInfo
+	RedeemingUtxos4Mo     []*sbchrpctypes.UtxoInfo
+	ToBeConvertedUtxos4Op []*sbchrpctypes.UtxoInfo
+	ToBeConvertedUtxos4Mo []*sbchrpctypes.UtxoInfo
+}
+
+// InfoUtxosSnapshot is an immutable snapshot of the redeemable or lost-and-found UTXOs.
+// They are not used for signing, so each of them is polled apart from UtxosSnapshot at a slower rate,
+// and a failed poll keeps the last list.
+type InfoUtxosSnapshot struct {
+	Height      uint64
+	FetchedTime time.Time
+	Failed      bool // the last poll failed, Utxos are from an earlier one
+	Utxos       []*sbchrpctypes.UtxoInfo
+}
+
+// UtxoList is the result of the UTXO list endpoints with meta=true,
+// without it only Utxos is returned. The others are also in the X-Utxos-* and X-Next-Cursor headers.
+type UtxoList struct {
+	Height      uint64                   `json:"height"`
+	FetchedTime int64                    `json:"fetchedTime"`
+	Stale       bool                     `json:"stale"` // polling has been failing since FetchedTime
+	Utxos       []*sbchrpctypes.UtxoInfo `json:"utxos"`
+	NextCursor  string                   `json:"nextCursor,omitempty"` // empty on the last page
+}
+
+// getUtxosSnapshot reads the four UTXO lists used for signing, all of them must be agreed by the nodes
+func (client *sbchRpcClient) getUtxosSnapshot(ctx context.Context) (*UtxosSnapshot, error) {
+	rpcClient := client.currClusterClient()
+
+	height, err := rpcClient.GetBlockNumber(ctx)
+	if err != nil {
+		log.Error("failed to call GetBlockNumber:", err.Error())
+		return nil, err
+	}
+	snapshot := &UtxosSnapshot{Height: height}
+
+	log.Info("call GetRedeemingUtxosForOperators ...")
+	snapshot.RedeemingUtxos4Op, err = rpcClient.GetRedeemingUtxosForOperators(ctx)
+	if err != nil {
+		log.Error("failed to call GetRedeemingUtxosForOperators:", err.Error())
+		return nil, err
+	}
+
+	log.Info("call GetToBeConvertedUtxosForOperators ...")
+	snapshot.ToBeConvertedUtxos4Op, err = rpcClient.GetToBeConvertedUtxosForOperators(ctx)
+	if err != nil {
+		log.Error("failed to call GetToBeConvertedUtxosForOperators:", err.Error())
+		return nil, err
+	}
+
+	log.Info("call GetRedeemingUtxosForMonitors ...")
+	snapshot.RedeemingUtxos4Mo, err = rpcClient.GetRedeemingUtxosForMonitors(ctx)
+	if err != nil {
+		log.Error("failed to call GetRedeemingUtxosForMonitors:", err.Error())
+		return nil, err
+	}
+
+	log.Info("call GetToBeConvertedUtxosForMonitors ...")
+	snapshot.ToBeConvertedUtxos4Mo, err = rpcClient.GetToBeConvertedUtxosForMonitors(ctx)
+	if err != nil {
+		log.Error("failed to call GetToBeConvertedUtxosForMonitors:", err.Error())
+		return nil, err
+	}
+
+	snapshot.FetchedTime = time.Now()
+	log.Info("height:", height,
+		", redeemingUtxos4Op:", len(snapshot.RedeemingUtxos4Op),
+		", toBeConvertedUtxos4Op:", len(snapshot.ToBeConvertedUtxos4Op),
+		", redeemingUtxos4Mo:", len(snapshot.RedeemingUtxos4Mo),
+		", toBeConvertedUtxos4Mo:", len(snapshot.ToBeConvertedUtxos4Mo))
+	return snapshot, nil
+}
+
+// pollUtxos fetches the UTXO lists and publishes them to the HTTP handlers
+func (signer *txSigner) pollUtxos(ctx context.Context) (*UtxosSnapshot, error) {
+	snapshot, err := signer.sbchClient.getUtxosSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	signer.utxos.Store(snapshot)
+	return snapshot, nil
+}
+
+// run this in a goroutine, returns when ctx is done
+func (signer *txSigner) watchInfoUtxos(ctx context.Context) {
+	log.Info("start to watchInfoUtxos ...")
+	ticker := time.NewTicker(pollInfoUtxosInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("stop watchInfoUtxos")
+			return
+		case <-ticker.C:
+			signer.pollInfoUtxos(ctx)
+		}
+	}
+}
+
+// pollInfoUtxos fetches the redeemable and lost-and-found UTXOs one by one,
+// a list which can not be fetched keeps its last snapshot and is served as stale
+func (signer *txSigner) pollInfoUtxos(ctx context.Context) {
+	rpcClient := signer.sbchClient.currClusterClient()
+	pollInfoUtxoList(ctx, &signer.redeemableUtxos, "GetRedeemableUtxos", rpcClient, rpcClient.GetRedeemableUtxos)
+	pollInfoUtxoList(ctx, &signer.lostAndFoundUtxos, "GetLostAndFoundUtxos", rpcClient, rpcClient.GetLostAndFoundUtxos)
+}
+
+func pollInfoUtxoList(ctx context.Context, snapshot *atomic.Pointer[InfoUtxosSnapshot], name string,
+	rpcClient *sbch.ClusterClient, getUtxos func(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error)) {
+
+	height, err := rpcClient.GetBlockNumber(ctx)
+	var utxos []*sbchrpctypes.UtxoInfo
+	if err == nil {
+		log.Info("call ", name, " ...")
+		utxos, err = getUtxos(ctx)
+	}
+	if err != nil {
+		log.Error("failed to call ", name, ":", err.Error())
+		if prev := snapshot.Load(); prev != nil && !prev.Failed {
+			failed := *prev
+			failed.Failed = true
+			snapshot.Store(&failed)
+		}
+		return
+	}
+	log.Info("height:", height, ", ", name, ":", len(utxos))
+	snapshot.Store(&InfoUtxosSnapshot{Height: height, FetchedTime: time.Now(), Utxos: utxos})
+}
+
+func getSigHashes(utxos []*sbchrpctypes.UtxoInfo) []string {
+	sigHashes := make([]string, len(utxos))
+	for i, utxo := range utxos {
+		sigHashes[i] = hex.EncodeToString(utxo.TxSigHash)
+	}
+	return sigHashes
+}
+
+// loadUtxoList returns one of the lists of the last UtxosSnapshot, nil if not fetched yet
+func (signer *txSigner) loadUtxoList(getList func(snapshot *UtxosSnapshot) []*sbchrpctypes.UtxoInfo) *UtxoList {
+	snapshot := signer.utxos.Load()
+	if snapshot == nil {
+		return nil
+	}
+	return &UtxoList{
+		Height:      snapshot.Height,
+		FetchedTime: snapshot.FetchedTime.Unix(),
+		Stale:       time.Since(snapshot.FetchedTime) > utxosStaleAfter,
+		Utxos:       getList(snapshot),
+	}
+}
+
+// loadInfoUtxoList returns the list of the last InfoUtxosSnapshot, nil if not fetched yet
+func loadInfoUtxoList(snapshot *atomic.Pointer[InfoUtxosSnapshot]) *UtxoList {
+	s := snapshot.Load()
+	if s == nil {
+		return nil
+	}
+	return &UtxoList{
+		Height:      s.Height,
+		FetchedTime: s.FetchedTime.Unix(),
+		Stale:       s.Failed || time.Since(s.FetchedTime) > infoUtxosStaleAfter,
+		Utxos:       s.Utxos,
+	}
+}
+
+// handleUtxoList serves a page of the whole list loaded from a snapshot, the nodes are never queried here
+func (op *Operator) handleUtxoList(w http.ResponseWriter, r *http.Request, whole *UtxoList) {
+
+	query, err := parseUtxoQuery(r)
+	if err != nil {
+		NewErrResp(err.Error()).WriteTo(w)
+		return
+	}
+	var withMeta bool
+	if s := utils.GetQueryParam(r, "meta"); s != "" {
+		if withMeta, err = strconv.ParseBool(s); err != nil {
+			NewErrResp("invalid query parameter: meta").WriteTo(w)
+			return
+		}
+	}
+	if whole == nil {
+		NewErrResp(errNoUtxosSnapshot.Error()).WriteTo(w)
+		return
+	}
+
+	utxos := whole.Utxos
+	if integrationTestMode && op.withChaos {
+		if n := len(utxos); n > 0 {
+			utxos = utxos[:n-1]
+		}
+	}
+	utxos, nextCursor := query.apply(utxos)
+	list := *whole
+	list.Utxos = utxos
+	list.NextCursor = nextCursor
+	// the headers are also sent with 304, so that a client sees the list got stale
+	w.Header().Set("X-Utxos-Height", strconv.FormatUint(list.Height, 10))
+	w.Header().Set("X-Utxos-Fetched-Time", strconv.FormatInt(list.FetchedTime, 10))
+	w.Header().Set("X-Utxos-Stale", strconv.FormatBool(list.Stale))
+	if list.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", list.NextCursor)
+	}
+	if withMeta {
+		// the ETag only depends on the page, as without meta, not on when it was fetched
+		NewOkResp(list).writeWithETagOf(w, r, NewOkResp(UtxoList{Utxos: list.Utxos, NextCursor: list.NextCursor}))
+		return
+	}
+	NewOkResp(list.Utxos).WriteWithETag(w, r)
+}
+
+// utxoQuery holds the optional query parameters of the UTXO list endpoints:
+// covenantAddr, redeemTarget, txid, minAmount and maxAmount (in satoshi), isRedeemed, cursor and limit.
+// The whole list is returned if there is no limit.
+type utxoQuery struct {
+	covenantAddr *gethcmn.Address
+	redeemTarget *gethcmn.Address
+	txid         *gethcmn.Hash
+	minAmount    *uint64
+	maxAmount    *uint64
+	isRedeemed   *bool
+	cursor       *outpoint // the last UTXO of the previous page
+	limit        int
+}
+
+type outpoint struct {
+	txid  gethcmn.Hash
+	index uint32
+}
+
+func (p outpoint) String() string {
+	return fmt.Sprintf("%s:%d", p.txid.Hex(), p.index)
+}
+
+func parseOutpoint(s string) (outpoint, error) {
+	txid, index, ok := strings.Cut(s, ":")
+	if !ok {
+		return outpoint{}, errors.New("missing index")
+	}
+	hash, err := parseHash(txid)
+	if err != nil {
+		return outpoint{}, err
+	}
+	n, err := strconv.ParseUint(index, 10, 32)
+	if err != nil {
+		return outpoint{}, err
+	}
+	return outpoint{txid: hash, index: uint32(n)}, nil
+}
+
+func parseHash(s string) (gethcmn.Hash, error) {
+	bz, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(bz) != gethcmn.HashLength {
+		return gethcmn.Hash{}, errors.New("invalid hash")
+	}
+	return gethcmn.BytesToHash(bz), nil
+}
+
+func parseUtxoQuery(r *http.Request) (*utxoQuery, error) {
+	query := &utxoQuery{}
+	for _, name := range []string{"covenantAddr", "redeemTarget"} {
+		s := utils.GetQueryParam(r, name)
+		if s == "" {
+			continue
+		}
+		if !gethcmn.IsHexAddress(s) {
+			return nil, errors.New("invalid query parameter: " + name)
+		}
+		addr := gethcmn.HexToAddress(s)
+		if name == "covenantAddr" {
+			query.covenantAddr = &addr
+		} else {
+			query.redeemTarget = &addr
+		}
+	}
+	if s := utils.GetQueryParam(r, "txid"); s != "" {
+		txid, err := parseHash(s)
+		if err != nil {
+			return nil, errors.New("invalid query parameter: txid")
+		}
+		query.txid = &txid
+	}
+	for _, name := range []string{"minAmount", "maxAmount"} {
+		s := utils.GetQueryParam(r, name)
+		if s == "" {
+			continue
+		}
+		amount, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid query parameter: " + name)
+		}
+		if name == "minAmount" {
+			query.minAmount = &amount
+		} else {
+			query.maxAmount = &amount
+		}
+	}
+	if s := utils.GetQueryParam(r, "isRedeemed"); s != "" {
+		isRedeemed, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, errors.New("invalid query parameter: isRedeemed")
+		}
+		query.isRedeemed = &isRedeemed
+	}
+	if s := utils.GetQueryParam(r, "cursor"); s != "" {
+		cursor, err := parseOutpoint(s)
+		if err != nil {
+			return nil, errors.New("invalid query parameter: cursor")
+		}
+		query.cursor = &cursor
+	}
+	if s := utils.GetQueryParam(r, "limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit <= 0 || limit > maxUtxosPageLimit {
+			return nil, errors.New("invalid query parameter: limit")
+		}
+		query.limit = limit
+	}
+	return query, nil
+}
+
+func (query *utxoQuery) match(utxo *sbchrpctypes.UtxoInfo) bool {
+	return (query.covenantAddr == nil || utxo.CovenantAddr == *query.covenantAddr) &&
+		(query.redeemTarget == nil || utxo.RedeemTarget == *query.redeemTarget) &&
+		(query.txid == nil || utxo.Txid == *query.txid) &&
+		(query.minAmount == nil || uint64(utxo.Amount) >= *query.minAmount) &&
+		(query.maxAmount == nil || uint64(utxo.Amount) <= *query.maxAmount) &&
+		(query.isRedeemed == nil || utxo.IsRedeemed == *query.isRedeemed)
+}
+
+// apply returns a page of the matched UTXOs after the cursor, utxos must be sorted by outpoint
+// as the cluster client returns them, so that a cursor stays valid across snapshots
+func (query *utxoQuery) apply(utxos []*sbchrpctypes.UtxoInfo) ([]*sbchrpctypes.UtxoInfo, string) {
+	if query.cursor != nil {
+		cursor := *query.cursor
+		utxos = utxos[sort.Search(len(utxos), func(i int) bool {
+			return outpointLess(cursor, outpoint{txid: utxos[i].Txid, index: utxos[i].Index})
+		}):]
+	}
+
+	result := make([]*sbchrpctypes.UtxoInfo, 0)
+	for _, utxo := range utxos {
+		if !query.match(utxo) {
+			continue
+		}
+		if query.limit > 0 && len(result) == query.limit {
+			last := result[len(result)-1]
+			return result, outpoint{txid: last.Txid, index: last.Index}.String()
+		}
+		result = append(result, utxo)
+	}
+	return result, ""
+}
+
+func outpointLess(a, b outpoint) bool {
+	if c := bytes.Compare(a.txid[:], b.txid[:]); c != 0 {
+		return c < 0
+	}
+	return a.index < b.index
+}
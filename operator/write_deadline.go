@@ -0,0 +1,13 @@
+//go:build go1.20
+
+package operator
+
+import (
+	"net/http"
+	"time"
+)
+
+// extendWriteDeadline lets a streaming handler outlive the WriteTimeout of the server
+func extendWriteDeadline(w http.ResponseWriter, d time.Duration) bool {
+	return http.NewResponseController(w).SetWriteDeadline(time.Now().Add(d)) == nil
+}
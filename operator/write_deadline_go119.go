@@ -0,0 +1,13 @@
+//go:build !go1.20
+
+package operator
+
+import (
+	"net/http"
+	"time"
+)
+
+// extendWriteDeadline is not supported before go1.20
+func extendWriteDeadline(w http.ResponseWriter, d time.Duration) bool {
+	return false
+}
@@ -0,0 +1,83 @@
+package sbch
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/edgelesssys/ego/attestation"
+
+	"github.com/smartbch/cc-operator/utils"
+)
+
+var (
+	ErrNotAttested        = errors.New("node not attested")
+	ErrReportNotSupported = errors.New("node does not serve " + rpcPubkeyReportMethod)
+)
+
+// verifyRemoteReport is replaced in tests, which run without SGX
+var verifyRemoteReport = utils.VerifyRemoteReport
+
+// EnclavePolicy is the enclave identity required of the public sbchd nodes,
+// whose RPC pubkey must be bound to an attestation report.
+// Nodes are not attested if neither SignerID nor UniqueID is set.
+//
+// The report is read with sbch_getRpcPubkeyReport, which smartbch v0.4.5 (the version in go.mod)
+// and earlier do not serve, so a policy can only be set if all public nodes run an sbchd build which serves it.
+// Otherwise the nodes fail to be dialed with ErrReportNotSupported.
+type EnclavePolicy struct {
+	SignerID           []byte
+	UniqueID           []byte
+	ProductID          uint16 // 0 means not checked
+	MinSecurityVersion uint
+	AllowDebug         bool
+}
+
+func (policy EnclavePolicy) enabled() bool {
+	return len(policy.SignerID) > 0 || len(policy.UniqueID) > 0
+}
+
+// check returns an error if the report does not come from the expected enclave
+// or does not bind the pubkey
+func (policy EnclavePolicy) check(report attestation.Report, pubkey []byte) error {
+	hash := sha256.Sum256(pubkey)
+	if len(report.Data) < len(hash) || !bytes.Equal(report.Data[:len(hash)], hash[:]) {
+		return errors.New("report data does not match the pubkey hash")
+	}
+	if len(policy.UniqueID) > 0 && !bytes.Equal(report.UniqueID, policy.UniqueID) {
+		return fmt.Errorf("unique id not match: %x", report.UniqueID)
+	}
+	if len(policy.SignerID) > 0 && !bytes.Equal(report.SignerID, policy.SignerID) {
+		return fmt.Errorf("signer id not match: %x", report.SignerID)
+	}
+	if policy.ProductID != 0 &&
+		(len(report.ProductID) < 2 || binary.LittleEndian.Uint16(report.ProductID) != policy.ProductID) {
+		return fmt.Errorf("product id not match: %x", report.ProductID)
+	}
+	if report.SecurityVersion < policy.MinSecurityVersion {
+		return fmt.Errorf("security version too low: %d", report.SecurityVersion)
+	}
+	if report.Debug && !policy.AllowDebug {
+		return errors.New("debug enclave not allowed")
+	}
+	return nil
+}
+
+// attestNode fetches the report of the node's RPC pubkey and checks it against the policy
+func (policy EnclavePolicy) attestNode(ctx context.Context, client RpcClient, pubkey []byte) error {
+	reportBytes, err := client.GetRpcPubkeyReport(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: get report failed: %s", ErrNotAttested, err.Error())
+	}
+	report, err := verifyRemoteReport(reportBytes)
+	if err != nil {
+		return fmt.Errorf("%w: verify report failed: %s", ErrNotAttested, err.Error())
+	}
+	if err = policy.check(report, pubkey); err != nil {
+		return fmt.Errorf("%w: %s", ErrNotAttested, err.Error())
+	}
+	return nil
+}
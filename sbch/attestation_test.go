@@ -0,0 +1,115 @@
+package sbch
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/edgelesssys/ego/attestation"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestReport(pubkey []byte) attestation.Report {
+	hash := sha256.Sum256(pubkey)
+	return attestation.Report{
+		Data:            append(hash[:], make([]byte, 32)...),
+		SecurityVersion: 2,
+		UniqueID:        []byte{0x01},
+		SignerID:        []byte{0x02},
+		ProductID:       []byte{0x01, 0x00},
+	}
+}
+
+func TestEnclavePolicyCheck(t *testing.T) {
+	pubkey := []byte{0x03, 0x04}
+	policy := EnclavePolicy{SignerID: []byte{0x02}, UniqueID: []byte{0x01}, ProductID: 1, MinSecurityVersion: 2}
+	require.False(t, EnclavePolicy{}.enabled())
+	require.True(t, policy.enabled())
+	require.NoError(t, policy.check(newTestReport(pubkey), pubkey))
+
+	requireErrorContains(t, policy.check(newTestReport(pubkey), []byte{0x05}), "report data does not match")
+	report := newTestReport(pubkey)
+	report.UniqueID = []byte{0xff}
+	requireErrorContains(t, policy.check(report, pubkey), "unique id not match")
+	report = newTestReport(pubkey)
+	report.SignerID = []byte{0xff}
+	requireErrorContains(t, policy.check(report, pubkey), "signer id not match")
+	report = newTestReport(pubkey)
+	report.ProductID = []byte{0x02, 0x00}
+	requireErrorContains(t, policy.check(report, pubkey), "product id not match")
+	report = newTestReport(pubkey)
+	report.SecurityVersion = 1
+	requireErrorContains(t, policy.check(report, pubkey), "security version too low")
+	report = newTestReport(pubkey)
+	report.Debug = true
+	requireErrorContains(t, policy.check(report, pubkey), "debug enclave not allowed")
+	policy.AllowDebug = true
+	require.NoError(t, policy.check(report, pubkey))
+}
+
+// reportClient returns a fixed pubkey report
+type reportClient struct {
+	SimpleRpcClient
+	report []byte
+	err    error
+}
+
+func (client *reportClient) GetRpcPubkeyReport(ctx context.Context) ([]byte, error) {
+	return client.report, client.err
+}
+
+func TestAttestNode(t *testing.T) {
+	pubkey := []byte{0x03, 0x04}
+	reports := map[string]attestation.Report{"good": newTestReport(pubkey)}
+	defer func(fn func([]byte) (attestation.Report, error)) { verifyRemoteReport = fn }(verifyRemoteReport)
+	verifyRemoteReport = func(reportBytes []byte) (attestation.Report, error) {
+		report, ok := reports[string(reportBytes)]
+		if !ok {
+			return report, errors.New("invalid report")
+		}
+		return report, nil
+	}
+
+	ctx := context.Background()
+	policy := EnclavePolicy{SignerID: []byte{0x02}}
+	require.NoError(t, policy.attestNode(ctx, &reportClient{report: []byte("good")}, pubkey))
+
+	err := policy.attestNode(ctx, &reportClient{report: []byte("good")}, []byte{0x05})
+	require.ErrorIs(t, err, ErrNotAttested)
+	requireErrorContains(t, err, "report data does not match")
+
+	err = policy.attestNode(ctx, &reportClient{report: []byte("bad")}, pubkey)
+	require.ErrorIs(t, err, ErrNotAttested)
+	requireErrorContains(t, err, "verify report failed: invalid report")
+
+	err = policy.attestNode(ctx, &reportClient{err: errors.New("method not found")}, pubkey)
+	require.ErrorIs(t, err, ErrNotAttested)
+	requireErrorContains(t, err, "get report failed: method not found")
+}
+
+func TestGetRpcPubkeyReportNotSupported(t *testing.T) {
+	var nReqs atomic.Int32
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nReqs.Add(1)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,` +
+			`"message":"the method sbch_getRpcPubkeyReport does not exist/is not available"}}`))
+	}))
+	defer fakeServer.Close()
+
+	simpleClient, err := NewSimpleRpcClient("0x1234", fakeServer.URL, time.Second)
+	require.NoError(t, err)
+	client := NewResilientClient(simpleClient)
+	_, err = client.GetRpcPubkeyReport(context.Background())
+	require.ErrorIs(t, err, ErrReportNotSupported)
+	require.Equal(t, int32(1), nReqs.Load()) // not retried
+	require.Zero(t, client.Health().TotalFailures)
+
+	err = EnclavePolicy{SignerID: []byte{0x02}}.attestNode(context.Background(), client, []byte{0x03})
+	require.ErrorIs(t, err, ErrNotAttested)
+	requireErrorContains(t, err, "node does not serve sbch_getRpcPubkeyReport")
+}
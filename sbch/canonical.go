@@ -0,0 +1,79 @@
+package sbch
+
+import (
+	"bytes"
+	"sort"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+
+	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
+)
+
+// The canonical* functions return a sorted copy of a response, so that the responses of
+// different nodes can be compared regardless of order. Nil and empty lists are the same.
+// Per-node fields such as response signatures are verified by each node's client
+// and dropped before the responses reach here.
+
+func canonicalNodes(nodes []NodeInfo) []NodeInfo {
+	result := append(make([]NodeInfo, 0, len(nodes)), nodes...)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// canonicalUtxos sorts UTXOs by outpoint
+func canonicalUtxos(utxos []*sbchrpctypes.UtxoInfo) []*sbchrpctypes.UtxoInfo {
+	result := append(make([]*sbchrpctypes.UtxoInfo, 0, len(utxos)), utxos...)
+	sort.Slice(result, func(i, j int) bool {
+		return utxoLess(result[i], result[j])
+	})
+	return result
+}
+
+func utxoLess(a, b *sbchrpctypes.UtxoInfo) bool {
+	if a == nil || b == nil {
+		return a == nil && b != nil
+	}
+	if c := bytes.Compare(a.Txid[:], b.Txid[:]); c != 0 {
+		return c < 0
+	}
+	return a.Index < b.Index
+}
+
+func canonicalAddresses(addrs []gethcmn.Address) []gethcmn.Address {
+	result := append(make([]gethcmn.Address, 0, len(addrs)), addrs...)
+	sort.Slice(result, func(i, j int) bool {
+		return bytes.Compare(result[i][:], result[j][:]) < 0
+	})
+	return result
+}
+
+// canonicalEvents sorts events by the order they were emitted
+func canonicalEvents(events []NodesGovEvent) []NodesGovEvent {
+	result := append(make([]NodesGovEvent, 0, len(events)), events...)
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].BlockNum != result[j].BlockNum {
+			return result[i].BlockNum < result[j].BlockNum
+		}
+		return result[i].LogIndex < result[j].LogIndex
+	})
+	return result
+}
+
+// canonicalCcInfo only makes nil and empty lists the same, the order of operators and monitors
+// is kept because it is significant (e.g. the covenant script is built from the ordered pubkeys)
+func canonicalCcInfo(ccInfo *sbchrpctypes.CcInfo) *sbchrpctypes.CcInfo {
+	if ccInfo == nil {
+		return nil
+	}
+	result := *ccInfo
+	result.Signature = nil
+	result.MonitorsWithPauseCommand = append(make([]string, 0, len(ccInfo.MonitorsWithPauseCommand)),
+		ccInfo.MonitorsWithPauseCommand...)
+	result.Operators = append(make([]*sbchrpctypes.OperatorInfo, 0, len(ccInfo.Operators)), ccInfo.Operators...)
+	result.OldOperators = append(make([]*sbchrpctypes.OperatorInfo, 0, len(ccInfo.OldOperators)), ccInfo.OldOperators...)
+	result.Monitors = append(make([]*sbchrpctypes.MonitorInfo, 0, len(ccInfo.Monitors)), ccInfo.Monitors...)
+	result.OldMonitors = append(make([]*sbchrpctypes.MonitorInfo, 0, len(ccInfo.OldMonitors)), ccInfo.OldMonitors...)
+	return &result
+}
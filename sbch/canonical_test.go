@@ -0,0 +1,98 @@
+package sbch
+
+import (
+	"context"
+	"testing"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
+)
+
+// monitorsClient returns fixed monitors
+type monitorsClient struct {
+	SimpleRpcClient
+	monitors []gethcmn.Address
+}
+
+func (client *monitorsClient) GetMonitors(ctx context.Context) ([]gethcmn.Address, error) {
+	return client.monitors, nil
+}
+
+func TestClusterIgnoresOrder(t *testing.T) {
+	utxo1 := &sbchrpctypes.UtxoInfo{Txid: gethcmn.Hash{0x02}, Index: 0}
+	utxo2 := &sbchrpctypes.UtxoInfo{Txid: gethcmn.Hash{0x01}, Index: 1}
+	utxo3 := &sbchrpctypes.UtxoInfo{Txid: gethcmn.Hash{0x01}, Index: 0}
+	cluster := &ClusterClient{clients: []RpcClient{
+		&utxosClient{SimpleRpcClient{rpcUrl: "node1"}, []*sbchrpctypes.UtxoInfo{utxo1, utxo2, utxo3}},
+		&utxosClient{SimpleRpcClient{rpcUrl: "node2"}, []*sbchrpctypes.UtxoInfo{utxo3, utxo1, utxo2}},
+	}}
+	utxos, err := cluster.GetRedeemingUtxosForOperators(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []*sbchrpctypes.UtxoInfo{utxo3, utxo2, utxo1}, utxos)
+
+	addr1, addr2 := gethcmn.Address{0x01}, gethcmn.Address{0x02}
+	cluster = &ClusterClient{clients: []RpcClient{
+		&monitorsClient{SimpleRpcClient{rpcUrl: "node1"}, []gethcmn.Address{addr2, addr1}},
+		&monitorsClient{SimpleRpcClient{rpcUrl: "node2"}, []gethcmn.Address{addr1, addr2}},
+	}}
+	monitors, err := cluster.GetMonitors(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []gethcmn.Address{addr1, addr2}, monitors)
+
+	// nil and empty lists are the same
+	cluster = &ClusterClient{clients: []RpcClient{
+		&monitorsClient{SimpleRpcClient{rpcUrl: "node1"}, nil},
+		&monitorsClient{SimpleRpcClient{rpcUrl: "node2"}, []gethcmn.Address{}},
+	}}
+	monitors, err = cluster.GetMonitors(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, monitors)
+}
+
+func TestCanonicalNodes(t *testing.T) {
+	nodes := []NodeInfo{{ID: 3}, {ID: 1}, {ID: 2}}
+	require.Equal(t, []NodeInfo{{ID: 1}, {ID: 2}, {ID: 3}}, canonicalNodes(nodes))
+	require.Equal(t, uint64(3), nodes[0].ID) // not modified
+}
+
+// ccInfoClient returns a fixed CcInfo
+type ccInfoClient struct {
+	SimpleRpcClient
+	ccInfo *sbchrpctypes.CcInfo
+}
+
+func (client *ccInfoClient) GetCcInfo(ctx context.Context) (*sbchrpctypes.CcInfo, error) {
+	return client.ccInfo, nil
+}
+
+func TestClusterGetCcInfo(t *testing.T) {
+	op1 := &sbchrpctypes.OperatorInfo{Address: gethcmn.Address{0x01}}
+	op2 := &sbchrpctypes.OperatorInfo{Address: gethcmn.Address{0x02}}
+	cluster := &ClusterClient{clients: []RpcClient{
+		&ccInfoClient{SimpleRpcClient{rpcUrl: "node1"},
+			&sbchrpctypes.CcInfo{Operators: []*sbchrpctypes.OperatorInfo{op1, op2}, RescannedHeight: 10}},
+		&ccInfoClient{SimpleRpcClient{rpcUrl: "node2"},
+			&sbchrpctypes.CcInfo{Operators: []*sbchrpctypes.OperatorInfo{op1, op2}, Monitors: []*sbchrpctypes.MonitorInfo{},
+				RescannedHeight: 10}},
+		&ccInfoClient{SimpleRpcClient{rpcUrl: "node3"},
+			&sbchrpctypes.CcInfo{Operators: []*sbchrpctypes.OperatorInfo{op1, op2}, RescannedHeight: 10}},
+	}}
+	ccInfo, err := cluster.GetCcInfo(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []*sbchrpctypes.OperatorInfo{op1, op2}, ccInfo.Operators)
+	require.Equal(t, uint64(10), ccInfo.RescannedHeight)
+
+	// the order of operators is significant, node2 is the minority
+	cluster.clients[1].(*ccInfoClient).ccInfo.Operators = []*sbchrpctypes.OperatorInfo{op2, op1}
+	cluster.clients[1].(*ccInfoClient).ccInfo.RescannedHeight = 11
+	_, err = cluster.GetCcInfo(context.Background())
+	var disagreement *DisagreementError
+	require.ErrorAs(t, err, &disagreement)
+	diffs := disagreement.Report.Diffs[0].Changed
+	require.Len(t, diffs, 2)
+	require.Equal(t, "operators", diffs[0].Field)
+	require.Equal(t, "rescannedHeight", diffs[1].Field)
+	require.Equal(t, "11", string(diffs[1].Actual))
+}
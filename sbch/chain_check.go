@@ -0,0 +1,81 @@
+package sbch
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var (
+	ErrWrongChain  = errors.New("wrong chain")
+	ErrNodeLagging = errors.New("node lagging")
+
+	ErrTooFewActiveNodes = errors.New("too few active nodes")
+)
+
+// ChainStatus is the chain identity and sync status reported by a node
+type ChainStatus struct {
+	ChainID         uint64       `json:"chainId"`
+	GenesisHash     gethcmn.Hash `json:"genesisHash"`
+	LatestBlockNum  uint64       `json:"latestBlockNum"`
+	LatestBlockTime int64        `json:"latestBlockTime"`
+}
+
+// ChainPolicy is what the nodes are checked against, zero fields are not checked
+type ChainPolicy struct {
+	ChainID     uint64
+	GenesisHash gethcmn.Hash
+	MaxLag      time.Duration // max age of the latest block
+	// min number of public nodes not excluded, below it the cluster calls fail,
+	// default: a strict majority of the public nodes
+	MinActiveNodes int
+}
+
+func (policy ChainPolicy) enabled() bool {
+	return policy.ChainID != 0 || policy.GenesisHash != (gethcmn.Hash{}) || policy.MaxLag > 0
+}
+
+func (policy ChainPolicy) minActiveNodes(nPublicNodes int) int {
+	if policy.MinActiveNodes > 0 && policy.MinActiveNodes < nPublicNodes {
+		return policy.MinActiveNodes
+	}
+	if policy.MinActiveNodes > 0 || nPublicNodes == 0 {
+		return nPublicNodes
+	}
+	return nPublicNodes/2 + 1
+}
+
+// check returns an error wrapping ErrWrongChain or ErrNodeLagging
+func (policy ChainPolicy) check(status ChainStatus, now time.Time) error {
+	if policy.ChainID != 0 && status.ChainID != policy.ChainID {
+		return fmt.Errorf("%w: chainId %d != %d", ErrWrongChain, status.ChainID, policy.ChainID)
+	}
+	if policy.GenesisHash != (gethcmn.Hash{}) && status.GenesisHash != policy.GenesisHash {
+		return fmt.Errorf("%w: genesis %s != %s", ErrWrongChain, status.GenesisHash.Hex(), policy.GenesisHash.Hex())
+	}
+	if policy.MaxLag > 0 {
+		lag := now.Sub(time.Unix(status.LatestBlockTime, 0))
+		if lag > policy.MaxLag {
+			return fmt.Errorf("%w: latest block %d is %s old", ErrNodeLagging,
+				status.LatestBlockNum, lag.Truncate(time.Second))
+		}
+	}
+	return nil
+}
+
+// NodeExclusion is a node which is not called by ClusterClient because it failed the chain check
+type NodeExclusion struct {
+	RpcUrl string `json:"rpcUrl"`
+	Reason string `json:"reason"`
+	Since  int64  `json:"since"`
+}
+
+// rpcBlockHeader is the part of eth_getBlockByNumber result used by the chain check
+type rpcBlockHeader struct {
+	Number    hexutil.Uint64 `json:"number"`
+	Hash      gethcmn.Hash   `json:"hash"`
+	Timestamp hexutil.Uint64 `json:"timestamp"`
+}
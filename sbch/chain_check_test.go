@@ -0,0 +1,115 @@
+package sbch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainPolicyCheck(t *testing.T) {
+	now := time.Now()
+	status := ChainStatus{ChainID: 10000, GenesisHash: gethcmn.Hash{0x01},
+		LatestBlockNum: 100, LatestBlockTime: now.Add(-time.Minute).Unix()}
+
+	require.False(t, ChainPolicy{}.enabled())
+	require.NoError(t, ChainPolicy{}.check(status, now))
+	require.NoError(t, ChainPolicy{ChainID: 10000, GenesisHash: gethcmn.Hash{0x01},
+		MaxLag: 2 * time.Minute}.check(status, now))
+
+	err := ChainPolicy{ChainID: 10001}.check(status, now)
+	require.ErrorIs(t, err, ErrWrongChain)
+	require.EqualError(t, err, "wrong chain: chainId 10000 != 10001")
+	require.ErrorIs(t, ChainPolicy{GenesisHash: gethcmn.Hash{0x02}}.check(status, now), ErrWrongChain)
+
+	err = ChainPolicy{MaxLag: 30 * time.Second}.check(status, now)
+	require.ErrorIs(t, err, ErrNodeLagging)
+	require.EqualError(t, err, "node lagging: latest block 100 is 1m0s old")
+}
+
+// chainClient reports a fixed chain status
+type chainClient struct {
+	monitorsClient
+	status ChainStatus
+	err    error
+}
+
+func (client *chainClient) GetChainStatus(ctx context.Context) (ChainStatus, error) {
+	return client.status, client.err
+}
+
+func TestClusterCheckNodes(t *testing.T) {
+	now := time.Now().Unix()
+	c1 := &chainClient{monitorsClient: monitorsClient{SimpleRpcClient{rpcUrl: "node1"}, []gethcmn.Address{{0x01}}},
+		status: ChainStatus{ChainID: 1, LatestBlockTime: now}}
+	c2 := &chainClient{monitorsClient: monitorsClient{SimpleRpcClient{rpcUrl: "node2"}, []gethcmn.Address{{0x02}}},
+		status: ChainStatus{ChainID: 1, LatestBlockTime: now - 3600}}
+	cluster := &ClusterClient{
+		clients:     []RpcClient{c1, c2},
+		chainPolicy: ChainPolicy{ChainID: 1, MaxLag: time.Minute, MinActiveNodes: 1},
+		exclusions:  map[string]NodeExclusion{},
+	}
+
+	cluster.CheckNodes(context.Background())
+	exclusions := cluster.Exclusions()
+	require.Len(t, exclusions, 1)
+	require.Equal(t, "node2", exclusions[0].RpcUrl)
+	monitors, err := cluster.GetMonitors(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []gethcmn.Address{{0x01}}, monitors)
+
+	// unreachable node keeps its state
+	c2.err = errors.New("connection refused")
+	cluster.CheckNodes(context.Background())
+	require.Equal(t, exclusions, cluster.Exclusions())
+
+	// node switched to the wrong chain
+	c2.err = nil
+	c2.status = ChainStatus{ChainID: 1, LatestBlockTime: now}
+	c1.status.ChainID = 2
+	cluster.CheckNodes(context.Background())
+	exclusions = cluster.Exclusions()
+	require.Len(t, exclusions, 1)
+	require.Equal(t, "node1", exclusions[0].RpcUrl)
+	require.Contains(t, exclusions[0].Reason, "wrong chain")
+}
+
+func TestClusterMinActiveNodes(t *testing.T) {
+	now := time.Now().Unix()
+	newClient := func(url string, latestBlockTime int64) *chainClient {
+		return &chainClient{monitorsClient: monitorsClient{SimpleRpcClient{rpcUrl: url}, []gethcmn.Address{{0x01}}},
+			status: ChainStatus{ChainID: 1, LatestBlockTime: latestBlockTime}}
+	}
+	c1, c2, c3 := newClient("node1", now), newClient("node2", now-3600), newClient("node3", now-3600)
+	private := newClient("private", now-3600)
+	cluster := &ClusterClient{
+		clients:     []RpcClient{c1, c2, c3, private},
+		chainPolicy: ChainPolicy{ChainID: 1, MaxLag: time.Minute},
+		privateUrls: map[string]bool{"private": true},
+		exclusions:  map[string]NodeExclusion{},
+	}
+
+	// the private node is not excluded, 1 of 3 public nodes is below the majority
+	cluster.CheckNodes(context.Background())
+	require.Len(t, cluster.Exclusions(), 2)
+	_, err := cluster.GetMonitors(context.Background())
+	require.ErrorIs(t, err, ErrTooFewActiveNodes)
+	require.EqualError(t, err, "too few active nodes: 1 of 3 public nodes, min: 2")
+	_, err = cluster.GetBlockNumber(context.Background())
+	require.ErrorIs(t, err, ErrTooFewActiveNodes)
+
+	// 2 of 3 is the majority
+	c2.status.LatestBlockTime = now
+	cluster.CheckNodes(context.Background())
+	monitors, err := cluster.GetMonitors(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []gethcmn.Address{{0x01}}, monitors)
+
+	// all nodes are required
+	cluster.chainPolicy.MinActiveNodes = 10
+	_, err = cluster.GetMonitors(context.Background())
+	require.EqualError(t, err, "too few active nodes: 2 of 3 public nodes, min: 3")
+}
@@ -0,0 +1,213 @@
+package sbch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+
+	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
+)
+
+// Disagreement describes how the responses of the nodes differ in one cluster call.
+// Nodes returning the same response form a group, the largest group comes first,
+// and each other group is compared with it.
+type Disagreement struct {
+	Time        int64             `json:"time"`
+	Method      string            `json:"method"`
+	Groups      [][]string        `json:"groups"`
+	FailedNodes map[string]string `json:"failedNodes,omitempty"` // rpcUrl => error
+	Diffs       []ResponseDiff    `json:"diffs"`
+}
+
+type ResponseDiff struct {
+	Group        int             `json:"group"`             // index of the group compared with group 0
+	Missing      []string        `json:"missing,omitempty"` // items of group 0 not returned by this group
+	Extra        []string        `json:"extra,omitempty"`   // items returned by this group only
+	Changed      []FieldDiff     `json:"changed,omitempty"`
+	OrderDiffers bool            `json:"orderDiffers,omitempty"`
+	Expected     json.RawMessage `json:"expected,omitempty"` // only for responses that are not lists
+	Actual       json.RawMessage `json:"actual,omitempty"`
+}
+
+type FieldDiff struct {
+	Item     string          `json:"item"`
+	Field    string          `json:"field"`
+	Expected json.RawMessage `json:"expected"`
+	Actual   json.RawMessage `json:"actual"`
+}
+
+// DisagreementError is returned by ClusterClient when the nodes return different responses
+type DisagreementError struct {
+	Report *Disagreement
+}
+
+func (err *DisagreementError) Error() string {
+	groups := err.Report.Groups
+	return fmt.Sprintf("response not match between: %s, %s", groups[0][0], groups[1][0])
+}
+
+type nodeResponse struct {
+	rpcUrl string
+	resp   any
+}
+
+func newDisagreement(methodName string, resps []nodeResponse, failedNodes map[string]string) *Disagreement {
+	var groups [][]nodeResponse
+	for _, r := range resps {
+		found := false
+		for i, group := range groups {
+			if reflect.DeepEqual(group[0].resp, r.resp) {
+				groups[i] = append(group, r)
+				found = true
+				break
+			}
+		}
+		if !found {
+			groups = append(groups, []nodeResponse{r})
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i]) > len(groups[j])
+	})
+
+	report := &Disagreement{
+		Time:        time.Now().Unix(),
+		Method:      methodName,
+		FailedNodes: failedNodes,
+	}
+	for i, group := range groups {
+		urls := make([]string, len(group))
+		for j, r := range group {
+			urls[j] = r.rpcUrl
+		}
+		report.Groups = append(report.Groups, urls)
+		if i > 0 {
+			diff := diffResponses(groups[0][0].resp, group[0].resp)
+			diff.Group = i
+			report.Diffs = append(report.Diffs, diff)
+		}
+	}
+	return report
+}
+
+func diffResponses(expected, actual any) ResponseDiff {
+	switch exp := expected.(type) {
+	case []*sbchrpctypes.UtxoInfo:
+		if act, ok := actual.([]*sbchrpctypes.UtxoInfo); ok {
+			return diffLists(exp, act, utxoKey)
+		}
+	case []NodeInfo:
+		if act, ok := actual.([]NodeInfo); ok {
+			return diffLists(exp, act, nodeKey)
+		}
+	case []gethcmn.Address:
+		if act, ok := actual.([]gethcmn.Address); ok {
+			return diffLists(exp, act, gethcmn.Address.Hex)
+		}
+	case *sbchrpctypes.CcInfo:
+		if act, ok := actual.(*sbchrpctypes.CcInfo); ok && exp != nil && act != nil {
+			return ResponseDiff{Changed: diffFields("ccInfo", exp, act)}
+		}
+	case []NodesGovEvent:
+		if act, ok := actual.([]NodesGovEvent); ok {
+			return diffLists(exp, act, eventKey)
+		}
+	}
+	return ResponseDiff{Expected: toRawJSON(expected), Actual: toRawJSON(actual)}
+}
+
+func utxoKey(utxo *sbchrpctypes.UtxoInfo) string {
+	if utxo == nil {
+		return "nil"
+	}
+	return utxo.Txid.Hex() + ":" + strconv.FormatUint(uint64(utxo.Index), 10)
+}
+
+func nodeKey(node NodeInfo) string {
+	return strconv.FormatUint(node.ID, 10)
+}
+
+func eventKey(event NodesGovEvent) string {
+	return event.TxHash.Hex() + "#" + strconv.FormatUint(uint64(event.LogIndex), 10)
+}
+
+func diffLists[T any](expected, actual []T, key func(T) string) (diff ResponseDiff) {
+	expMap := make(map[string]T, len(expected))
+	for _, item := range expected {
+		expMap[key(item)] = item
+	}
+	actMap := make(map[string]T, len(actual))
+	for _, item := range actual {
+		actMap[key(item)] = item
+	}
+
+	for _, item := range expected {
+		k := key(item)
+		actItem, ok := actMap[k]
+		if !ok {
+			diff.Missing = append(diff.Missing, k)
+		} else {
+			diff.Changed = append(diff.Changed, diffFields(k, item, actItem)...)
+		}
+	}
+	for _, item := range actual {
+		if _, ok := expMap[key(item)]; !ok {
+			diff.Extra = append(diff.Extra, key(item))
+		}
+	}
+
+	if len(diff.Missing) == 0 && len(diff.Extra) == 0 && len(diff.Changed) == 0 {
+		diff.OrderDiffers = true
+	}
+	return
+}
+
+// diffFields compares the exported fields of two structs (or pointers to structs)
+func diffFields(item string, expected, actual any) []FieldDiff {
+	expVal := reflect.Indirect(reflect.ValueOf(expected))
+	actVal := reflect.Indirect(reflect.ValueOf(actual))
+	if expVal.Kind() != reflect.Struct || actVal.Kind() != reflect.Struct {
+		if reflect.DeepEqual(expected, actual) {
+			return nil
+		}
+		return []FieldDiff{{Item: item, Expected: toRawJSON(expected), Actual: toRawJSON(actual)}}
+	}
+
+	var diffs []FieldDiff
+	for i := 0; i < expVal.NumField(); i++ {
+		field := expVal.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		expField := expVal.Field(i).Interface()
+		actField := actVal.Field(i).Interface()
+		if !reflect.DeepEqual(expField, actField) {
+			diffs = append(diffs, FieldDiff{
+				Item:     item,
+				Field:    jsonFieldName(field),
+				Expected: toRawJSON(expField),
+				Actual:   toRawJSON(actField),
+			})
+		}
+	}
+	return diffs
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+func toRawJSON(v any) json.RawMessage {
+	bz, _ := json.Marshal(v)
+	return bz
+}
@@ -0,0 +1,78 @@
+package sbch
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
+)
+
+// utxosClient returns fixed UTXOs
+type utxosClient struct {
+	SimpleRpcClient
+	utxos []*sbchrpctypes.UtxoInfo
+}
+
+func (client *utxosClient) GetRedeemingUtxosForOperators(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error) {
+	return client.utxos, nil
+}
+
+func TestClusterDisagreement(t *testing.T) {
+	utxo1 := &sbchrpctypes.UtxoInfo{Txid: gethcmn.Hash{0x01}, Index: 1, Amount: 100}
+	utxo2 := &sbchrpctypes.UtxoInfo{Txid: gethcmn.Hash{0x02}, Index: 0, Amount: 200}
+	utxo2b := &sbchrpctypes.UtxoInfo{Txid: gethcmn.Hash{0x02}, Index: 0, Amount: 201}
+	utxo3 := &sbchrpctypes.UtxoInfo{Txid: gethcmn.Hash{0x03}, Index: 2, Amount: 300}
+
+	c1 := &utxosClient{SimpleRpcClient{rpcUrl: "node1"}, []*sbchrpctypes.UtxoInfo{utxo1, utxo2}}
+	c2 := &utxosClient{SimpleRpcClient{rpcUrl: "node2"}, []*sbchrpctypes.UtxoInfo{utxo2b, utxo3}}
+	c3 := &utxosClient{SimpleRpcClient{rpcUrl: "node3"}, []*sbchrpctypes.UtxoInfo{utxo1, utxo2}}
+	cluster := &ClusterClient{clients: []RpcClient{c1, c2, c3}}
+
+	var reported *Disagreement
+	cluster.SetDisagreementHandler(func(report *Disagreement) { reported = report })
+
+	_, err := cluster.GetRedeemingUtxosForOperators(context.Background())
+	var dErr *DisagreementError
+	require.True(t, errors.As(err, &dErr))
+	require.Contains(t, err.Error(), "response not match between:")
+	require.Same(t, dErr.Report, reported)
+
+	report := dErr.Report
+	require.Equal(t, "GetRedeemingUtxosForOperators", report.Method)
+	require.Len(t, report.Groups, 2)
+	require.ElementsMatch(t, []string{"node1", "node3"}, report.Groups[0])
+	require.Equal(t, []string{"node2"}, report.Groups[1])
+
+	require.Len(t, report.Diffs, 1)
+	diff := report.Diffs[0]
+	require.Equal(t, 1, diff.Group)
+	require.Equal(t, []string{utxo1.Txid.Hex() + ":1"}, diff.Missing)
+	require.Equal(t, []string{utxo3.Txid.Hex() + ":2"}, diff.Extra)
+	require.Len(t, diff.Changed, 1)
+	require.Equal(t, utxo2.Txid.Hex()+":0", diff.Changed[0].Item)
+	require.Equal(t, "amount", diff.Changed[0].Field)
+	require.Equal(t, `"0xc8"`, string(diff.Changed[0].Expected))
+	require.Equal(t, `"0xc9"`, string(diff.Changed[0].Actual))
+}
+
+func TestDiffResponses(t *testing.T) {
+	addr1 := gethcmn.Address{0x01}
+	addr2 := gethcmn.Address{0x02}
+	diff := diffResponses([]gethcmn.Address{addr1, addr2}, []gethcmn.Address{addr2, addr1})
+	require.True(t, diff.OrderDiffers)
+	require.Empty(t, diff.Missing)
+	require.Empty(t, diff.Extra)
+
+	diff = diffResponses([]NodeInfo{{ID: 1, RpcUrl: "a"}}, []NodeInfo{{ID: 1, RpcUrl: "b"}})
+	require.Len(t, diff.Changed, 1)
+	require.Equal(t, "1", diff.Changed[0].Item)
+	require.Equal(t, "rpcUrl", diff.Changed[0].Field)
+
+	diff = diffResponses([]byte{0x01}, []byte{0x02})
+	require.Equal(t, `"AQ=="`, string(diff.Expected))
+	require.Equal(t, `"Ag=="`, string(diff.Actual))
+}
@@ -0,0 +1,176 @@
+package sbch
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	maxNodeFieldLen = 256 // limits the length of rpcUrl and intro returned by NodesGov
+	maxNodeCount    = 256 // limits the nodes read from NodesGov, so a bad node can not force a huge fan-out
+)
+
+var (
+	//go:embed abi/NodesGov.json
+	nodesGovABIJson string
+	// same as NodesGov, but nodes(uint256) returns rpcUrl and intro as dynamic strings
+	//go:embed abi/NodesGovStrings.json
+	nodesGovStringsABIJson string
+
+	nodesGovABI        = mustParseABI(nodesGovABIJson)
+	nodesGovStringsABI = mustParseABI(nodesGovStringsABIJson)
+)
+
+func mustParseABI(abiJson string) abi.ABI {
+	_abi, err := abi.JSON(strings.NewReader(abiJson))
+	if err != nil {
+		panic(err)
+	}
+	return _abi
+}
+
+func packGetNodeCount() []byte {
+	data, _ := nodesGovABI.Pack("getNodeCount")
+	return data
+}
+
+func packGetNodeByIdx(idx uint64) []byte {
+	data, _ := nodesGovABI.Pack("nodes", new(big.Int).SetUint64(idx))
+	return data
+}
+
+func unpackNodeCount(data []byte) (uint64, error) {
+	values, err := unpackStrict(nodesGovABI, "getNodeCount", data)
+	if err != nil {
+		return 0, fmt.Errorf("invalid NodeCount data: %w", err)
+	}
+	nodeCount := values[0].(*big.Int)
+	if !nodeCount.IsUint64() || nodeCount.Uint64() > maxNodeCount {
+		return 0, errors.New("invalid NodeCount: " + nodeCount.String())
+	}
+	return nodeCount.Uint64(), nil
+}
+
+// decodeNodeInfo decodes the result of nodes(uint256), rpcUrl and intro can be bytes32 (exactly 4 words)
+// or dynamic strings (at least 6 words, offsets and lengths included)
+func decodeNodeInfo(data []byte) (node NodeInfo, err error) {
+	if len(data) == 32*4 {
+		return decodeNodeInfoBytes32(data)
+	}
+	values, err := unpackStrict(nodesGovStringsABI, "nodes", data)
+	if err != nil {
+		return node, fmt.Errorf("invalid NodeInfo data: %w", err)
+	}
+	return newNodeInfo(values[0].(*big.Int), values[1].([32]byte), values[2].(string), values[3].(string))
+}
+
+func decodeNodeInfoBytes32(data []byte) (node NodeInfo, err error) {
+	values, err := unpackStrict(nodesGovABI, "nodes", data)
+	if err != nil {
+		return node, fmt.Errorf("invalid NodeInfo data: %w", err)
+	}
+	rpcUrl, err := bytes32ToString(values[2].([32]byte))
+	if err != nil {
+		return node, fmt.Errorf("invalid rpcUrl: %w", err)
+	}
+	intro, err := bytes32ToString(values[3].([32]byte))
+	if err != nil {
+		return node, fmt.Errorf("invalid intro: %w", err)
+	}
+	return newNodeInfo(values[0].(*big.Int), values[1].([32]byte), rpcUrl, intro)
+}
+
+func newNodeInfo(id *big.Int, pbkHash [32]byte, rpcUrl, intro string) (node NodeInfo, err error) {
+	if !id.IsUint64() {
+		return node, errors.New("invalid node id: " + id.String())
+	}
+	for _, s := range []string{rpcUrl, intro} {
+		if len(s) > maxNodeFieldLen {
+			return node, fmt.Errorf("string too long: %d > %d", len(s), maxNodeFieldLen)
+		}
+		if !utf8.ValidString(s) {
+			return node, errors.New("invalid utf8 string")
+		}
+	}
+
+	node.ID = id.Uint64()
+	node.PbkHash = pbkHash
+	node.RpcUrl = rpcUrl
+	node.Intro = intro
+	return node, nil
+}
+
+// bytes32ToString trims the zero padding, zero bytes are only allowed at the end
+func bytes32ToString(b [32]byte) (string, error) {
+	s := bytes.TrimRight(b[:], "\x00")
+	if bytes.IndexByte(s, 0) >= 0 {
+		return "", errors.New("zero byte in string")
+	}
+	return string(s), nil
+}
+
+// nodesGovEventTopics returns the sorted topic IDs of all NodesGov events
+func nodesGovEventTopics() []gethcmn.Hash {
+	topics := make([]gethcmn.Hash, 0, len(nodesGovABI.Events))
+	for _, event := range nodesGovABI.Events {
+		topics = append(topics, event.ID)
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		return bytes.Compare(topics[i][:], topics[j][:]) < 0
+	})
+	return topics
+}
+
+func decodeNodesGovLog(log gethtypes.Log) (NodesGovEvent, error) {
+	if len(log.Topics) == 0 {
+		return NodesGovEvent{}, errors.New("log without topics")
+	}
+	event, err := nodesGovABI.EventByID(log.Topics[0])
+	if err != nil {
+		return NodesGovEvent{}, err
+	}
+	if len(log.Topics) != 2 || len(log.Data) != 0 {
+		return NodesGovEvent{}, fmt.Errorf("invalid %s log: %d topics, %d bytes data",
+			event.Name, len(log.Topics), len(log.Data))
+	}
+	id := log.Topics[1].Big()
+	if !id.IsUint64() {
+		return NodesGovEvent{}, errors.New("invalid node id: " + id.String())
+	}
+	return NodesGovEvent{
+		Event:    event.Name,
+		NodeID:   id.Uint64(),
+		BlockNum: log.BlockNumber,
+		TxHash:   log.TxHash,
+		LogIndex: log.Index,
+	}, nil
+}
+
+// unpackStrict unpacks the outputs of the method, and rejects the data
+// which is not exactly the canonical encoding of the unpacked values
+// (e.g. with trailing bytes or unusual offsets)
+func unpackStrict(_abi abi.ABI, method string, data []byte) ([]any, error) {
+	outputs := _abi.Methods[method].Outputs
+	values, err := outputs.Unpack(data)
+	if err != nil {
+		return nil, err
+	}
+	packed, err := outputs.Pack(values...)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(packed, data) {
+		return nil, fmt.Errorf("non-canonical encoding, length: %d, expected: %d", len(data), len(packed))
+	}
+	return values, nil
+}
@@ -0,0 +1,112 @@
+package sbch
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func packNodeStrings(t *testing.T, id *big.Int, rpcUrl, intro string) []byte {
+	data, err := nodesGovStringsABI.Methods["nodes"].Outputs.Pack(id, [32]byte{0xab}, rpcUrl, intro)
+	require.NoError(t, err)
+	return data
+}
+
+func packNodeBytes32(t *testing.T, rpcUrl, intro string) []byte {
+	var url32, intro32 [32]byte
+	copy(url32[:], rpcUrl)
+	copy(intro32[:], intro)
+	data, err := nodesGovABI.Methods["nodes"].Outputs.Pack(big.NewInt(1), [32]byte{0xab}, url32, intro32)
+	require.NoError(t, err)
+	return data
+}
+
+func TestDecodeNodeInfo(t *testing.T) {
+	node, err := decodeNodeInfo(packNodeBytes32(t, "127.0.0.1:8545", "intro"))
+	require.NoError(t, err)
+	require.Equal(t, NodeInfo{ID: 1, PbkHash: gethcmn.Hash{0xab}, RpcUrl: "127.0.0.1:8545", Intro: "intro"}, node)
+
+	longUrl := "https://" + strings.Repeat("a", 60) + ".example.com:8545"
+	node, err = decodeNodeInfo(packNodeStrings(t, big.NewInt(2), longUrl, ""))
+	require.NoError(t, err)
+	require.Equal(t, NodeInfo{ID: 2, PbkHash: gethcmn.Hash{0xab}, RpcUrl: longUrl}, node)
+}
+
+func TestDecodeNodeInfoInvalid(t *testing.T) {
+	valid := packNodeStrings(t, big.NewInt(1), "127.0.0.1:8545", "intro")
+
+	_, err := decodeNodeInfo(valid[:32*3])
+	requireErrorContains(t, err, "invalid NodeInfo data")
+	_, err = decodeNodeInfo(valid[:len(valid)-32])
+	requireErrorContains(t, err, "invalid NodeInfo data")
+	_, err = decodeNodeInfo(append(append([]byte{}, valid...), make([]byte, 32)...))
+	requireErrorContains(t, err, "non-canonical encoding")
+
+	// offset of rpcUrl points to the intro
+	bad := append([]byte{}, valid...)
+	copy(bad[32*2:32*3], bad[32*3:32*4])
+	_, err = decodeNodeInfo(bad)
+	requireErrorContains(t, err, "non-canonical encoding")
+
+	_, err = decodeNodeInfo(packNodeBytes32(t, "127.0.0.1\x00:8545", ""))
+	requireErrorContains(t, err, "zero byte in string")
+	_, err = decodeNodeInfo(packNodeStrings(t, new(big.Int).Lsh(big.NewInt(1), 64), "", ""))
+	requireErrorContains(t, err, "invalid node id")
+	_, err = decodeNodeInfo(packNodeStrings(t, big.NewInt(1), strings.Repeat("a", maxNodeFieldLen+1), ""))
+	requireErrorContains(t, err, "string too long")
+	_, err = decodeNodeInfo(packNodeStrings(t, big.NewInt(1), "\xff", ""))
+	requireErrorContains(t, err, "invalid utf8 string")
+}
+
+func TestUnpackNodeCount(t *testing.T) {
+	n, err := unpackNodeCount(gethcmn.LeftPadBytes([]byte{3}, 32))
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), n)
+
+	_, err = unpackNodeCount([]byte{3})
+	requireErrorContains(t, err, "invalid NodeCount data")
+	_, err = unpackNodeCount(make([]byte, 64))
+	requireErrorContains(t, err, "non-canonical encoding")
+	_, err = unpackNodeCount(gethcmn.LeftPadBytes([]byte{1, 0, 0, 0, 0, 0, 0, 0, 0}, 32))
+	requireErrorContains(t, err, "invalid NodeCount")
+	n, err = unpackNodeCount(gethcmn.LeftPadBytes(big.NewInt(maxNodeCount).Bytes(), 32))
+	require.NoError(t, err)
+	require.Equal(t, uint64(maxNodeCount), n)
+	_, err = unpackNodeCount(gethcmn.LeftPadBytes(big.NewInt(maxNodeCount+1).Bytes(), 32))
+	require.EqualError(t, err, fmt.Sprintf("invalid NodeCount: %d", maxNodeCount+1))
+}
+
+func TestDecodeNodesGovLog(t *testing.T) {
+	topic := crypto.Keccak256Hash([]byte("NodeRemoved(uint256)"))
+	require.Contains(t, nodesGovEventTopics(), topic)
+
+	event, err := decodeNodesGovLog(gethtypes.Log{
+		Topics:      []gethcmn.Hash{topic, gethcmn.BigToHash(big.NewInt(7))},
+		BlockNumber: 123,
+		TxHash:      gethcmn.Hash{0x01},
+		Index:       2,
+	})
+	require.NoError(t, err)
+	require.Equal(t, NodesGovEvent{Event: "NodeRemoved", NodeID: 7, BlockNum: 123,
+		TxHash: gethcmn.Hash{0x01}, LogIndex: 2}, event)
+
+	_, err = decodeNodesGovLog(gethtypes.Log{})
+	requireErrorContains(t, err, "log without topics")
+	_, err = decodeNodesGovLog(gethtypes.Log{Topics: []gethcmn.Hash{{0x01}, {}}})
+	require.Error(t, err)
+	_, err = decodeNodesGovLog(gethtypes.Log{Topics: []gethcmn.Hash{topic}})
+	requireErrorContains(t, err, "invalid NodeRemoved log")
+	_, err = decodeNodesGovLog(gethtypes.Log{Topics: []gethcmn.Hash{topic, {0x01}}})
+	requireErrorContains(t, err, "invalid node id")
+}
+
+func requireErrorContains(t *testing.T, err error, contains string) {
+	require.Error(t, err)
+	require.Contains(t, err.Error(), contains)
+}
@@ -2,7 +2,9 @@ package sbch
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"reflect"
 	"sort"
@@ -17,59 +19,204 @@ import (
 var _ RpcClient = (*ClusterClient)(nil)
 
 type ClusterClient struct {
-	clients     []RpcClient
-	PublicNodes []NodeInfo
+	clients        []RpcClient
+	PublicNodes    []NodeInfo
+	chainPolicy    ChainPolicy
+	onDisagreement func(report *Disagreement)
+
+	privateUrls map[string]bool // the private nodes are trusted and never excluded
+
+	exclusionsLock sync.RWMutex
+	exclusions     map[string]NodeExclusion // rpcUrl => exclusion
 }
 
-func NewClusterRpcClient(nodesGovAddr string, nodes []NodeInfo, privateUrls []string,
-	reqTimeout time.Duration) (*ClusterClient, error) {
+// NewClusterRpcClient rejects the nodes with unexpected pubkey, not attested or on the wrong chain,
+// and excludes the lagging nodes until they catch up. Private nodes are not attested or excluded.
+func NewClusterRpcClient(ctx context.Context, nodesGovAddr string, nodes []NodeInfo, privateUrls []string,
+	reqTimeout time.Duration, chainPolicy ChainPolicy, enclavePolicy EnclavePolicy) (*ClusterClient, error) {
 
-	clients := make([]RpcClient, 0, len(nodes))
+	clients := make([]RpcClient, 0, len(nodes)+len(privateUrls))
 	for _, node := range nodes {
-		client, err := NewSimpleRpcClient(nodesGovAddr, node.RpcUrl, reqTimeout)
+		simpleClient, err := NewSimpleRpcClient(nodesGovAddr, node.RpcUrl, reqTimeout)
 		if err != nil {
 			return nil, fmt.Errorf("dail %s failed: %w", node.RpcUrl, err)
 		}
-		pbk, err := client.GetRpcPubkey()
+		client := NewResilientClient(simpleClient)
+		pbk, err := client.GetRpcPubkey(ctx)
 		if err != nil {
 			return nil, fmt.Errorf("get pubkey from %s failed: %w", node.RpcUrl, err)
 		}
 		if sha256.Sum256(pbk) != node.PbkHash {
 			return nil, fmt.Errorf("pubkey not match: %s", node.RpcUrl)
 		}
+		if enclavePolicy.enabled() {
+			if err = enclavePolicy.attestNode(ctx, client, pbk); err != nil {
+				return nil, fmt.Errorf("%s: %w", node.RpcUrl, err)
+			}
+		}
 		clients = append(clients, client)
 	}
+	private := make(map[string]bool, len(privateUrls))
 	for _, url := range privateUrls {
 		client, err := NewSimpleRpcClient(nodesGovAddr, url, reqTimeout)
 		if err != nil {
 			return nil, fmt.Errorf("dail %s failed: %w", url, err)
 		}
-		clients = append(clients, client)
+		clients = append(clients, NewResilientClient(client))
+		private[url] = true
 	}
-	return &ClusterClient{
+	cluster := &ClusterClient{
 		clients:     clients,
 		PublicNodes: nodes,
-	}, nil
+		chainPolicy: chainPolicy,
+		privateUrls: private,
+		exclusions:  map[string]NodeExclusion{},
+	}
+	if chainPolicy.enabled() {
+		for _, client := range clients {
+			status, err := client.GetChainStatus(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("get chain status from %s failed: %w", client.RpcURL(), err)
+			}
+			err = chainPolicy.check(status, time.Now())
+			if errors.Is(err, ErrWrongChain) {
+				return nil, fmt.Errorf("%s: %w", client.RpcURL(), err)
+			}
+			cluster.updateExclusion(client.RpcURL(), err)
+		}
+	}
+	return cluster, nil
+}
+
+// CheckNodes checks all nodes against the chain policy concurrently,
+// excludes the nodes on the wrong chain or lagging, and includes the nodes that catch up.
+// Nodes which can not be reached keep their state.
+func (cluster *ClusterClient) CheckNodes(ctx context.Context) {
+	if !cluster.chainPolicy.enabled() {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, client := range cluster.clients {
+		wg.Add(1)
+		go func(client RpcClient) {
+			defer wg.Done()
+			status, err := client.GetChainStatus(ctx)
+			if err == nil {
+				cluster.updateExclusion(client.RpcURL(), cluster.chainPolicy.check(status, time.Now()))
+			}
+		}(client)
+	}
+	wg.Wait()
+}
+
+func (cluster *ClusterClient) updateExclusion(rpcUrl string, checkErr error) {
+	if cluster.privateUrls[rpcUrl] {
+		return
+	}
+	cluster.exclusionsLock.Lock()
+	defer cluster.exclusionsLock.Unlock()
+
+	if checkErr == nil {
+		delete(cluster.exclusions, rpcUrl)
+		return
+	}
+	exclusion, ok := cluster.exclusions[rpcUrl]
+	if !ok {
+		exclusion = NodeExclusion{RpcUrl: rpcUrl, Since: time.Now().Unix()}
+	}
+	exclusion.Reason = checkErr.Error()
+	cluster.exclusions[rpcUrl] = exclusion
+}
+
+// Exclusions returns the nodes excluded by the chain check
+func (cluster *ClusterClient) Exclusions() []NodeExclusion {
+	cluster.exclusionsLock.RLock()
+	defer cluster.exclusionsLock.RUnlock()
+
+	result := make([]NodeExclusion, 0, len(cluster.exclusions))
+	for _, exclusion := range cluster.exclusions {
+		result = append(result, exclusion)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].RpcUrl < result[j].RpcUrl
+	})
+	return result
+}
+
+// activeClients returns the clients not excluded,
+// it fails if fewer public nodes than required by the chain policy are active
+func (cluster *ClusterClient) activeClients() ([]RpcClient, error) {
+	cluster.exclusionsLock.RLock()
+	defer cluster.exclusionsLock.RUnlock()
+
+	if len(cluster.clients) == 0 {
+		return nil, fmt.Errorf("no clients")
+	}
+	if len(cluster.exclusions) == 0 {
+		return cluster.clients, nil
+	}
+	clients := make([]RpcClient, 0, len(cluster.clients))
+	nPublic, nActivePublic := 0, 0
+	for _, client := range cluster.clients {
+		isPublic := !cluster.privateUrls[client.RpcURL()]
+		if isPublic {
+			nPublic++
+		}
+		if _, ok := cluster.exclusions[client.RpcURL()]; !ok {
+			clients = append(clients, client)
+			if isPublic {
+				nActivePublic++
+			}
+		}
+	}
+	if minActive := cluster.chainPolicy.minActiveNodes(nPublic); nActivePublic < minActive {
+		return nil, fmt.Errorf("%w: %d of %d public nodes, min: %d", ErrTooFewActiveNodes, nActivePublic, nPublic, minActive)
+	}
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("no clients")
+	}
+	return clients, nil
+}
+
+// SetDisagreementHandler sets the function called with the report when the nodes return different responses
+func (cluster *ClusterClient) SetDisagreementHandler(fn func(report *Disagreement)) {
+	cluster.onDisagreement = fn
 }
 
 func (cluster *ClusterClient) RpcURL() string {
 	return "clusterRpcClient"
 }
 
-func (cluster *ClusterClient) GetRpcPubkey() ([]byte, error) {
+// NodesHealth returns the circuit breaker states of the nodes
+func (cluster *ClusterClient) NodesHealth() []NodeHealth {
+	var result []NodeHealth
+	for _, client := range cluster.clients {
+		if c, ok := client.(*ResilientClient); ok {
+			result = append(result, c.Health())
+		}
+	}
+	return result
+}
+
+func (cluster *ClusterClient) GetRpcPubkey(ctx context.Context) ([]byte, error) {
 	return nil, fmt.Errorf("unsupported operation")
 }
 
-func (cluster *ClusterClient) GetSbchdNodes() ([]NodeInfo, error) {
-	result, err := cluster.getFromAllNodes("GetSbchdNodes")
-	if err != nil {
-		return nil, err
-	}
-	return result.([]NodeInfo), err
+func (cluster *ClusterClient) GetRpcPubkeyReport(ctx context.Context) ([]byte, error) {
+	return nil, fmt.Errorf("unsupported operation")
+}
+
+func (cluster *ClusterClient) GetChainStatus(ctx context.Context) (ChainStatus, error) {
+	return ChainStatus{}, fmt.Errorf("unsupported operation")
 }
 
-func (cluster *ClusterClient) GetSbchdNodesSorted() ([]NodeInfo, error) {
-	nodes, err := cluster.GetSbchdNodes()
+func (cluster *ClusterClient) GetSbchdNodes(ctx context.Context) ([]NodeInfo, error) {
+	return getFromAllNodes(ctx, cluster, "GetSbchdNodes", RpcClient.GetSbchdNodes, canonicalNodes)
+}
+
+func (cluster *ClusterClient) GetSbchdNodesSorted(ctx context.Context) ([]NodeInfo, error) {
+	nodes, err := cluster.GetSbchdNodes(ctx)
 	if err == nil {
 		sortNodes(nodes)
 	}
@@ -81,99 +228,148 @@ func sortNodes(nodes []NodeInfo) {
 	})
 }
 
-func (cluster *ClusterClient) GetRedeemingUtxosForOperators() ([]*sbchrpctypes.UtxoInfo, error) {
-	result, err := cluster.getFromAllNodes("GetRedeemingUtxosForOperators")
-	if err != nil {
-		return nil, err
-	}
-	return result.([]*sbchrpctypes.UtxoInfo), err
+func (cluster *ClusterClient) GetRedeemingUtxosForOperators(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error) {
+	return getFromAllNodes(ctx, cluster, "GetRedeemingUtxosForOperators",
+		RpcClient.GetRedeemingUtxosForOperators, canonicalUtxos)
 }
-func (cluster *ClusterClient) GetRedeemingUtxosForMonitors() ([]*sbchrpctypes.UtxoInfo, error) {
-	result, err := cluster.getFromAllNodes("GetRedeemingUtxosForMonitors")
-	if err != nil {
-		return nil, err
-	}
-	return result.([]*sbchrpctypes.UtxoInfo), err
+func (cluster *ClusterClient) GetRedeemingUtxosForMonitors(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error) {
+	return getFromAllNodes(ctx, cluster, "GetRedeemingUtxosForMonitors",
+		RpcClient.GetRedeemingUtxosForMonitors, canonicalUtxos)
 }
-func (cluster *ClusterClient) GetToBeConvertedUtxosForOperators() ([]*sbchrpctypes.UtxoInfo, error) {
-	result, err := cluster.getFromAllNodes("GetToBeConvertedUtxosForOperators")
-	if err != nil {
-		return nil, err
-	}
-	return result.([]*sbchrpctypes.UtxoInfo), err
+func (cluster *ClusterClient) GetToBeConvertedUtxosForOperators(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error) {
+	return getFromAllNodes(ctx, cluster, "GetToBeConvertedUtxosForOperators",
+		RpcClient.GetToBeConvertedUtxosForOperators, canonicalUtxos)
 }
-func (cluster *ClusterClient) GetToBeConvertedUtxosForMonitors() ([]*sbchrpctypes.UtxoInfo, error) {
-	result, err := cluster.getFromAllNodes("GetToBeConvertedUtxosForMonitors")
-	if err != nil {
-		return nil, err
-	}
-	return result.([]*sbchrpctypes.UtxoInfo), err
+func (cluster *ClusterClient) GetToBeConvertedUtxosForMonitors(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error) {
+	return getFromAllNodes(ctx, cluster, "GetToBeConvertedUtxosForMonitors",
+		RpcClient.GetToBeConvertedUtxosForMonitors, canonicalUtxos)
+}
+
+func (cluster *ClusterClient) GetRedeemableUtxos(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error) {
+	return getFromAllNodes(ctx, cluster, "GetRedeemableUtxos", RpcClient.GetRedeemableUtxos, canonicalUtxos)
+}
+
+func (cluster *ClusterClient) GetLostAndFoundUtxos(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error) {
+	return getFromAllNodes(ctx, cluster, "GetLostAndFoundUtxos", RpcClient.GetLostAndFoundUtxos, canonicalUtxos)
+}
+
+func (cluster *ClusterClient) GetMonitors(ctx context.Context) ([]gethcmn.Address, error) {
+	return getFromAllNodes(ctx, cluster, "GetMonitors", RpcClient.GetMonitors, canonicalAddresses)
+}
+
+func (cluster *ClusterClient) GetCcInfo(ctx context.Context) (*sbchrpctypes.CcInfo, error) {
+	return getFromAllNodes(ctx, cluster, "GetCcInfo", RpcClient.GetCcInfo, canonicalCcInfo)
+}
+
+// GetNodesGovEvents should be called with a toBlock which all nodes have reached, see GetBlockNumber
+func (cluster *ClusterClient) GetNodesGovEvents(ctx context.Context, fromBlock, toBlock uint64) ([]NodesGovEvent, error) {
+	return getFromAllNodes(ctx, cluster, "GetNodesGovEvents",
+		func(client RpcClient, ctx context.Context) ([]NodesGovEvent, error) {
+			return client.GetNodesGovEvents(ctx, fromBlock, toBlock)
+		}, canonicalEvents)
 }
 
-func (cluster *ClusterClient) GetMonitors() ([]gethcmn.Address, error) {
-	result, err := cluster.getFromAllNodes("GetMonitors")
+// GetBlockNumber returns the lowest latest block number of the nodes, which all of them have reached
+func (cluster *ClusterClient) GetBlockNumber(ctx context.Context) (uint64, error) {
+	clients, err := cluster.activeClients()
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type nodeResp struct {
+		rpcUrl   string
+		blockNum uint64
+		err      error
+	}
+	respCh := make(chan nodeResp, len(clients))
+	for _, client := range clients {
+		go func(client RpcClient) {
+			blockNum, err := client.GetBlockNumber(ctx)
+			respCh <- nodeResp{rpcUrl: client.RpcURL(), blockNum: blockNum, err: err}
+		}(client)
 	}
-	return result.([]gethcmn.Address), err
+
+	var minBlockNum uint64
+	for i := range clients {
+		r := <-respCh
+		if r.err != nil {
+			return 0, fmt.Errorf("failed to call %s: %w", r.rpcUrl, r.err)
+		}
+		if i == 0 || r.blockNum < minBlockNum {
+			minBlockNum = r.blockNum
+		}
+	}
+	return minBlockNum, nil
 }
 
-func (cluster *ClusterClient) getFromAllNodes(methodName string) (any, error) {
-	if len(cluster.clients) == 0 {
-		return nil, fmt.Errorf("no clients")
+// getFromAllNodes calls all nodes concurrently, all of them should succeed and return the same response
+// after being canonicalized. The remaining calls are cancelled as soon as one of them fails.
+// If the responses do not match, the remaining responses are still collected to build a Disagreement report.
+func getFromAllNodes[T any](ctx context.Context, cluster *ClusterClient, methodName string,
+	call func(client RpcClient, ctx context.Context) (T, error), canonicalize func(T) T) (result T, err error) {
+
+	clients, err := cluster.activeClients()
+	if err != nil {
+		return result, err
 	}
 
-	nClients := len(cluster.clients)
-	resps := make([]any, nClients)
-	errors := make([]error, nClients)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type nodeResp struct {
+		idx  int
+		resp T
+		err  error
+	}
+	nClients := len(clients)
+	respCh := make(chan nodeResp, nClients)
 
 	// send post to nodes concurrently
-	wg := sync.WaitGroup{}
-	wg.Add(nClients)
-	for i, client := range cluster.clients {
+	for i, client := range clients {
 		go func(idx int, client RpcClient) {
-			resps[idx], errors[idx] = getFromOneNode(client, methodName)
-			wg.Done()
+			resp, err := call(client, ctx)
+			if err == nil {
+				resp = canonicalize(resp)
+			}
+			respCh <- nodeResp{idx: idx, resp: resp, err: err}
 		}(i, client)
 	}
-	wg.Wait()
 
-	// fail if one of node return error
-	for idx, err := range errors {
-		if err != nil {
-			return nil, fmt.Errorf("failed to call %s: %w",
-				cluster.clients[idx].RpcURL(), err)
+	// fail if one of node return error, all responses should be same
+	var resps []nodeResponse
+	var failedNodes map[string]string
+	mismatched := false
+	for i := 0; i < nClients; i++ {
+		r := <-respCh
+		rpcUrl := clients[r.idx].RpcURL()
+		if r.err != nil {
+			if !mismatched {
+				return result, fmt.Errorf("failed to call %s: %w", rpcUrl, r.err)
+			}
+			if failedNodes == nil {
+				failedNodes = make(map[string]string)
+			}
+			failedNodes[rpcUrl] = r.err.Error()
+			continue
 		}
-	}
-
-	// all responses should be same
-	resp0 := resps[0]
-	for idx, resp := range resps {
-		if idx > 0 && !reflect.DeepEqual(resp0, resp) {
-			return nil, fmt.Errorf("response not match between: %s, %s",
-				cluster.clients[0].RpcURL(), cluster.clients[idx].RpcURL())
+		if len(resps) == 0 {
+			result = r.resp
+		} else if !reflect.DeepEqual(result, r.resp) {
+			mismatched = true
 		}
+		resps = append(resps, nodeResponse{rpcUrl: rpcUrl, resp: r.resp})
 	}
 
-	//fmt.Println("resp:", string(resp0))
-	return resp0, nil
-}
-
-func getFromOneNode(client RpcClient, methodName string) (any, error) {
-	switch methodName {
-	case "GetSbchdNodes":
-		return client.GetSbchdNodes()
-	case "GetRedeemingUtxosForOperators":
-		return client.GetRedeemingUtxosForOperators()
-	case "GetRedeemingUtxosForMonitors":
-		return client.GetRedeemingUtxosForMonitors()
-	case "GetToBeConvertedUtxosForOperators":
-		return client.GetToBeConvertedUtxosForOperators()
-	case "GetToBeConvertedUtxosForMonitors":
-		return client.GetToBeConvertedUtxosForMonitors()
-	case "GetMonitors":
-		return client.GetMonitors()
-	default:
-		panic("unknown method") // unreachable
+	if mismatched {
+		report := newDisagreement(methodName, resps, failedNodes)
+		if cluster.onDisagreement != nil {
+			cluster.onDisagreement(report)
+		}
+		var zero T
+		return zero, &DisagreementError{Report: report}
 	}
+	return result, nil
 }
@@ -0,0 +1,258 @@
+package sbch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+
+	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
+)
+
+const (
+	maxRetries     = 2
+	retryBaseDelay = 200 * time.Millisecond
+	retryMaxDelay  = 2 * time.Second
+	attemptTimeout = 30 * time.Second // so a call with retries does not take maxRetries+1 times the request timeout
+
+	breakerFailureThreshold = 5
+	breakerOpenDuration     = 30 * time.Second
+)
+
+const (
+	BreakerClosed   = "closed"    // healthy
+	BreakerOpen     = "open"      // unhealthy, calls fail fast
+	BreakerHalfOpen = "half-open" // probing
+)
+
+var ErrNodeUnhealthy = errors.New("node unhealthy")
+
+var _ RpcClient = (*ResilientClient)(nil)
+
+// ResilientClient retries failed calls with jittered backoff,
+// and stops calling the node for a while after repeated failures.
+type ResilientClient struct {
+	client         RpcClient
+	breaker        *circuitBreaker
+	attemptTimeout time.Duration
+}
+
+func NewResilientClient(client RpcClient) *ResilientClient {
+	return &ResilientClient{
+		client:         client,
+		breaker:        newCircuitBreaker(),
+		attemptTimeout: attemptTimeout,
+	}
+}
+
+// NodeHealth is the circuit breaker state of a node
+type NodeHealth struct {
+	RpcUrl              string `json:"rpcUrl"`
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutiveFailures"`
+	TotalCalls          uint64 `json:"totalCalls"`
+	TotalFailures       uint64 `json:"totalFailures"`
+	TotalRetries        uint64 `json:"totalRetries"`
+	LastError           string `json:"lastError,omitempty"`
+	OpenedAt            int64  `json:"openedAt,omitempty"`
+}
+
+func (client *ResilientClient) Health() NodeHealth {
+	health := client.breaker.health()
+	health.RpcUrl = client.RpcURL()
+	return health
+}
+
+func (client *ResilientClient) RpcURL() string {
+	return client.client.RpcURL()
+}
+
+func (client *ResilientClient) GetSbchdNodes(ctx context.Context) ([]NodeInfo, error) {
+	return callWithRetry(ctx, client, client.client.GetSbchdNodes)
+}
+func (client *ResilientClient) GetRedeemingUtxosForOperators(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error) {
+	return callWithRetry(ctx, client, client.client.GetRedeemingUtxosForOperators)
+}
+func (client *ResilientClient) GetRedeemingUtxosForMonitors(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error) {
+	return callWithRetry(ctx, client, client.client.GetRedeemingUtxosForMonitors)
+}
+func (client *ResilientClient) GetToBeConvertedUtxosForOperators(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error) {
+	return callWithRetry(ctx, client, client.client.GetToBeConvertedUtxosForOperators)
+}
+func (client *ResilientClient) GetToBeConvertedUtxosForMonitors(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error) {
+	return callWithRetry(ctx, client, client.client.GetToBeConvertedUtxosForMonitors)
+}
+func (client *ResilientClient) GetRedeemableUtxos(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error) {
+	return callWithRetry(ctx, client, client.client.GetRedeemableUtxos)
+}
+func (client *ResilientClient) GetLostAndFoundUtxos(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error) {
+	return callWithRetry(ctx, client, client.client.GetLostAndFoundUtxos)
+}
+func (client *ResilientClient) GetMonitors(ctx context.Context) ([]gethcmn.Address, error) {
+	return callWithRetry(ctx, client, client.client.GetMonitors)
+}
+func (client *ResilientClient) GetCcInfo(ctx context.Context) (*sbchrpctypes.CcInfo, error) {
+	return callWithRetry(ctx, client, client.client.GetCcInfo)
+}
+func (client *ResilientClient) GetRpcPubkey(ctx context.Context) ([]byte, error) {
+	return callWithRetry(ctx, client, client.client.GetRpcPubkey)
+}
+func (client *ResilientClient) GetRpcPubkeyReport(ctx context.Context) ([]byte, error) {
+	return callWithRetry(ctx, client, client.client.GetRpcPubkeyReport)
+}
+func (client *ResilientClient) GetChainStatus(ctx context.Context) (ChainStatus, error) {
+	return callWithRetry(ctx, client, client.client.GetChainStatus)
+}
+func (client *ResilientClient) GetBlockNumber(ctx context.Context) (uint64, error) {
+	return callWithRetry(ctx, client, client.client.GetBlockNumber)
+}
+func (client *ResilientClient) GetNodesGovEvents(ctx context.Context, fromBlock, toBlock uint64) ([]NodesGovEvent, error) {
+	return callWithRetry(ctx, client, func(ctx context.Context) ([]NodesGovEvent, error) {
+		return client.client.GetNodesGovEvents(ctx, fromBlock, toBlock)
+	})
+}
+
+func callWithRetry[T any](ctx context.Context, client *ResilientClient,
+	fn func(ctx context.Context) (T, error)) (result T, err error) {
+
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			client.breaker.onRetry()
+			select {
+			case <-time.After(backoffDelay(attempt)):
+			case <-ctx.Done():
+				return result, ctx.Err()
+			}
+		}
+
+		if err = client.breaker.allow(); err != nil {
+			return result, err
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, client.attemptTimeout)
+		result, err = fn(attemptCtx)
+		cancel()
+		if ctx.Err() != nil {
+			// cancelled by the caller, not a failure of the node
+			client.breaker.onCancel()
+			return result, err
+		}
+		if errors.Is(err, ErrReportNotSupported) {
+			// an answer of the node, which a retry does not change
+			client.breaker.onResult(nil)
+			return result, err
+		}
+		client.breaker.onResult(err)
+		if err == nil {
+			return result, nil
+		}
+	}
+	return result, err
+}
+
+// full jitter: random delay in [0, min(retryMaxDelay, retryBaseDelay*2^(attempt-1)))
+func backoffDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << (attempt - 1)
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(delay)))
+}
+
+type circuitBreaker struct {
+	failureThreshold int
+	openDuration     time.Duration
+	now              func() time.Time // replaced in tests
+
+	lock                sync.Mutex
+	state               string
+	consecutiveFailures int
+	openedAt            time.Time
+	probing             bool // only one probe is allowed in half-open state
+	totalCalls          uint64
+	totalFailures       uint64
+	totalRetries        uint64
+	lastError           string
+}
+
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{
+		failureThreshold: breakerFailureThreshold,
+		openDuration:     breakerOpenDuration,
+		now:              time.Now,
+		state:            BreakerClosed,
+	}
+}
+
+func (breaker *circuitBreaker) allow() error {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	if breaker.state == BreakerOpen && breaker.now().Sub(breaker.openedAt) >= breaker.openDuration {
+		breaker.state = BreakerHalfOpen
+	}
+	switch breaker.state {
+	case BreakerOpen:
+		return fmt.Errorf("%w: %s", ErrNodeUnhealthy, breaker.lastError)
+	case BreakerHalfOpen:
+		if breaker.probing {
+			return fmt.Errorf("%w: probing", ErrNodeUnhealthy)
+		}
+		breaker.probing = true
+	}
+	breaker.totalCalls++
+	return nil
+}
+
+func (breaker *circuitBreaker) onResult(err error) {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	breaker.probing = false
+	if err == nil {
+		breaker.state = BreakerClosed
+		breaker.consecutiveFailures = 0
+		return
+	}
+
+	breaker.totalFailures++
+	breaker.consecutiveFailures++
+	breaker.lastError = err.Error()
+	if breaker.state == BreakerHalfOpen || breaker.consecutiveFailures >= breaker.failureThreshold {
+		breaker.state = BreakerOpen
+		breaker.openedAt = breaker.now()
+	}
+}
+
+func (breaker *circuitBreaker) onCancel() {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+	breaker.probing = false
+}
+
+func (breaker *circuitBreaker) onRetry() {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+	breaker.totalRetries++
+}
+
+func (breaker *circuitBreaker) health() NodeHealth {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	health := NodeHealth{
+		State:               breaker.state,
+		ConsecutiveFailures: breaker.consecutiveFailures,
+		TotalCalls:          breaker.totalCalls,
+		TotalFailures:       breaker.totalFailures,
+		TotalRetries:        breaker.totalRetries,
+		LastError:           breaker.lastError,
+	}
+	if breaker.state != BreakerClosed {
+		health.OpenedAt = breaker.openedAt.Unix()
+	}
+	return health
+}
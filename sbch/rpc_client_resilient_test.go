@@ -0,0 +1,112 @@
+package sbch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyClient fails the first nFailures calls of GetMonitors
+type flakyClient struct {
+	SimpleRpcClient
+	nFailures int
+	nCalls    int
+}
+
+func (client *flakyClient) GetMonitors(ctx context.Context) ([]gethcmn.Address, error) {
+	client.nCalls++
+	if client.nCalls <= client.nFailures {
+		return nil, errors.New("connection refused")
+	}
+	return []gethcmn.Address{{0x01}}, nil
+}
+
+func TestResilientClientRetry(t *testing.T) {
+	flaky := &flakyClient{SimpleRpcClient: SimpleRpcClient{rpcUrl: "flaky"}, nFailures: 2}
+	client := NewResilientClient(flaky)
+
+	monitors, err := client.GetMonitors(context.Background())
+	require.NoError(t, err)
+	require.Len(t, monitors, 1)
+	require.Equal(t, 3, flaky.nCalls)
+
+	health := client.Health()
+	require.Equal(t, "flaky", health.RpcUrl)
+	require.Equal(t, BreakerClosed, health.State)
+	require.Equal(t, uint64(3), health.TotalCalls)
+	require.Equal(t, uint64(2), health.TotalFailures)
+	require.Equal(t, uint64(2), health.TotalRetries)
+	require.Equal(t, 0, health.ConsecutiveFailures)
+}
+
+func TestResilientClientBreaker(t *testing.T) {
+	flaky := &flakyClient{SimpleRpcClient: SimpleRpcClient{rpcUrl: "flaky"}, nFailures: 100}
+	client := NewResilientClient(flaky)
+	client.breaker.failureThreshold = 3
+	now := time.Now()
+	client.breaker.now = func() time.Time { return now }
+
+	_, err := client.GetMonitors(context.Background())
+	require.EqualError(t, err, "connection refused")
+	require.Equal(t, BreakerOpen, client.Health().State)
+
+	// fail fast while open
+	_, err = client.GetMonitors(context.Background())
+	require.ErrorIs(t, err, ErrNodeUnhealthy)
+	require.Equal(t, 3, flaky.nCalls)
+
+	// failed probe opens the breaker again, and is not retried in the same call
+	now = now.Add(breakerOpenDuration)
+	_, err = client.GetMonitors(context.Background())
+	require.ErrorIs(t, err, ErrNodeUnhealthy)
+	require.Equal(t, 4, flaky.nCalls)
+	require.Equal(t, BreakerOpen, client.Health().State)
+
+	// successful probe closes the breaker
+	flaky.nFailures = 0
+	now = now.Add(breakerOpenDuration)
+	_, err = client.GetMonitors(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, BreakerClosed, client.Health().State)
+}
+
+// slowClient blocks GetMonitors until ctx is done
+type slowClient struct {
+	SimpleRpcClient
+	nCalls int
+}
+
+func (client *slowClient) GetMonitors(ctx context.Context) ([]gethcmn.Address, error) {
+	client.nCalls++
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestResilientClientAttemptTimeout(t *testing.T) {
+	slow := &slowClient{}
+	client := NewResilientClient(slow)
+	client.attemptTimeout = 10 * time.Millisecond
+
+	_, err := client.GetMonitors(context.Background())
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, maxRetries+1, slow.nCalls)
+	require.Equal(t, uint64(maxRetries+1), client.Health().TotalFailures)
+}
+
+func TestResilientClientCancel(t *testing.T) {
+	c := &blockingClient{cancelled: make(chan struct{})}
+	client := NewResilientClient(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.GetMonitors(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	health := client.Health()
+	require.Equal(t, BreakerClosed, health.State)
+	require.Equal(t, uint64(0), health.TotalFailures)
+}
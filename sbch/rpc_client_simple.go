@@ -1,32 +1,38 @@
 package sbch
 
 import (
-	"bytes"
 	"context"
-	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"sync"
 	"time"
 
-	geth "github.com/ethereum/go-ethereum"
 	gethcmn "github.com/ethereum/go-ethereum/common"
-	"github.com/holiman/uint256"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
 
 	sbchrpcclient "github.com/smartbch/smartbch/rpc/client"
 	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
 )
 
+var _ RpcClient = (*SimpleRpcClient)(nil)
+
 const (
-	getNodeCountSel = "0x39bf397e" // ethers.utils.id('getNodeCount()')
-	getNodeByIdxSel = "0x1c53c280" // ethers.utils.id('nodes(uint256)')
-)
+	errCodeInvalidRequest = -32600
+	errCodeMethodNotFound = -32601
 
-var _ RpcClient = (*SimpleRpcClient)(nil)
+	rpcPubkeyReportMethod = "sbch_getRpcPubkeyReport" // not served by smartbch v0.4.5, see EnclavePolicy
+)
 
 type SimpleRpcClient struct {
 	rpcUrl        string
 	reqTimeout    time.Duration
 	nodesGovAddr  gethcmn.Address
 	sbchRpcClient *sbchrpcclient.Client
+	rpcClient     *rpc.Client // for the raw calls not provided by sbchRpcClient
 }
 
 func NewSimpleRpcClient(nodesGovAddr, rpcUrl string,
@@ -36,12 +42,17 @@ func NewSimpleRpcClient(nodesGovAddr, rpcUrl string,
 	if err != nil {
 		return nil, err
 	}
+	rpcClient, err := rpc.DialHTTP(rpcUrl)
+	if err != nil {
+		return nil, err
+	}
 
 	return &SimpleRpcClient{
 		rpcUrl:        rpcUrl,
 		reqTimeout:    reqTimeout,
 		nodesGovAddr:  gethcmn.HexToAddress(nodesGovAddr),
 		sbchRpcClient: sbchRpcClient,
+		rpcClient:     rpcClient,
 	}, nil
 }
 
@@ -49,76 +60,168 @@ func (client *SimpleRpcClient) RpcURL() string {
 	return client.rpcUrl
 }
 
-func (client *SimpleRpcClient) GetSbchdNodes() ([]NodeInfo, error) {
-	ctx := context.Background()
+// withTimeout limits each request to reqTimeout, in addition to the deadline of ctx
+func (client *SimpleRpcClient) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
 	if client.reqTimeout > 0 {
-		var cancelFn context.CancelFunc
-		ctx, cancelFn = context.WithTimeout(context.Background(), client.reqTimeout)
-		defer cancelFn()
+		return context.WithTimeout(ctx, client.reqTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// GetSbchdNodes reads all nodes from NodesGov at the same block. The nodes are read
+// in one batch request, or in parallel if the batch request is rejected.
+func (client *SimpleRpcClient) GetSbchdNodes(ctx context.Context) ([]NodeInfo, error) {
+	ctx, cancelFn := client.withTimeout(ctx)
+	defer cancelFn()
+
+	blockNum, err := client.getBlockNumber(ctx)
+	if err != nil {
+		return nil, err
 	}
+	blockNumArg := hexutil.EncodeUint64(blockNum)
 
-	nodeCount, err := client.getNodeCount(ctx)
+	nodeCount, err := client.getNodeCount(ctx, blockNumArg)
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO: parallelize ?
+	calls := make([]rpc.BatchElem, nodeCount)
+	for i := range calls {
+		calls[i] = client.nodesGovCall(packGetNodeByIdx(uint64(i)), blockNumArg)
+	}
+	if err = client.batchCall(ctx, calls); err != nil {
+		return nil, err
+	}
+
 	nodes := make([]NodeInfo, nodeCount)
-	for i := uint64(0); i < nodeCount; i++ {
-		nodes[i], err = client.getNodeByIdx(i, ctx)
+	for i, call := range calls {
+		if call.Error != nil {
+			return nil, call.Error
+		}
+		nodes[i], err = decodeNodeInfo(*call.Result.(*hexutil.Bytes))
 		if err != nil {
 			return nil, err
 		}
 	}
-
 	return nodes, nil
 }
-func (client *SimpleRpcClient) getNodeCount(ctx context.Context) (uint64, error) {
-	callMsg := geth.CallMsg{
-		To:   &client.nodesGovAddr,
-		Data: gethcmn.FromHex(getNodeCountSel),
+func (client *SimpleRpcClient) GetBlockNumber(ctx context.Context) (uint64, error) {
+	ctx, cancelFn := client.withTimeout(ctx)
+	defer cancelFn()
+
+	return client.getBlockNumber(ctx)
+}
+func (client *SimpleRpcClient) getBlockNumber(ctx context.Context) (uint64, error) {
+	var blockNum hexutil.Uint64
+	err := client.rpcClient.CallContext(ctx, &blockNum, "eth_blockNumber")
+	return uint64(blockNum), err
+}
+
+// GetNodesGovEvents returns the NodesGov events in [fromBlock, toBlock], in the order they were emitted
+func (client *SimpleRpcClient) GetNodesGovEvents(ctx context.Context, fromBlock, toBlock uint64) ([]NodesGovEvent, error) {
+	ctx, cancelFn := client.withTimeout(ctx)
+	defer cancelFn()
+
+	filter := map[string]any{
+		"address":   client.nodesGovAddr,
+		"fromBlock": hexutil.EncodeUint64(fromBlock),
+		"toBlock":   hexutil.EncodeUint64(toBlock),
+		"topics":    [][]gethcmn.Hash{nodesGovEventTopics()},
 	}
-	nodeCountData, err := client.sbchRpcClient.CallContract(ctx, callMsg, nil)
-	if err != nil {
-		return 0, err
+	var logs []gethtypes.Log
+	if err := client.rpcClient.CallContext(ctx, &logs, "eth_getLogs", filter); err != nil {
+		return nil, err
+	}
+
+	events := make([]NodesGovEvent, 0, len(logs))
+	for _, log := range logs {
+		if log.Removed {
+			continue
+		}
+		if log.Address != client.nodesGovAddr || log.BlockNumber < fromBlock || log.BlockNumber > toBlock {
+			return nil, fmt.Errorf("unexpected log: %s#%d", log.TxHash.Hex(), log.Index)
+		}
+		event, err := decodeNodesGovLog(log)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
 	}
-	if len(nodeCountData) != 32 {
-		err = errors.New("invalid NodeCount data: " + hex.EncodeToString(nodeCountData))
+	return events, nil
+}
+
+func (client *SimpleRpcClient) getNodeCount(ctx context.Context, blockNum string) (uint64, error) {
+	call := client.nodesGovCall(packGetNodeCount(), blockNum)
+	err := client.rpcClient.CallContext(ctx, call.Result, call.Method, call.Args...)
+	if err != nil {
 		return 0, err
 	}
-	nodeCount := uint256.NewInt(0).SetBytes(nodeCountData).Uint64()
-	return nodeCount, nil
+	return unpackNodeCount(*call.Result.(*hexutil.Bytes))
 }
-func (client *SimpleRpcClient) getNodeByIdx(n uint64, ctx context.Context) (node NodeInfo, err error) {
-	callData := append(gethcmn.FromHex(getNodeByIdxSel), uint256.NewInt(n).PaddedBytes(32)...)
-	callMsg := geth.CallMsg{
-		To:   &client.nodesGovAddr,
-		Data: callData,
+
+// nodesGovCall returns an eth_call to NodesGov, the result is *hexutil.Bytes
+func (client *SimpleRpcClient) nodesGovCall(data []byte, blockNum string) rpc.BatchElem {
+	callArg := map[string]any{
+		"from": gethcmn.Address{},
+		"to":   client.nodesGovAddr,
+		"data": hexutil.Bytes(data),
 	}
-	nodeInfoData, err := client.sbchRpcClient.CallContract(ctx, callMsg, nil)
-	if err != nil {
-		return node, err
+	return rpc.BatchElem{
+		Method: "eth_call",
+		Args:   []any{callArg, blockNum},
+		Result: new(hexutil.Bytes),
 	}
+}
 
-	if len(nodeInfoData) != 32*4 {
-		err = errors.New("invalid NodeInfo data: " + hex.EncodeToString(nodeInfoData))
-		return
+// batchCall sends the calls in one batch request, falls back to parallel requests if the batch is rejected.
+// The errors of each call are set to its Error field.
+func (client *SimpleRpcClient) batchCall(ctx context.Context, calls []rpc.BatchElem) error {
+	if len(calls) == 0 {
+		return nil
+	}
+	err := client.rpcClient.BatchCallContext(ctx, calls)
+	if err == nil || ctx.Err() != nil || !isBatchRejected(err) {
+		return err
 	}
 
-	node.ID = uint256.NewInt(0).SetBytes(nodeInfoData[:32]).Uint64()
-	copy(node.PbkHash[:], nodeInfoData[32:32*2])
-	node.RpcUrl = string(bytes.TrimRight(nodeInfoData[32*2:32*3], string([]byte{0})))
-	node.Intro = string(bytes.TrimRight(nodeInfoData[32*3:], string([]byte{0})))
-	return
+	var wg sync.WaitGroup
+	for i := range calls {
+		wg.Add(1)
+		go func(call *rpc.BatchElem) {
+			defer wg.Done()
+			call.Error = client.rpcClient.CallContext(ctx, call.Result, call.Method, call.Args...)
+		}(&calls[i])
+	}
+	wg.Wait()
+	return ctx.Err()
 }
 
-func (client *SimpleRpcClient) GetRedeemingUtxosForOperators() ([]*sbchrpctypes.UtxoInfo, error) {
-	ctx := context.Background()
-	if client.reqTimeout > 0 {
-		var cancelFn context.CancelFunc
-		ctx, cancelFn = context.WithTimeout(ctx, client.reqTimeout)
-		defer cancelFn()
+// isBatchRejected tells if the server does not support batch requests, so that the calls can be sent one by one.
+// The other errors, such as timeouts, are returned without the fallback, which would only add load to the node.
+func isBatchRejected(err error) bool {
+	// a single error object instead of an array of results
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return true
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr.ErrorCode() == errCodeInvalidRequest || rpcErr.ErrorCode() == errCodeMethodNotFound
 	}
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case http.StatusBadRequest, http.StatusNotFound, http.StatusMethodNotAllowed,
+			http.StatusRequestEntityTooLarge, http.StatusNotImplemented:
+			return true
+		}
+	}
+	return false
+}
+
+func (client *SimpleRpcClient) GetRedeemingUtxosForOperators(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error) {
+	ctx, cancelFn := client.withTimeout(ctx)
+	defer cancelFn()
 
 	utxoInfos, err := client.sbchRpcClient.RedeemingUtxosForOperators(ctx)
 	if err != nil {
@@ -126,13 +229,9 @@ func (client *SimpleRpcClient) GetRedeemingUtxosForOperators() ([]*sbchrpctypes.
 	}
 	return utxoInfos.Infos, nil
 }
-func (client *SimpleRpcClient) GetRedeemingUtxosForMonitors() ([]*sbchrpctypes.UtxoInfo, error) {
-	ctx := context.Background()
-	if client.reqTimeout > 0 {
-		var cancelFn context.CancelFunc
-		ctx, cancelFn = context.WithTimeout(ctx, client.reqTimeout)
-		defer cancelFn()
-	}
+func (client *SimpleRpcClient) GetRedeemingUtxosForMonitors(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error) {
+	ctx, cancelFn := client.withTimeout(ctx)
+	defer cancelFn()
 
 	utxoInfos, err := client.sbchRpcClient.RedeemingUtxosForMonitors(ctx)
 	if err != nil {
@@ -140,13 +239,9 @@ func (client *SimpleRpcClient) GetRedeemingUtxosForMonitors() ([]*sbchrpctypes.U
 	}
 	return utxoInfos.Infos, nil
 }
-func (client *SimpleRpcClient) GetToBeConvertedUtxosForOperators() ([]*sbchrpctypes.UtxoInfo, error) {
-	ctx := context.Background()
-	if client.reqTimeout > 0 {
-		var cancelFn context.CancelFunc
-		ctx, cancelFn = context.WithTimeout(ctx, client.reqTimeout)
-		defer cancelFn()
-	}
+func (client *SimpleRpcClient) GetToBeConvertedUtxosForOperators(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error) {
+	ctx, cancelFn := client.withTimeout(ctx)
+	defer cancelFn()
 
 	utxoInfos, err := client.sbchRpcClient.ToBeConvertedUtxosForOperators(ctx)
 	if err != nil {
@@ -154,13 +249,9 @@ func (client *SimpleRpcClient) GetToBeConvertedUtxosForOperators() ([]*sbchrpcty
 	}
 	return utxoInfos.Infos, nil
 }
-func (client *SimpleRpcClient) GetToBeConvertedUtxosForMonitors() ([]*sbchrpctypes.UtxoInfo, error) {
-	ctx := context.Background()
-	if client.reqTimeout > 0 {
-		var cancelFn context.CancelFunc
-		ctx, cancelFn = context.WithTimeout(ctx, client.reqTimeout)
-		defer cancelFn()
-	}
+func (client *SimpleRpcClient) GetToBeConvertedUtxosForMonitors(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error) {
+	ctx, cancelFn := client.withTimeout(ctx)
+	defer cancelFn()
 
 	utxoInfos, err := client.sbchRpcClient.ToBeConvertedUtxosForMonitors(ctx)
 	if err != nil {
@@ -168,13 +259,9 @@ func (client *SimpleRpcClient) GetToBeConvertedUtxosForMonitors() ([]*sbchrpctyp
 	}
 	return utxoInfos.Infos, nil
 }
-func (client *SimpleRpcClient) GetRedeemableUtxos() ([]*sbchrpctypes.UtxoInfo, error) {
-	ctx := context.Background()
-	if client.reqTimeout > 0 {
-		var cancelFn context.CancelFunc
-		ctx, cancelFn = context.WithTimeout(ctx, client.reqTimeout)
-		defer cancelFn()
-	}
+func (client *SimpleRpcClient) GetRedeemableUtxos(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error) {
+	ctx, cancelFn := client.withTimeout(ctx)
+	defer cancelFn()
 
 	utxoInfos, err := client.sbchRpcClient.RedeemableUtxos(ctx)
 	if err != nil {
@@ -182,13 +269,9 @@ func (client *SimpleRpcClient) GetRedeemableUtxos() ([]*sbchrpctypes.UtxoInfo, e
 	}
 	return utxoInfos.Infos, nil
 }
-func (client *SimpleRpcClient) GetLostAndFoundUtxos() ([]*sbchrpctypes.UtxoInfo, error) {
-	ctx := context.Background()
-	if client.reqTimeout > 0 {
-		var cancelFn context.CancelFunc
-		ctx, cancelFn = context.WithTimeout(ctx, client.reqTimeout)
-		defer cancelFn()
-	}
+func (client *SimpleRpcClient) GetLostAndFoundUtxos(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error) {
+	ctx, cancelFn := client.withTimeout(ctx)
+	defer cancelFn()
 
 	utxoInfos, err := client.sbchRpcClient.LostAndFoundUtxos(ctx)
 	if err != nil {
@@ -197,16 +280,31 @@ func (client *SimpleRpcClient) GetLostAndFoundUtxos() ([]*sbchrpctypes.UtxoInfo,
 	return utxoInfos.Infos, nil
 }
 
-func (client *SimpleRpcClient) GetRpcPubkey() ([]byte, error) {
-	_, err := client.getCcInfo()
+func (client *SimpleRpcClient) GetRpcPubkey(ctx context.Context) ([]byte, error) {
+	_, err := client.getCcInfo(ctx)
 	if err != nil {
 		return nil, err
 	}
 	return client.sbchRpcClient.CachedRpcPubkey(), nil
 }
 
-func (client *SimpleRpcClient) GetMonitors() ([]gethcmn.Address, error) {
-	ccInfo, err := client.getCcInfo()
+// GetRpcPubkeyReport returns the SGX report whose data is sha256(rpcPubkey),
+// or ErrReportNotSupported if the node does not serve it, see EnclavePolicy
+func (client *SimpleRpcClient) GetRpcPubkeyReport(ctx context.Context) ([]byte, error) {
+	ctx, cancelFn := client.withTimeout(ctx)
+	defer cancelFn()
+
+	var report hexutil.Bytes
+	err := client.rpcClient.CallContext(ctx, &report, rpcPubkeyReportMethod)
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == errCodeMethodNotFound {
+		return nil, ErrReportNotSupported
+	}
+	return report, err
+}
+
+func (client *SimpleRpcClient) GetMonitors(ctx context.Context) ([]gethcmn.Address, error) {
+	ccInfo, err := client.getCcInfo(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -218,13 +316,54 @@ func (client *SimpleRpcClient) GetMonitors() ([]gethcmn.Address, error) {
 	return monitors, nil
 }
 
-func (client *SimpleRpcClient) getCcInfo() (*sbchrpctypes.CcInfo, error) {
-	ctx := context.Background()
-	if client.reqTimeout > 0 {
-		var cancelFn context.CancelFunc
-		ctx, cancelFn = context.WithTimeout(ctx, client.reqTimeout)
-		defer cancelFn()
+// GetCcInfo returns the CcInfo whose signature is verified and dropped
+func (client *SimpleRpcClient) GetCcInfo(ctx context.Context) (*sbchrpctypes.CcInfo, error) {
+	ccInfo, err := client.getCcInfo(ctx)
+	if err != nil {
+		return nil, err
 	}
+	ccInfo.Signature = nil
+	return ccInfo, nil
+}
+
+func (client *SimpleRpcClient) getCcInfo(ctx context.Context) (*sbchrpctypes.CcInfo, error) {
+	ctx, cancelFn := client.withTimeout(ctx)
+	defer cancelFn()
 
 	return client.sbchRpcClient.CcInfo(ctx)
 }
+
+func (client *SimpleRpcClient) GetChainStatus(ctx context.Context) (status ChainStatus, err error) {
+	ctx, cancelFn := client.withTimeout(ctx)
+	defer cancelFn()
+
+	var chainID hexutil.Uint64
+	if err = client.rpcClient.CallContext(ctx, &chainID, "eth_chainId"); err != nil {
+		return
+	}
+	genesis, err := client.getBlockHeader(ctx, "0x0")
+	if err != nil {
+		return
+	}
+	latest, err := client.getBlockHeader(ctx, "latest")
+	if err != nil {
+		return
+	}
+
+	status.ChainID = uint64(chainID)
+	status.GenesisHash = genesis.Hash
+	status.LatestBlockNum = uint64(latest.Number)
+	status.LatestBlockTime = int64(latest.Timestamp)
+	return
+}
+func (client *SimpleRpcClient) getBlockHeader(ctx context.Context, blockNum string) (*rpcBlockHeader, error) {
+	var header *rpcBlockHeader
+	err := client.rpcClient.CallContext(ctx, &header, "eth_getBlockByNumber", blockNum, false)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("block not found: %s", blockNum)
+	}
+	return header, nil
+}
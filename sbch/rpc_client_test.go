@@ -1,15 +1,19 @@
 package sbch
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -20,20 +24,31 @@ import (
 const (
 	testNodesGovAddr = "0x8f1Cc6B6f276B776f3b7dB417c65fE356a164715"
 
-	getNodeCountCallData = `{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"data":"0x39bf397e","from":"0x0000000000000000000000000000000000000000","to":"0x8f1cc6b6f276b776f3b7db417c65fe356a164715"},"latest"]}`
+	getBlockNumberReq    = `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`
+	getBlockNumberResp   = `{"jsonrpc":"2.0","id":1,"result":"0x64"}`
+	getNodeCountCallData = `{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"data":"0x39bf397e","from":"0x0000000000000000000000000000000000000000","to":"0x8f1cc6b6f276b776f3b7db417c65fe356a164715"},"0x64"]}`
 	getNodeCountRetData  = `{"jsonrpc":"2.0","id":1,"result":"0x0000000000000000000000000000000000000000000000000000000000000003"}`
-	getNode0CallData     = `{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"data":"0x1c53c2800000000000000000000000000000000000000000000000000000000000000000","from":"0x0000000000000000000000000000000000000000","to":"0x8f1cc6b6f276b776f3b7db417c65fe356a164715"},"latest"]}`
+	getNode0CallData     = `{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"data":"0x1c53c2800000000000000000000000000000000000000000000000000000000000000000","from":"0x0000000000000000000000000000000000000000","to":"0x8f1cc6b6f276b776f3b7db417c65fe356a164715"},"0x64"]}`
 	getNode0RetData      = `{"jsonrpc":"2.0","id":1,"result":"0x0000000000000000000000000000000000000000000000000000000000000001d86b49e3424e557beebf67bd06842cdb88e314c44887f3f265b7f81107dd61233132372e302e302e313a383534350000000000000000000000000000000000003132372e302e302e313a38353435000000000000000000000000000000000000"}`
-	getNode1CallData     = `{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"data":"0x1c53c2800000000000000000000000000000000000000000000000000000000000000001","from":"0x0000000000000000000000000000000000000000","to":"0x8f1cc6b6f276b776f3b7db417c65fe356a164715"},"latest"]}`
+	getNode1CallData     = `{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"data":"0x1c53c2800000000000000000000000000000000000000000000000000000000000000001","from":"0x0000000000000000000000000000000000000000","to":"0x8f1cc6b6f276b776f3b7db417c65fe356a164715"},"0x64"]}`
 	getNode1RetData      = `{"jsonrpc":"2.0","id":1,"result":"0x0000000000000000000000000000000000000000000000000000000000000002d86b49e3424e557beebf67bd06842cdb88e314c44887f3f265b7f81107dd62223132372e302e302e323a383534350000000000000000000000000000000000003132372e302e302e323a38353435000000000000000000000000000000000000"}`
-	getNode2CallData     = `{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"data":"0x1c53c2800000000000000000000000000000000000000000000000000000000000000002","from":"0x0000000000000000000000000000000000000000","to":"0x8f1cc6b6f276b776f3b7db417c65fe356a164715"},"latest"]}`
+	getNode2CallData     = `{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"data":"0x1c53c2800000000000000000000000000000000000000000000000000000000000000002","from":"0x0000000000000000000000000000000000000000","to":"0x8f1cc6b6f276b776f3b7db417c65fe356a164715"},"0x64"]}`
 	getNode2RetData      = `{"jsonrpc":"2.0","id":1,"result":"0x0000000000000000000000000000000000000000000000000000000000000003d86b49e3424e557beebf67bd06842cdb88e314c44887f3f265b7f81107dd63333132372e302e302e333a383534350000000000000000000000000000000000003132372e302e302e333a38353435000000000000000000000000000000000000"}`
 
+	// NodesGov returning rpcUrl and intro as dynamic strings
+	testNodesGovAddrV2     = "0x5b3a3E85d4d1e8fA1A4C6e4f3C5e5E2Cc0d1F0a2"
+	getNodeCountCallDataV2 = `{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"data":"0x39bf397e","from":"0x0000000000000000000000000000000000000000","to":"0x5b3a3e85d4d1e8fa1a4c6e4f3c5e5e2cc0d1f0a2"},"0x64"]}`
+	getNodeCountRetDataV2  = `{"jsonrpc":"2.0","id":1,"result":"0x0000000000000000000000000000000000000000000000000000000000000001"}`
+	getNode0CallDataV2     = `{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"data":"0x1c53c2800000000000000000000000000000000000000000000000000000000000000000","from":"0x0000000000000000000000000000000000000000","to":"0x5b3a3e85d4d1e8fa1a4c6e4f3c5e5e2cc0d1f0a2"},"0x64"]}`
+	getNode0RetDataV2      = `{"jsonrpc":"2.0","id":1,"result":"0x0000000000000000000000000000000000000000000000000000000000000004d86b49e3424e557beebf67bd06842cdb88e314c44887f3f265b7f81107dd6444000000000000000000000000000000000000000000000000000000000000008000000000000000000000000000000000000000000000000000000000000000e0000000000000000000000000000000000000000000000000000000000000002568747470733a2f2f73626368642d6e6f64652d342e6578616d706c652e636f6d3a38353435000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000003161206e6f6465207769746820616e20696e74726f206c6f6e676572207468616e207468697274792d74776f206279746573000000000000000000000000000000"}`
+
 	getRpcPubkeyReq  = `{"jsonrpc":"2.0","id":1,"method":"sbch_getRpcPubkey"}`
 	getRpcPubkeyResp = `{"jsonrpc":"2.0","id":1,"result":"04b48c5986dcdd12746db4fdc14a9546c220a91e230a2204fc279acddc4387a0b211b7615c2e971e25647ab46a80a5c6b269d86ccfcada4719d69b3a82992c8793"}`
 
 	getRedeemingUtxosReq     = `{"jsonrpc":"2.0","id":1,"method":"sbch_getRedeemingUtxosForOperators"}`
 	getToBeConvertedUtxosReq = `{"jsonrpc":"2.0","id":1,"method":"sbch_getToBeConvertedUtxosForOperators"}`
+	getRedeemableUtxosReq    = `{"jsonrpc":"2.0","id":1,"method":"sbch_getRedeemableUtxos"}`
+	getLostAndFoundUtxosReq  = `{"jsonrpc":"2.0","id":1,"method":"sbch_getLostAndFoundUtxos"}`
 	getUtxosResp             = `{
   "jsonrpc": "2.0",
   "id": 1,
@@ -174,7 +189,12 @@ func fakeServerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := fakeServerLogic(string(req))
+	var resp []byte
+	if bytes.HasPrefix(req, []byte("[")) {
+		resp, err = fakeServerBatchLogic(req)
+	} else {
+		resp, err = fakeServerLogic(string(req))
+	}
 	if err != nil {
 		_, _ = w.Write([]byte(err.Error()))
 		return
@@ -182,9 +202,52 @@ func fakeServerHandler(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(resp)
 }
 
+// fakeNoBatchServerHandler rejects batch requests like some proxies do
+func fakeNoBatchServerHandler(w http.ResponseWriter, r *http.Request) {
+	req, _ := io.ReadAll(r.Body)
+	if bytes.HasPrefix(req, []byte("[")) {
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"batch not supported"}}`))
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(req))
+	fakeServerHandler(w, r)
+}
+
+// fakeBatchStatusServerHandler fails batch requests with the HTTP status
+func fakeBatchStatusServerHandler(status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, _ := io.ReadAll(r.Body)
+		if bytes.HasPrefix(req, []byte("[")) {
+			w.WriteHeader(status)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(req))
+		fakeServerHandler(w, r)
+	}
+}
+
+func fakeServerBatchLogic(req []byte) ([]byte, error) {
+	var reqs []json.RawMessage
+	if err := json.Unmarshal(req, &reqs); err != nil {
+		return nil, err
+	}
+	resps := make([]json.RawMessage, len(reqs))
+	for i, r := range reqs {
+		id := regexp.MustCompile(`"id":\d+`).Find(r)
+		resp, err := fakeServerLogic(string(r))
+		if err != nil {
+			return nil, err
+		}
+		resps[i] = bytes.Replace(resp, []byte(`"id":1`), id, 1)
+	}
+	return json.Marshal(resps)
+}
+
 func fakeServerLogic(reqStr string) ([]byte, error) {
 	reqStr = regexp.MustCompile(`"id":\d+`).ReplaceAllString(reqStr, `"id":1`)
 	switch reqStr {
+	case getBlockNumberReq:
+		return []byte(getBlockNumberResp), nil
 	case getNodeCountCallData:
 		return []byte(getNodeCountRetData), nil
 	case getNode0CallData:
@@ -193,10 +256,18 @@ func fakeServerLogic(reqStr string) ([]byte, error) {
 		return []byte(getNode1RetData), nil
 	case getNode2CallData:
 		return []byte(getNode2RetData), nil
+	case getNodeCountCallDataV2:
+		return []byte(getNodeCountRetDataV2), nil
+	case getNode0CallDataV2:
+		return []byte(getNode0RetDataV2), nil
 	case getRedeemingUtxosReq:
 		return []byte(getUtxosResp), nil
 	case getToBeConvertedUtxosReq:
 		return []byte(getUtxosResp), nil
+	case getRedeemableUtxosReq:
+		return []byte(getUtxosResp), nil
+	case getLostAndFoundUtxosReq:
+		return []byte(getUtxosResp), nil
 	case getRpcPubkeyReq:
 		return []byte(getRpcPubkeyResp), nil
 	case getCcInfoReq:
@@ -211,21 +282,48 @@ func TestGetNodeCount(t *testing.T) {
 	fakeServer := httptest.NewServer(http.HandlerFunc(fakeServerHandler))
 	defer fakeServer.Close()
 	c, _ := NewSimpleRpcClient(testNodesGovAddr, fakeServer.URL, 0)
-	n, err := c.getNodeCount(context.Background())
+	n, err := c.getNodeCount(context.Background(), "0x64")
 	require.NoError(t, err)
 	require.Equal(t, uint64(3), n)
 }
 
 func TestGetNodeByIdx(t *testing.T) {
-	fakeServer := httptest.NewServer(http.HandlerFunc(fakeServerHandler))
-	defer fakeServer.Close()
-	c, _ := NewSimpleRpcClient(testNodesGovAddr, fakeServer.URL, 0)
-	node, err := c.getNodeByIdx(1, context.Background())
-	require.NoError(t, err)
-	require.Equal(t, uint64(2), node.ID)
-	require.Equal(t, "d86b49e3424e557beebf67bd06842cdb88e314c44887f3f265b7f81107dd6222",
-		hex.EncodeToString(node.PbkHash[:]))
-	require.Equal(t, "127.0.0.2:8545", node.RpcUrl)
+	// eth_blockNumber, getNodeCount, then one batch of nodes(i) or rejected batch + 3 calls
+	testCases := []struct {
+		handler http.HandlerFunc
+		nReqs   int32
+		err     string
+	}{
+		{fakeServerHandler, 3, ""},
+		{fakeNoBatchServerHandler, 6, ""},
+		{fakeBatchStatusServerHandler(http.StatusMethodNotAllowed), 6, ""},
+		// only a rejected batch falls back to the parallel calls
+		{fakeBatchStatusServerHandler(http.StatusServiceUnavailable), 3, "503 Service Unavailable"},
+	}
+	for _, tc := range testCases {
+		var reqCount atomic.Int32
+		handler := tc.handler
+		fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reqCount.Add(1)
+			handler(w, r)
+		}))
+		c, _ := NewSimpleRpcClient(testNodesGovAddr, fakeServer.URL, 0)
+		nodes, err := c.GetSbchdNodes(context.Background())
+		fakeServer.Close()
+		require.Equal(t, tc.nReqs, reqCount.Load())
+		if tc.err != "" {
+			requireErrorContains(t, err, tc.err)
+			continue
+		}
+		require.NoError(t, err)
+		require.Len(t, nodes, 3)
+
+		node := nodes[1]
+		require.Equal(t, uint64(2), node.ID)
+		require.Equal(t, "d86b49e3424e557beebf67bd06842cdb88e314c44887f3f265b7f81107dd6222",
+			hex.EncodeToString(node.PbkHash[:]))
+		require.Equal(t, "127.0.0.2:8545", node.RpcUrl)
+	}
 }
 
 func TestGetSbchdNodes(t *testing.T) {
@@ -236,12 +334,27 @@ func TestGetSbchdNodes(t *testing.T) {
 	c2 := &ClusterClient{clients: []RpcClient{c1, c1}}
 
 	for _, c := range []RpcClient{c1, c2} {
-		nodes, err := c.GetSbchdNodes()
+		nodes, err := c.GetSbchdNodes(context.Background())
 		require.NoError(t, err)
 		require.Len(t, nodes, 3)
 	}
 }
 
+func TestGetSbchdNodesWithStrings(t *testing.T) {
+	fakeServer := httptest.NewServer(http.HandlerFunc(fakeServerHandler))
+	defer fakeServer.Close()
+
+	c, _ := NewSimpleRpcClient(testNodesGovAddrV2, fakeServer.URL, 0)
+	nodes, err := c.GetSbchdNodes(context.Background())
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+	require.Equal(t, uint64(4), nodes[0].ID)
+	require.Equal(t, "d86b49e3424e557beebf67bd06842cdb88e314c44887f3f265b7f81107dd6444",
+		hex.EncodeToString(nodes[0].PbkHash[:]))
+	require.Equal(t, "https://sbchd-node-4.example.com:8545", nodes[0].RpcUrl)
+	require.Equal(t, "a node with an intro longer than thirty-two bytes", nodes[0].Intro)
+}
+
 func TestGetRedeemingUtxoSigHashes(t *testing.T) {
 	fakeServer := httptest.NewServer(http.HandlerFunc(fakeServerHandler))
 	defer fakeServer.Close()
@@ -250,7 +363,7 @@ func TestGetRedeemingUtxoSigHashes(t *testing.T) {
 	c2 := &ClusterClient{clients: []RpcClient{c1, c1}}
 
 	for _, c := range []RpcClient{c1, c2} {
-		utxos, err := c.GetRedeemingUtxosForOperators()
+		utxos, err := c.GetRedeemingUtxosForOperators(context.Background())
 		require.NoError(t, err)
 		require.Len(t, utxos, 2)
 	}
@@ -264,7 +377,24 @@ func TestGetToBeConvertedUtxoSigHashes(t *testing.T) {
 	c2 := &ClusterClient{clients: []RpcClient{c1, c1}}
 
 	for _, c := range []RpcClient{c1, c2} {
-		utxos, err := c.GetToBeConvertedUtxosForOperators()
+		utxos, err := c.GetToBeConvertedUtxosForOperators(context.Background())
+		require.NoError(t, err, c.RpcURL())
+		require.Len(t, utxos, 2)
+	}
+}
+
+func TestGetRedeemableAndLostAndFoundUtxos(t *testing.T) {
+	fakeServer := httptest.NewServer(http.HandlerFunc(fakeServerHandler))
+	defer fakeServer.Close()
+
+	c1, _ := NewSimpleRpcClient(testNodesGovAddr, fakeServer.URL, 0)
+	c2 := &ClusterClient{clients: []RpcClient{c1, c1}}
+
+	for _, c := range []RpcClient{c1, c2} {
+		utxos, err := c.GetRedeemableUtxos(context.Background())
+		require.NoError(t, err, c.RpcURL())
+		require.Len(t, utxos, 2)
+		utxos, err = c.GetLostAndFoundUtxos(context.Background())
 		require.NoError(t, err, c.RpcURL())
 		require.Len(t, utxos, 2)
 	}
@@ -284,9 +414,9 @@ func TestGetMonitors(t *testing.T) {
 	}
 
 	for _, c := range []RpcClient{c1, c2} {
-		monitors, err := c.GetMonitors()
+		monitors, err := c.GetMonitors(context.Background())
 		require.NoError(t, err)
-		require.Equal(t, expectedMonitors, monitors)
+		require.ElementsMatch(t, expectedMonitors, monitors)
 	}
 }
 
@@ -304,3 +434,47 @@ func TestSig(t *testing.T) {
 	ok := crypto.VerifySignature(pubkey, hash, sig[:64])
 	fmt.Println(ok)
 }
+
+// blockingClient blocks until ctx is done, failingClient fails immediately
+type blockingClient struct {
+	SimpleRpcClient
+	cancelled chan struct{}
+}
+
+func (client *blockingClient) GetMonitors(ctx context.Context) ([]gethcmn.Address, error) {
+	<-ctx.Done()
+	close(client.cancelled)
+	return nil, ctx.Err()
+}
+
+type failingClient struct {
+	SimpleRpcClient
+}
+
+func (client *failingClient) GetMonitors(ctx context.Context) ([]gethcmn.Address, error) {
+	return nil, errors.New("failed")
+}
+
+func TestClusterCancelOnFirstError(t *testing.T) {
+	c1 := &blockingClient{cancelled: make(chan struct{})}
+	c2 := &failingClient{SimpleRpcClient{rpcUrl: "failing"}}
+	cluster := &ClusterClient{clients: []RpcClient{c1, c2}}
+
+	_, err := cluster.GetMonitors(context.Background())
+	require.EqualError(t, err, "failed to call failing: failed")
+	select {
+	case <-c1.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("remaining call not cancelled")
+	}
+}
+
+func TestClusterCancelByCaller(t *testing.T) {
+	c1 := &blockingClient{cancelled: make(chan struct{})}
+	cluster := &ClusterClient{clients: []RpcClient{c1}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := cluster.GetMonitors(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -1,19 +1,28 @@
 package sbch
 
 import (
+	"context"
+
 	gethcmn "github.com/ethereum/go-ethereum/common"
 	sbchrpctypes "github.com/smartbch/smartbch/rpc/types"
 )
 
 type RpcClient interface {
 	RpcURL() string
-	GetSbchdNodes() ([]NodeInfo, error)
-	GetRedeemingUtxosForOperators() ([]*sbchrpctypes.UtxoInfo, error)
-	GetRedeemingUtxosForMonitors() ([]*sbchrpctypes.UtxoInfo, error)
-	GetToBeConvertedUtxosForOperators() ([]*sbchrpctypes.UtxoInfo, error)
-	GetToBeConvertedUtxosForMonitors() ([]*sbchrpctypes.UtxoInfo, error)
-	GetMonitors() ([]gethcmn.Address, error)
-	GetRpcPubkey() ([]byte, error)
+	GetSbchdNodes(ctx context.Context) ([]NodeInfo, error)
+	GetRedeemingUtxosForOperators(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error)
+	GetRedeemingUtxosForMonitors(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error)
+	GetToBeConvertedUtxosForOperators(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error)
+	GetToBeConvertedUtxosForMonitors(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error)
+	GetRedeemableUtxos(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error)
+	GetLostAndFoundUtxos(ctx context.Context) ([]*sbchrpctypes.UtxoInfo, error)
+	GetMonitors(ctx context.Context) ([]gethcmn.Address, error)
+	GetCcInfo(ctx context.Context) (*sbchrpctypes.CcInfo, error)
+	GetRpcPubkey(ctx context.Context) ([]byte, error)
+	GetRpcPubkeyReport(ctx context.Context) ([]byte, error)
+	GetChainStatus(ctx context.Context) (ChainStatus, error)
+	GetBlockNumber(ctx context.Context) (uint64, error)
+	GetNodesGovEvents(ctx context.Context, fromBlock, toBlock uint64) ([]NodesGovEvent, error)
 }
 
 type NodeInfo struct {
@@ -22,3 +31,12 @@ type NodeInfo struct {
 	RpcUrl  string       `json:"rpcUrl"`
 	Intro   string       `json:"intro"`
 }
+
+// NodesGovEvent is a node added/removed/updated event emitted by NodesGov
+type NodesGovEvent struct {
+	Event    string       `json:"event"` // NodeAdded, NodeRemoved or NodeUpdated
+	NodeID   uint64       `json:"nodeId"`
+	BlockNum uint64       `json:"blockNum"`
+	TxHash   gethcmn.Hash `json:"txHash"`
+	LogIndex uint         `json:"logIndex"`
+}
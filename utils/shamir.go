@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"errors"
+	"io"
+)
+
+// Shamir's secret sharing over GF(2^8), one polynomial per secret byte.
+// Each share is encoded as: x(1 byte) || y(len(secret) bytes).
+
+var (
+	errInvalidThreshold = errors.New("invalid threshold")
+	errNotEnoughShares  = errors.New("not enough shares")
+	errInvalidShares    = errors.New("invalid shares")
+)
+
+func SplitSecret(rand io.Reader, secret []byte, n, threshold int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("empty secret")
+	}
+	if threshold < 1 || threshold > n || n > 255 {
+		return nil, errInvalidThreshold
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][0] = byte(i + 1)
+	}
+
+	coeffs := make([]byte, threshold)
+	for j, s := range secret {
+		coeffs[0] = s
+		if _, err := io.ReadFull(rand, coeffs[1:]); err != nil {
+			return nil, err
+		}
+		for i := range shares {
+			shares[i][j+1] = evalPolynomial(coeffs, shares[i][0])
+		}
+	}
+	return shares, nil
+}
+
+func CombineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errNotEnoughShares
+	}
+	secretLen := len(shares[0]) - 1
+	if secretLen <= 0 {
+		return nil, errInvalidShares
+	}
+
+	xs := make([]byte, len(shares))
+	seen := map[byte]bool{}
+	for i, share := range shares {
+		if len(share) != secretLen+1 || share[0] == 0 || seen[share[0]] {
+			return nil, errInvalidShares
+		}
+		seen[share[0]] = true
+		xs[i] = share[0]
+	}
+
+	// Lagrange interpolation at x=0
+	secret := make([]byte, secretLen)
+	for i, share := range shares {
+		basis := byte(1)
+		for k, xk := range xs {
+			if k != i {
+				basis = gfMul(basis, gfDiv(xk, xk^xs[i]))
+			}
+		}
+		for j := range secret {
+			secret[j] ^= gfMul(share[j+1], basis)
+		}
+	}
+	return secret, nil
+}
+
+func evalPolynomial(coeffs []byte, x byte) byte {
+	y := byte(0)
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ coeffs[i]
+	}
+	return y
+}
+
+// multiplication in GF(2^8) with the AES polynomial x^8+x^4+x^3+x+1
+func gfMul(a, b byte) byte {
+	p := byte(0)
+	for b > 0 {
+		if b&1 != 0 {
+			p ^= a
+		}
+		hi := a & 0x80
+		a <<= 1
+		if hi != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+func gfDiv(a, b byte) byte {
+	// b^254 == b^-1
+	inv := byte(1)
+	for i := 0; i < 254; i++ {
+		inv = gfMul(inv, b)
+	}
+	return gfMul(a, inv)
+}
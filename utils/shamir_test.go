@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitAndCombineSecret(t *testing.T) {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+
+	shares, err := SplitSecret(rand.Reader, secret, 5, 3)
+	require.NoError(t, err)
+	require.Len(t, shares, 5)
+
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var picked [][]byte
+		for _, i := range subset {
+			picked = append(picked, shares[i])
+		}
+		recovered, err := CombineShares(picked)
+		require.NoError(t, err)
+		require.Equal(t, secret, recovered)
+	}
+
+	recovered, err := CombineShares(shares[:2])
+	require.NoError(t, err)
+	require.NotEqual(t, secret, recovered)
+
+	_, err = CombineShares([][]byte{shares[0], shares[0]})
+	require.Error(t, err)
+
+	_, err = SplitSecret(rand.Reader, secret, 3, 4)
+	require.Error(t, err)
+}